@@ -0,0 +1,203 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// annotations.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AnnotationRequest is an annotation query from Grafana
+type AnnotationRequest struct {
+	Annotation AnnotationDoc `json:"annotation"`
+	Range      RangeDoc      `json:"range"`
+}
+
+// AnnotationDoc -
+type AnnotationDoc struct {
+	Name   string `json:"name"`
+	Enable bool   `json:"enable"`
+	Query  string `json:"query"`
+}
+
+// Annotation is an event shown on Grafana panels
+type Annotation struct {
+	Annotation AnnotationDoc `json:"annotation"`
+	Time       int64         `json:"time"`
+	TimeEnd    int64         `json:"timeEnd,omitempty"`
+	Title      string        `json:"title"`
+	Text       string        `json:"text"`
+	Tags       []string      `json:"tags"`
+}
+
+// annotations returns events of an annotation query, e.g. elections, member_states or elections@*
+func (m *Metrics) annotations(w http.ResponseWriter, r *http.Request) {
+	list := []Annotation{}
+	var ar AnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+	m.RLock()
+	defer m.RUnlock()
+	query, host := splitHostTarget(strings.TrimSpace(ar.Annotation.Query))
+	if host == "" {
+		list = getAnnotations(&m.ftdcStats, query, ar.Range.From, ar.Range.To, m.getAnomalyAnnotations)
+	} else {
+		for _, label := range m.selectHosts(host) {
+			for _, a := range getAnnotations(m.hostStats[label], query, ar.Range.From, ar.Range.To, m.getAnomalyAnnotations) {
+				a.Title = label + ": " + a.Title
+				a.Tags = append(a.Tags, label)
+				list = append(list, a)
+			}
+		}
+	}
+	for i := range list {
+		list[i].Annotation = ar.Annotation
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// annotation queries, a query may have several of them separated by commas
+const (
+	annotationAnomalies    = "anomalies"
+	annotationElections    = "elections"
+	annotationMemberStates = "member_states"
+	annotationRestarts     = "restarts"
+	annotationVersions     = "versions"
+)
+
+// getAnomalyAnnotations returns anomalies of stats, computed once per stats and again after
+// new samples are merged. The caller holds the read lock.
+func (m *Metrics) getAnomalyAnnotations(ftdc *FTDCStats) []Annotation {
+	m.anomaliesMu.Lock()
+	defer m.anomaliesMu.Unlock()
+	list, ok := m.anomalies[ftdc]
+	if !ok {
+		if m.anomalies == nil {
+			m.anomalies = map[*FTDCStats][]Annotation{}
+		}
+		list = getAnomalyAnnotations(ftdc, m.thresholds, m.detector)
+		m.anomalies[ftdc] = list
+	}
+	return list
+}
+
+// resetAnomalyAnnotations removes computed anomalies of stats, all if ftdc is nil. The caller
+// holds the lock.
+func (m *Metrics) resetAnomalyAnnotations(ftdc *FTDCStats) {
+	m.anomaliesMu.Lock()
+	defer m.anomaliesMu.Unlock()
+	if ftdc == nil {
+		m.anomalies = nil
+	} else {
+		delete(m.anomalies, ftdc)
+	}
+}
+
+// getAnomalyAnnotations returns anomalies of all samples. It uses DefaultAnomalyThresholds
+// if thresholds is nil and DefaultAnomalyDetector if detector is nil.
+func getAnomalyAnnotations(ftdc *FTDCStats, thresholds []AnomalyThreshold, detector *AnomalyDetector) []Annotation {
+	list := []Annotation{}
+	first, last, ok := getServerStatusTimeRange(ftdc.ServerStatusColumns, ftdc.ServerStatusList)
+	if !ok {
+		return list
+	}
+	d := NewDiagnosis(*ftdc, first, last)
+	if thresholds != nil {
+		d.SetAnomalyThresholds(thresholds)
+	}
+	if detector != nil {
+		d.SetAnomalyDetector(*detector)
+	}
+	for _, a := range d.GetAnomalies() {
+		list = append(list, Annotation{Time: toMillis(a.Timestamp), TimeEnd: toMillis(a.EndTime), Title: a.Metric,
+			Text: fmt.Sprintf("%v peak %v (%v), %v", a.Metric, d.formatPeakValue(a.Peak, a.Metric), a.Threshold, a.Duration.Round(time.Second)),
+			Tags: []string{"anomaly", a.Severity, a.Kind}})
+	}
+	return list
+}
+
+// getAnnotations returns events of a query, e.g. anomalies,restarts. All events, anomalies
+// included, are returned if the query is empty. Anomalies of all samples are of getAnomalies,
+// called only if anomalies are returned, and are filtered by time range.
+func getAnnotations(ftdc *FTDCStats, query string, from time.Time, to time.Time,
+	getAnomalies func(ftdc *FTDCStats) []Annotation) []Annotation {
+	list := []Annotation{}
+	queries := map[string]bool{}
+	for _, q := range strings.Split(query, ",") {
+		if q = strings.TrimSpace(q); q != "" {
+			queries[q] = true
+		}
+	}
+	all := len(queries) == 0
+	inRange := func(t time.Time) bool { return !t.Before(from) && !t.After(to) }
+
+	for _, e := range ftdc.MemberStates {
+		if e.From < 0 || !inRange(e.Date) {
+			continue
+		}
+		if e.IsElection() && (all || queries[annotationElections] || queries[annotationMemberStates]) {
+			list = append(list, Annotation{Time: toMillis(e.Date), Title: "election",
+				Text: fmt.Sprintf("%v became PRIMARY (term %d)", e.Member, e.Term), Tags: []string{"election"}})
+		} else if !e.IsElection() && (all || queries[annotationMemberStates]) {
+			list = append(list, Annotation{Time: toMillis(e.Date), Title: "member state",
+				Text: fmt.Sprintf("%v %v → %v (term %d)", e.Member, e.FromName(), e.ToName(), e.Term), Tags: []string{"member_state"}})
+		}
+	}
+
+	if all || queries[annotationRestarts] {
+		for _, ss := range append(ftdc.ServerStatusColumns.getRestarts(), getRestarts(ftdc.ServerStatusList)...) {
+			if inRange(ss.LocalTime) {
+				list = append(list, Annotation{Time: toMillis(ss.LocalTime), Title: "restart",
+					Text: fmt.Sprintf("%v restarted, uptime %ds", ss.Process, ss.Uptime), Tags: []string{"restart"}})
+			}
+		}
+	}
+
+	if all || queries[annotationVersions] {
+		var version string
+		versions := append(ftdc.ServerStatusColumns.getVersions(), ftdc.ServerStatusList...)
+		sort.SliceStable(versions, func(i, j int) bool { return versions[i].LocalTime.Before(versions[j].LocalTime) })
+		for _, ss := range versions {
+			if ss.Version == "" || ss.Version == version {
+				continue
+			}
+			if version != "" && inRange(ss.LocalTime) {
+				list = append(list, Annotation{Time: toMillis(ss.LocalTime), Title: "version change",
+					Text: fmt.Sprintf("MongoDB v%v → v%v", version, ss.Version), Tags: []string{"version"}})
+			}
+			version = ss.Version
+		}
+	}
+
+	if all || queries[annotationAnomalies] {
+		for _, a := range getAnomalies(ftdc) {
+			if a.TimeEnd >= toMillis(from) && a.Time <= toMillis(to) {
+				list = append(list, a)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	return list
+}
+
+// getRestarts returns the first samples after uptime dropped
+func getRestarts(list []ServerStatusDoc) []ServerStatusDoc {
+	var restarts []ServerStatusDoc
+	for i := 1; i < len(list); i++ {
+		if list[i].Uptime < list[i-1].Uptime {
+			restarts = append(restarts, list[i])
+		}
+	}
+	return restarts
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
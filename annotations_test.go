@@ -0,0 +1,118 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// annotations_test.go
+
+package ftdc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// getTestAnnotationStats returns stats of a restart and a version change at 60s, and a
+// latency_read anomaly from 30s to 49s
+func getTestAnnotationStats(start time.Time) FTDCStats {
+	stats := newTestStats(start, 120, map[string]func(int) float64{
+		"latency_read": func(i int) float64 {
+			if i >= 30 && i < 50 {
+				return 45
+			}
+			return 1
+		},
+	})
+	cols := &stats.ServerStatusColumns
+	for i := 60; i < cols.Len(); i++ {
+		cols.Values[uptimePath][i] = uint64(i - 60)
+	}
+	cols.Labels = []ServerStatusLabel{{Process: "mongod", Version: "6.0.5"}, {Index: 60, Process: "mongod", Version: "7.0.2"}}
+	return stats
+}
+
+func TestGetAnnotations(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	stats := getTestAnnotationStats(start)
+	var computed int
+	getAnomalies := func(ftdc *FTDCStats) []Annotation {
+		computed++
+		return getAnomalyAnnotations(ftdc, nil, nil)
+	}
+	list := getAnnotations(&stats, "", start, start.Add(time.Hour), getAnomalies)
+	if len(list) != 3 || list[0].Title != "latency_read" || list[1].Title != "restart" || list[2].Title != "version change" {
+		t.Fatalf("unexpected annotations %v", list)
+	}
+	if list[0].TimeEnd-list[0].Time != 19000 || !strings.Contains(list[2].Text, "v6.0.5 → v7.0.2") {
+		t.Fatalf("unexpected annotations %v", list)
+	}
+	if list = getAnnotations(&stats, "restarts, versions", start, start.Add(time.Hour), getAnomalies); len(list) != 2 || computed != 1 {
+		t.Fatalf("expected 2 annotations without anomalies, got %v", list)
+	}
+	if list = getAnnotations(&stats, "", start.Add(90*time.Second), start.Add(time.Hour), getAnomalies); len(list) != 0 {
+		t.Fatalf("expected no annotations, got %v", list)
+	}
+	if list = getAnnotations(&stats, "anomalies", start.Add(40*time.Second), start.Add(45*time.Second), getAnomalies); len(list) != 1 {
+		t.Fatalf("expected the anomaly overlapping the range, got %v", list)
+	}
+
+	// versions of columns and of keyhole stats are in time order
+	stats = newTestStats(start, 10, nil)
+	stats.ServerStatusList = []ServerStatusDoc{{LocalTime: start.Add(-time.Minute), Version: "6.0.5"}}
+	if list = getAnnotations(&stats, "versions", start.Add(-time.Hour), start.Add(time.Hour), getAnomalies); len(list) != 1 ||
+		list[0].Time != toMillis(start) || !strings.Contains(list[0].Text, "v6.0.5 → v7.0.2") {
+		t.Fatalf("expected an upgrade to v7.0.2, got %v", list)
+	}
+}
+
+func TestGetAnnotationsColumns(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	dir := filepath.Join(t.TempDir(), "diagnostic.data")
+	sample := func(start time.Time, i int) bson.D { // upgraded from v6.0.5 at the chunk of sample 75
+		doc := getColumnsTestSample(start, i)
+		if i < 75 {
+			doc[1].Value.(bson.D)[1].Value = "6.0.5"
+		}
+		return doc
+	}
+	writeTestFile(t, filepath.Join(dir, "metrics.2020-05-13T14-20-19Z-00000"), "", start, 120,
+		testFileOptions{maxSamples: 25, sample: sample})
+	m := &Metrics{}
+	if err := m.ProcessFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	stats := m.GetFTDCStats()
+	noAnomalies := func(ftdc *FTDCStats) []Annotation { return nil }
+	list := getAnnotations(&stats, "restarts,versions", start, start.Add(time.Hour), noAnomalies)
+	if len(list) != 2 || list[0].Title != "restart" || list[1].Title != "version change" {
+		t.Fatalf("unexpected annotations %v", list)
+	}
+	if restart := start.Add(60 * time.Second); list[0].Time != toMillis(restart) || !strings.Contains(list[0].Text, "uptime 1000s") {
+		t.Fatalf("expected the restart at %v, got %v", restart, list[0])
+	}
+	if upgrade := start.Add(75 * time.Second); list[1].Time != toMillis(upgrade) || !strings.Contains(list[1].Text, "v6.0.5 → v7.0.2") {
+		t.Fatalf("expected the version change at %v, got %v", upgrade, list[1])
+	}
+}
+
+func TestGetAnomalyAnnotations(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	m := &Metrics{ftdcStats: getTestAnnotationStats(start)}
+	body := `{"range": {"from": "2020-05-13T14:00:00Z", "to": "2020-05-13T15:00:00Z"}, "annotation": {"name": "events", "query": "anomalies"}}`
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/annotations", strings.NewReader(body)))
+		if !strings.Contains(w.Body.String(), "latency_read") {
+			t.Fatalf("unexpected annotations %v", w.Body.String())
+		}
+	}
+	if len(m.anomalies) != 1 || len(m.anomalies[&m.ftdcStats]) != 1 {
+		t.Fatalf("expected anomalies computed once, got %v", m.anomalies)
+	}
+	m.mergeFTDCDetailStats(&m.ftdcStats, NewDiagnosticData()) // e.g. new samples of follow mode
+	if len(m.anomalies) != 0 {
+		t.Fatalf("expected anomalies reset, got %v", m.anomalies)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// anomaly_detector.go
+
+package ftdc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Kinds of anomaly events
+const (
+	AnomalyThresholdKind  = "threshold"   // beyond a fixed threshold
+	AnomalyDeviationKind  = "deviation"   // away from the rolling baseline
+	AnomalyLevelShiftKind = "level_shift" // change point of the level
+)
+
+// AnomalyDetector flags deviations of metrics from a rolling median/MAD baseline and level
+// shifts, both learned from the capture itself. Hourly or daily seasonality is removed first
+// if the capture has at least 3 cycles of it.
+type AnomalyDetector struct {
+	Disable   bool     `json:"disable" yaml:"disable"`
+	Metrics   []string `json:"metrics" yaml:"metrics"`       // names or patterns, e.g. ops_*
+	Deviation float64  `json:"deviation" yaml:"deviation"`   // robust z-score, |x - median| / (1.4826 * MAD)
+	Shift     float64  `json:"shift" yaml:"shift"`           // robust z-score of levels before and after
+	MinChange float64  `json:"min_change" yaml:"min_change"` // percentage of the baseline
+	Window    int      `json:"window" yaml:"window"`         // seconds of the rolling baseline
+	Duration  int      `json:"duration" yaml:"duration"`     // min seconds of a deviation
+	Severity  string   `json:"severity" yaml:"severity"`
+}
+
+// DefaultAnomalyDetector detects anomalies of workload, latency and resource metrics
+var DefaultAnomalyDetector = AnomalyDetector{
+	Metrics: []string{"ops_*", "latency_*", "conns_current", "conns_created/s", "net_requests",
+		"scan_keys", "scan_objects", "wt_cache_dirty", "cpu_user", "cpu_system"},
+	Deviation: 6, Shift: 6, MinChange: 50, Window: 600, Duration: 30, Severity: "warning",
+}
+
+const (
+	detectorBucket         = 10  // seconds, buckets are medians of samples
+	minSeasonCycles        = 3   // cycles of a period to learn seasonality
+	minSeasonalityStrength = 0.5 // variance explained by the seasonal profile
+)
+
+// seasonPeriods are candidate periods of seasonality and phase resolutions of profiles, in seconds
+var seasonPeriods = [][2]int64{{3600, 60}, {86400, 300}}
+
+// detectorSample is a bucket of samples
+type detectorSample struct {
+	start time.Time
+	value float64 // median
+	min   float64
+	max   float64
+}
+
+// withDefaults returns a detector with unset values of DefaultAnomalyDetector
+func (det AnomalyDetector) withDefaults() AnomalyDetector {
+	def := DefaultAnomalyDetector
+	if det.Metrics == nil {
+		det.Metrics = def.Metrics
+	}
+	if det.Deviation <= 0 {
+		det.Deviation = def.Deviation
+	}
+	if det.Shift <= 0 {
+		det.Shift = def.Shift
+	}
+	if det.MinChange <= 0 {
+		det.MinChange = def.MinChange
+	}
+	if det.Window < 6*detectorBucket {
+		det.Window = def.Window
+	}
+	if det.Duration <= 0 {
+		det.Duration = def.Duration
+	}
+	if det.Severity == "" {
+		det.Severity = def.Severity
+	}
+	return det
+}
+
+// detect returns deviations and level shifts of a metric
+func (det AnomalyDetector) detect(metric string, data TimeSeriesDoc) []AnomalyEvent {
+	samples := getDetectorSamples(data, detectorBucket)
+	window := det.Window / detectorBucket
+	if len(samples) < 2*window {
+		return nil
+	}
+	offsets := getSeasonalOffsets(samples)
+	residuals := make([]float64, len(samples))
+	for i, s := range samples {
+		residuals[i] = s.value - offsets[i]
+	}
+
+	// level shifts, medians of half windows before and after
+	half := window / 2
+	var events []AnomalyEvent
+	var shifts []int
+	medians, mads := getRollingStats(residuals, half)
+	best, bestDiff := -1, 0.
+	for i := half; i <= len(samples); i++ {
+		isShift := false
+		var diff float64
+		if i+half <= len(samples) { // medians[i+half] are of [i, i+half)
+			diff = medians[i+half] - medians[i]
+			scale := 1.4826 * (mads[i] + mads[i+half]) / 2
+			isShift = math.Abs(diff) > det.Shift*scale && math.Abs(diff) > det.MinChange/100*math.Abs(medians[i])
+		}
+		if isShift && math.Abs(diff) > math.Abs(bestDiff) {
+			best, bestDiff = i, diff
+		} else if !isShift && best >= 0 { // end of candidates, the largest is the change point
+			shifts = append(shifts, best)
+			events = append(events, det.getLevelShift(metric, samples, best, half))
+			i, best, bestDiff = best+half, -1, 0
+		}
+	}
+
+	// deviations from the trailing window
+	medians, mads = getRollingStats(residuals, window)
+	start, direction := -1, 0
+	for i := 0; i <= len(samples); i++ {
+		deviated := 0 // 1 above and -1 below the baseline
+		if i < len(samples) && !math.IsNaN(medians[i]) {
+			diff := residuals[i] - medians[i]
+			baseline := medians[i] + offsets[i]
+			if math.Abs(diff) > det.Deviation*1.4826*mads[i] && math.Abs(diff) > det.MinChange/100*math.Abs(baseline) {
+				deviated = int(math.Copysign(1, diff))
+			}
+		}
+		if start >= 0 && deviated != direction {
+			if !isNearShift(start, shifts, half) && i-start >= det.Duration/detectorBucket {
+				events = append(events, det.getDeviation(metric, samples, medians, offsets, start, i, direction > 0))
+			}
+			start = -1
+		}
+		if start < 0 && deviated != 0 {
+			start, direction = i, deviated
+		}
+	}
+	return events
+}
+
+// getLevelShift returns a level shift at a sample
+func (det AnomalyDetector) getLevelShift(metric string, samples []detectorSample, i int, half int) AnomalyEvent {
+	var before, after []float64
+	for j := i - half; j < i+half && j < len(samples); j++ {
+		if j < i {
+			before = append(before, samples[j].value)
+		} else {
+			after = append(after, samples[j].value)
+		}
+	}
+	end := samples[i+len(after)-1].start.Add(detectorBucket * time.Second)
+	level := getMedian(after)
+	return AnomalyEvent{Timestamp: samples[i].start, EndTime: end, Duration: end.Sub(samples[i].start),
+		Metric: metric, Peak: level, Severity: det.Severity, Kind: AnomalyLevelShiftKind,
+		Threshold: fmt.Sprintf("level %v → %v", formatComparisonValue(getMedian(before), metric),
+			formatComparisonValue(level, metric))}
+}
+
+// getDeviation returns a deviation of samples [start, end), the peak is the max above or the
+// min below the baseline
+func (det AnomalyDetector) getDeviation(metric string, samples []detectorSample, medians []float64,
+	offsets []float64, start int, end int, above bool) AnomalyEvent {
+	op, peak, baseline := ">", samples[start].max, medians[start]+offsets[start]
+	if !above {
+		op, peak = "<", samples[start].min
+	}
+	for i := start + 1; i < end; i++ {
+		if (above && samples[i].max > peak) || (!above && samples[i].min < peak) {
+			peak, baseline = samples[i].max, medians[i]+offsets[i]
+			if !above {
+				peak = samples[i].min
+			}
+		}
+	}
+	endTime := samples[end-1].start.Add(detectorBucket * time.Second)
+	return AnomalyEvent{Timestamp: samples[start].start, EndTime: endTime, Duration: endTime.Sub(samples[start].start),
+		Metric: metric, Peak: peak, Severity: det.Severity, Kind: AnomalyDeviationKind,
+		Threshold: fmt.Sprintf("%v baseline %v", op, formatComparisonValue(baseline, metric))}
+}
+
+// isNearShift returns true if a sample is within half a window of a level shift, which explains it
+func isNearShift(i int, shifts []int, half int) bool {
+	for _, s := range shifts {
+		if i >= s-half && i <= s+half {
+			return true
+		}
+	}
+	return false
+}
+
+// getDetectorSamples returns medians of data points by buckets of seconds, empty buckets are skipped
+func getDetectorSamples(data TimeSeriesDoc, seconds int64) []detectorSample {
+	var samples []detectorSample
+	var values []float64
+	var bucket int64 = math.MinInt64
+	flush := func() {
+		if len(values) == 0 {
+			return
+		}
+		s := detectorSample{start: time.Unix(bucket*seconds, 0), value: getMedian(values), min: values[0], max: values[0]}
+		for _, v := range values {
+			s.min, s.max = math.Min(s.min, v), math.Max(s.max, v)
+		}
+		samples = append(samples, s)
+		values = values[:0]
+	}
+	for i, v := range data.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		b := int64(data.Times[i]) / 1000 / seconds
+		if b != bucket {
+			flush()
+			bucket = b
+		}
+		values = append(values, v)
+	}
+	flush()
+	return samples
+}
+
+// getSeasonalOffsets returns offsets of samples from the level by phase of the strongest hourly or
+// daily seasonality, or zeros if none. Profiles are medians of phases by cycle, and the strength is
+// measured against profiles of other cycles, so that noise isn't learned as seasonality.
+func getSeasonalOffsets(samples []detectorSample) []float64 {
+	offsets := make([]float64, len(samples))
+	if len(samples) == 0 {
+		return offsets
+	}
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.value
+	}
+	level := getMedian(values)
+	span := samples[len(samples)-1].start.Sub(samples[0].start)
+	strongest := minSeasonalityStrength
+	for _, sp := range seasonPeriods {
+		period, phaseSec := sp[0], sp[1]
+		if span < time.Duration(minSeasonCycles*period)*time.Second {
+			continue
+		}
+		phases := map[int64]map[int64][]float64{} // phase -> cycle -> values
+		for _, s := range samples {
+			phase, cycle := s.start.Unix()%period/phaseSec, s.start.Unix()/period
+			if phases[phase] == nil {
+				phases[phase] = map[int64][]float64{}
+			}
+			phases[phase][cycle] = append(phases[phase][cycle], s.value)
+		}
+		profile := map[int64]float64{}
+		var residual, total float64
+		for phase, cycles := range phases {
+			var keys []int64
+			var medians []float64
+			for cycle, list := range cycles {
+				keys = append(keys, cycle)
+				medians = append(medians, getMedian(list))
+			}
+			sort.Sort(cycleMedians{keys, medians})
+			profile[phase] = getSortedMedian(medians)
+			for k := 0; k < len(keys) && len(keys) > 1; k++ {
+				expected := getSortedMedianExcluding(medians, k)
+				for _, v := range cycles[keys[k]] {
+					residual += (v - expected) * (v - expected)
+					total += (v - level) * (v - level)
+				}
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		if strength := 1 - residual/total; strength > strongest {
+			strongest = strength
+			for i, s := range samples {
+				offsets[i] = profile[s.start.Unix()%period/phaseSec] - level
+			}
+		}
+	}
+	return offsets
+}
+
+// getRollingStats returns medians and MADs of the trailing n values of each index up to
+// len(values), NaN if fewer than n/2 values precede it
+func getRollingStats(values []float64, n int) ([]float64, []float64) {
+	medians := make([]float64, len(values)+1)
+	mads := make([]float64, len(values)+1)
+	var window []float64 // sorted
+	devs := make([]float64, 0, n)
+	for i := 0; i <= len(values); i++ {
+		if len(window) == 0 || len(window) < n/2 {
+			medians[i], mads[i] = math.NaN(), math.NaN()
+		} else {
+			median := getSortedMedian(window)
+			devs = devs[:0]
+			for _, v := range window {
+				devs = append(devs, math.Abs(v-median))
+			}
+			sort.Float64s(devs)
+			medians[i], mads[i] = median, getSortedMedian(devs)
+		}
+		if i == len(values) {
+			break
+		}
+		j := sort.SearchFloat64s(window, values[i])
+		window = append(window, 0)
+		copy(window[j+1:], window[j:])
+		window[j] = values[i]
+		if i >= n {
+			k := sort.SearchFloat64s(window, values[i-n])
+			window = append(window[:k], window[k+1:]...)
+		}
+	}
+	return medians, mads
+}
+
+// getSortedMedianExcluding returns the median of a sorted array without its k-th value
+func getSortedMedianExcluding(arr []float64, k int) float64 {
+	at := func(i int) float64 {
+		if i >= k {
+			i++
+		}
+		return arr[i]
+	}
+	n := len(arr) - 1
+	if n%2 == 1 {
+		return at(n / 2)
+	}
+	return (at(n/2-1) + at(n/2)) / 2
+}
+
+// cycleMedians sorts medians of cycles
+type cycleMedians struct {
+	cycles  []int64
+	medians []float64
+}
+
+func (c cycleMedians) Len() int           { return len(c.medians) }
+func (c cycleMedians) Less(i, j int) bool { return c.medians[i] < c.medians[j] }
+func (c cycleMedians) Swap(i, j int) {
+	c.cycles[i], c.cycles[j] = c.cycles[j], c.cycles[i]
+	c.medians[i], c.medians[j] = c.medians[j], c.medians[i]
+}
+
+func getSortedMedian(arr []float64) float64 {
+	if len(arr)%2 == 1 {
+		return arr[len(arr)/2]
+	}
+	return (arr[len(arr)/2-1] + arr[len(arr)/2]) / 2
+}
@@ -0,0 +1,126 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// anomaly_detector_test.go
+
+package ftdc
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestDetectorSeries(start time.Time, seconds int, value func(i int) float64) TimeSeriesDoc {
+	var points [][]float64
+	for i := 0; i < seconds; i++ {
+		t := float64(start.Add(time.Duration(i)*time.Second).UnixNano() / int64(time.Millisecond))
+		noise := float64((i*7)%11-5) / 100 // ±5%
+		points = append(points, []float64{value(i) * (1 + noise), t})
+	}
+	return NewTimeSeriesDoc("", points)
+}
+
+func TestAnomalyDetectorLevelShift(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 0, 0, 0, time.UTC)
+	data := getTestDetectorSeries(start, 3600, func(i int) float64 {
+		if i >= 1800 {
+			return 9000
+		}
+		return 2000
+	})
+	events := DefaultAnomalyDetector.detect("ops_update", data)
+	if len(events) != 1 || events[0].Kind != AnomalyLevelShiftKind {
+		t.Fatalf("expected a level shift, got %+v", events)
+	}
+	if !events[0].Timestamp.Equal(start.Add(30*time.Minute)) || events[0].Threshold != "level 2.0K → 9.0K" {
+		t.Fatalf("unexpected level shift %+v", events[0])
+	}
+}
+
+func TestAnomalyDetectorDeviation(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 0, 0, 0, time.UTC)
+	data := getTestDetectorSeries(start, 3600, func(i int) float64 {
+		if i >= 1800 && i < 1920 {
+			return 10
+		}
+		return 2
+	})
+	events := DefaultAnomalyDetector.detect("latency_read", data)
+	if len(events) != 1 || events[0].Kind != AnomalyDeviationKind || events[0].Duration != 2*time.Minute {
+		t.Fatalf("expected a deviation of 2 minutes, got %+v", events)
+	}
+	if math.Abs(events[0].Peak-10.5) > 0.01 || !strings.HasPrefix(events[0].Threshold, "> baseline 2.0") {
+		t.Fatalf("unexpected deviation %+v", events[0])
+	}
+
+	// a dip too short
+	data = getTestDetectorSeries(start, 3600, func(i int) float64 {
+		if i >= 1800 && i < 1820 {
+			return 0
+		}
+		return 1000
+	})
+	if events = DefaultAnomalyDetector.detect("ops_query", data); len(events) != 0 {
+		t.Fatalf("expected no anomalies, got %+v", events)
+	}
+	if events = DefaultAnomalyDetector.detect("ops_query", TimeSeriesDoc{}); len(events) != 0 {
+		t.Fatalf("expected no anomalies, got %+v", events)
+	}
+}
+
+func TestAnomalyDetectorSeasonality(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 0, 0, 0, time.UTC)
+	hourly := func(i int) float64 { return 1000 + 800*math.Sin(2*math.Pi*float64(i)/3600) }
+	samples := getDetectorSamples(getTestDetectorSeries(start, 4*3600, hourly), detectorBucket)
+	offsets := getSeasonalOffsets(samples)
+	for i, s := range samples {
+		if expected := hourly(int(s.start.Sub(start).Seconds())) - 1000; math.Abs(offsets[i]-expected) > 100 {
+			t.Fatalf("expected offset %v at %v, got %v", expected, s.start, offsets[i])
+		}
+	}
+
+	if events := DefaultAnomalyDetector.detect("ops_query", getTestDetectorSeries(start, 4*3600, hourly)); len(events) != 0 {
+		t.Fatalf("expected no anomalies of seasonality, got %+v", events)
+	}
+
+	// noise isn't seasonality
+	noise := func(i int) float64 { return float64(1000 + (i*7919)%300) }
+	samples = getDetectorSamples(getTestDetectorSeries(start, 4*3600, noise), detectorBucket)
+	for _, offset := range getSeasonalOffsets(samples) {
+		if offset != 0 {
+			t.Fatalf("unexpected offset %v", offset)
+		}
+	}
+
+	// a deviation from the seasonal pattern
+	data := getTestDetectorSeries(start, 4*3600, func(i int) float64 {
+		if i >= 3*3600+900 && i < 3*3600+1020 { // at the peak of the cycle
+			return 4000
+		}
+		return hourly(i)
+	})
+	events := DefaultAnomalyDetector.detect("ops_query", data)
+	if len(events) != 1 || events[0].Kind != AnomalyDeviationKind || !events[0].Timestamp.Equal(start.Add(3*time.Hour+15*time.Minute)) {
+		t.Fatalf("expected a deviation, got %+v", events)
+	}
+}
+
+func TestDiagnosisAnomalyDetector(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 0, 0, 0, time.UTC)
+	stats := FTDCStats{TimeSeriesData: map[string]TimeSeriesDoc{}}
+	stats.TimeSeriesData["ops_update"] = getTestDetectorSeries(start, 3600, func(i int) float64 {
+		return 2000 + 7000*float64(i/1800)
+	})
+	d := NewDiagnosis(stats, start, start.Add(time.Hour))
+	if anomalies := d.GetAnomalies(); len(anomalies) != 1 || anomalies[0].Metric != "ops_update" {
+		t.Fatalf("expected a level shift of ops_update, got %+v", anomalies)
+	}
+	d.SetAnomalyDetector(AnomalyDetector{Disable: true})
+	if anomalies := d.GetAnomalies(); len(anomalies) != 0 {
+		t.Fatalf("expected no anomalies, got %+v", anomalies)
+	}
+	d.SetAnomalyDetector(AnomalyDetector{Metrics: []string{"latency_*"}})
+	if anomalies := d.GetAnomalies(); len(anomalies) != 0 {
+		t.Fatalf("expected no anomalies, got %+v", anomalies)
+	}
+}
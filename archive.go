@@ -0,0 +1,244 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive.go
+
+package ftdc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveExts are extensions of supported archives, e.g. Atlas Download Diagnostics
+var archiveExts = []string{".tar.gz", ".tgz", ".zip"}
+
+// ArchiveMember is a metrics file in an archive
+type ArchiveMember struct {
+	Name    string // slash separated path in the archive
+	Size    int64
+	ModTime time.Time
+}
+
+// IsArchiveFile returns true if a file is a .tar.gz, .tgz or .zip archive
+func IsArchiveFile(filename string) bool {
+	name := strings.ToLower(filename)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetArchiveMembers returns metrics members of an archive sorted by name
+func GetArchiveMembers(filename string) ([]ArchiveMember, error) {
+	var members []ArchiveMember
+	err := WalkArchive(filename, func(member ArchiveMember, r io.Reader) error {
+		members = append(members, member)
+		return nil
+	})
+	sort.Slice(members, func(i int, j int) bool { return members[i].Name < members[j].Name })
+	return members, err
+}
+
+// WalkArchive calls fn with a reader of each metrics member of an archive. Members are
+// streamed from the archive without extracting to disk, a reader is valid until fn returns.
+func WalkArchive(filename string, fn func(member ArchiveMember, r io.Reader) error) error {
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		return walkZip(filename, fn)
+	}
+	return walkTarGz(filename, fn)
+}
+
+func walkTarGz(filename string, fn func(member ArchiveMember, r io.Reader) error) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !isMetricsMember(header.Name) {
+			continue
+		}
+		member := ArchiveMember{Name: cleanMemberName(header.Name), Size: header.Size, ModTime: header.ModTime}
+		if err = fn(member, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(filename string, fn func(member ArchiveMember, r io.Reader) error) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isMetricsMember(f.Name) {
+			continue
+		}
+		member := ArchiveMember{Name: cleanMemberName(f.Name), Size: int64(f.UncompressedSize64), ModTime: f.Modified}
+		if err = walkZipFile(f, member, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(f *zip.File, member ArchiveMember, fn func(member ArchiveMember, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return fn(member, rc)
+}
+
+// isMetricsMember returns true of metrics.* members, e.g. not __MACOSX/._metrics.*
+func isMetricsMember(name string) bool {
+	return strings.HasPrefix(path.Base(name), "metrics.")
+}
+
+// cleanMemberName returns a relative slash separated path of a member, e.g. without ../
+func cleanMemberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+}
+
+// getArchiveEndTime returns the latest modified time of archive members
+func getArchiveEndTime(members map[string][]ArchiveMember) time.Time {
+	var end time.Time
+	for _, list := range members {
+		for _, member := range list {
+			if member.ModTime.After(end) {
+				end = member.ModTime
+			}
+		}
+	}
+	return end
+}
+
+// splitArchiveFiles separates archives from other files and directories
+func splitArchiveFiles(filenames []string) ([]string, []string) {
+	var archives, others []string
+	for _, filename := range filenames {
+		if IsArchiveFile(filename) {
+			archives = append(archives, filename)
+		} else {
+			others = append(others, filename)
+		}
+	}
+	return archives, others
+}
+
+// processArchive decodes metrics members of an archive, members of each directory, e.g.
+// host1/diagnostic.data, are loaded as a host
+func (m *Metrics) processArchive(filename string, members []ArchiveMember) ([]InputFile, error) {
+	var dirs []string
+	groups := map[string][]ArchiveMember{}
+	for _, member := range members {
+		dir := path.Dir(member.Name)
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], member)
+	}
+	selected := map[string]bool{}
+	for _, dir := range dirs {
+		var names []string
+		for _, member := range groups[dir] {
+			names = append(names, member.Name)
+		}
+		if !m.from.IsZero() || !m.to.IsZero() {
+			names = filterFilesByTime(names, m.from, m.to)
+		} else if m.latest > 0 && m.latest < len(names) {
+			names = names[len(names)-m.latest:]
+		}
+		for _, name := range names {
+			selected[name] = true
+		}
+	}
+
+	diag := NewDiagnosticData()
+	diag.SetPreserveValues(m.preserveValues)
+	diag.SetKeepRawValues(m.keepRawValues)
+	diag.SetTimeRange(m.from, m.to)
+	diags, err := diag.decodeArchive(filename, selected)
+	if err != nil {
+		return nil, err
+	} else if len(diags) == 0 {
+		return nil, errors.New("no valid data file found in " + filename)
+	}
+	absname, _ := filepath.Abs(filename)
+	label := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)), ".tar")
+	var inputs []InputFile
+	for _, dir := range dirs {
+		diag, ok := diags[dir]
+		if !ok {
+			continue
+		}
+		hostDir := filepath.Join(absname, filepath.FromSlash(dir))
+		host := m.getUniqueHostLabel(diag, path.Join(label, dir), hostDir)
+		log.Println("loaded", host, "from", filename, dir)
+		m.AddHostFTDCDetailStats(host, diag)
+		m.setDirHost(hostDir, host)
+		for _, member := range groups[dir] {
+			if selected[member.Name] {
+				inputs = append(inputs, InputFile{Host: host, Dir: hostDir, Name: path.Base(member.Name),
+					Size: member.Size, ModTime: member.ModTime})
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// decodeArchive decodes selected members of an archive in a single pass, it returns
+// decoded data by directory of members. Members are streamed, a chunk at a time, instead
+// of being read into memory.
+func (d *DiagnosticData) decodeArchive(filename string, selected map[string]bool) (map[string]*DiagnosticData, error) {
+	btime := time.Now()
+	results := map[string][]diagnosticResult{}
+	err := WalkArchive(filename, func(member ArchiveMember, r io.Reader) error {
+		if !selected[member.Name] {
+			return nil
+		}
+		dir := path.Dir(member.Name)
+		results[dir] = append(results[dir], diagnosticResult{filename: member.Name, data: d.readDiagnosticStream(member.Name, r)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	diags := map[string]*DiagnosticData{}
+	for dir, list := range results {
+		diag := NewDiagnosticData()
+		diag.SetPreserveValues(d.preserveValues)
+		diag.SetKeepRawValues(d.keepRawValues)
+		diag.SetTimeRange(d.from, d.to)
+		diag.mergeResults(list)
+		diag.summarize()
+		diags[dir] = diag
+	}
+	log.Println(len(selected), "files loaded from", filename, ", time spent:", time.Since(btime))
+	return diags, nil
+}
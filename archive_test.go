@@ -0,0 +1,164 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// archive_test.go
+
+package ftdc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestArchive archives files of a directory with paths relative to the directory
+func writeTestArchive(t *testing.T, archive string, dir string) {
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var zw *zip.Writer
+	var gw *gzip.Writer
+	var tw *tar.Writer
+	if strings.HasSuffix(archive, ".zip") {
+		zw = zip.NewWriter(file)
+		defer zw.Close()
+	} else {
+		gw = gzip.NewWriter(file)
+		defer gw.Close()
+		tw = tar.NewWriter(gw)
+		defer tw.Close()
+	}
+	err = filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, _ := filepath.Rel(dir, filename)
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		var w io.Writer
+		if zw != nil {
+			if w, err = zw.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(name), Method: zip.Deflate, Modified: info.ModTime()}); err != nil {
+				return err
+			}
+		} else {
+			if err = tw.WriteHeader(&tar.Header{Name: filepath.ToSlash(name), Mode: 0644, Size: int64(len(data)), ModTime: info.ModTime(), Typeflag: tar.TypeReg}); err != nil {
+				return err
+			}
+			w = tw
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getTestBundle writes an archive of two hosts, shard01-a and node2 without hostInfo
+func getTestBundle(t *testing.T, ext string) string {
+	dir := t.TempDir()
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	src := filepath.Join(dir, "src")
+	writeTestFile(t, filepath.Join(src, "bundle/shard01-a/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000"), "shard01-a", start, 100)
+	writeTestFile(t, filepath.Join(src, "bundle/node2/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000"), "", start, 50)
+	writeTestFile(t, filepath.Join(src, "bundle/node2/diagnostic.data/metrics.2020-05-13T14-22-19Z-00000"), "", start.Add(100*time.Second), 50)
+	os.WriteFile(filepath.Join(src, "bundle/__MACOSX/._metrics.2020-05-13T14-20-19Z-00000"), []byte("resource fork"), 0644)
+	archive := filepath.Join(dir, "bundle"+ext)
+	writeTestArchive(t, archive, src)
+	return archive
+}
+
+func TestIsArchiveFile(t *testing.T) {
+	for name, expected := range map[string]bool{"diag.tar.gz": true, "diag.TGZ": true, "diag.zip": true,
+		"metrics.2020-05-13T14-20-19Z-00000": false, "diagnostic.data": false, "diag.gz": false} {
+		if IsArchiveFile(name) != expected {
+			t.Fatalf("expected %v of %v", expected, name)
+		}
+	}
+}
+
+func TestGetArchiveMembers(t *testing.T) {
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		members, err := GetArchiveMembers(getTestBundle(t, ext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 3 || members[0].Name != "bundle/node2/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000" ||
+			members[2].Name != "bundle/shard01-a/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000" {
+			t.Fatalf("unexpected members of %v %v", ext, members)
+		}
+		if members[0].Size == 0 || members[0].ModTime.IsZero() {
+			t.Fatalf("expected size and modified time of %v", members[0])
+		}
+	}
+}
+
+func TestProcessArchive(t *testing.T) {
+	for _, ext := range []string{".tgz", ".zip"} {
+		archive := getTestBundle(t, ext)
+		m := &Metrics{}
+		if err := m.ProcessFiles([]string{archive}); err != nil {
+			t.Fatal(err)
+		}
+		hosts := m.GetHosts()
+		if len(hosts) != 2 || hosts[0] != "node2" || hosts[1] != "shard01-a" {
+			t.Fatalf("unexpected hosts of %v %v", ext, hosts)
+		}
+		if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 98 {
+			t.Fatalf("expected 98 samples of node2, got %d", n)
+		}
+		inputs := m.GetInputFiles()
+		if len(inputs) != 3 || inputs[0].Host != "node2" || inputs[0].Dir != filepath.Join(archive, "bundle/node2/diagnostic.data") {
+			t.Fatalf("unexpected inputs %v", inputs)
+		}
+		if host, ok := m.getDirHost(filepath.Join(archive, "bundle/shard01-a/diagnostic.data")); !ok || host != "shard01-a" {
+			t.Fatalf("expected shard01-a, got %v", host)
+		}
+	}
+}
+
+func TestProcessArchiveLatest(t *testing.T) {
+	m := &Metrics{}
+	m.SetLatest(1)
+	if err := m.ProcessFiles([]string{getTestBundle(t, ".tar.gz")}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(m.GetInputFiles()); n != 2 {
+		t.Fatalf("expected the latest file of each host, got %d", n)
+	}
+}
+
+func TestReadDirectoryArchive(t *testing.T) {
+	m := &Metrics{}
+	body, _ := json.Marshal(directoryReq{Dir: getTestBundle(t, ".zip")})
+	w := httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/dir", bytes.NewReader(body)))
+	if !strings.Contains(w.Body.String(), `"ok":1`) {
+		t.Fatalf("unexpected response %v", w.Body.String())
+	}
+	if hosts := m.GetHosts(); len(hosts) != 2 {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+
+	m = &Metrics{}
+	archive := filepath.Join(t.TempDir(), "empty.tar.gz")
+	writeTestArchive(t, archive, t.TempDir())
+	body, _ = json.Marshal(directoryReq{Dir: archive})
+	w = httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/dir", bytes.NewReader(body)))
+	if !strings.Contains(w.Body.String(), "no metrics file found") {
+		t.Fatalf("unexpected response %v", w.Body.String())
+	}
+}
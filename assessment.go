@@ -18,7 +18,7 @@ type ScoreFormula struct {
 	high    int
 }
 
-// FormulaMap holds low and high watermarks
+// FormulaMap holds low and high watermarks, read only, use a ScoringProfile to change them
 var FormulaMap = map[string]ScoreFormula{
 	"conns_created/s":       {label: "conns_created/s", formula: "conns_created/s", low: 0, high: 5},
 	"conns_current":         {label: "conns_current %%", formula: "1MB*(p95 of conns_current)/RAM", low: 5, high: 20},
@@ -73,6 +73,7 @@ var FormulaMap = map[string]ScoreFormula{
 type Assessment struct {
 	blocks        int
 	maxCachePages int
+	profile       *ScoringProfile
 	stats         FTDCStats
 	verbose       bool
 }
@@ -88,19 +89,27 @@ type metricStats struct {
 // NewAssessment returns assessment object
 func NewAssessment(stats FTDCStats) *Assessment {
 	assessment := Assessment{blocks: 1, stats: stats}
-	cores := stats.ServerInfo.HostInfo.System.NumCores
-	m := FormulaMap["queued_read"]
-	m.low = cores
-	m.high = 5 * cores
-	FormulaMap["queued_read"] = m
-	m = FormulaMap["queued_write"]
-	m.low = cores
-	m.high = 5 * cores
-	FormulaMap["queued_write"] = m
 	assessment.maxCachePages = int(.05 * float64(stats.MaxWTCache) * (1024 * 1024 * 1024) / (4 * 1024)) // 5% of WiredTiger cache
 	return &assessment
 }
 
+// SetScoringProfile sets watermarks of scores, nil is FormulaMap
+func (as *Assessment) SetScoringProfile(profile *ScoringProfile) {
+	as.profile = profile
+}
+
+// getWatermark returns low and high watermarks of a FormulaMap key. Queues default to
+// number of cores and 5 times of it.
+func (as *Assessment) getWatermark(key string) (float64, float64) {
+	if wm, ok := as.profile.getWatermark(key); ok {
+		return wm.Low, wm.High
+	}
+	if cores := as.stats.ServerInfo.HostInfo.System.NumCores; cores > 0 && (key == "queued_read" || key == "queued_write") {
+		return float64(cores), float64(5 * cores)
+	}
+	return float64(FormulaMap[key].low), float64(FormulaMap[key].high)
+}
+
 // SetVerbose sets verbose level
 func (as *Assessment) SetVerbose(verbose bool) {
 	as.verbose = verbose
@@ -138,9 +147,9 @@ func (as *Assessment) GetAssessment(from time.Time, to time.Time) map[string]int
 			}
 		}
 		// tcmalloc fragmentation assessment
-		if heap, ok := as.stats.TimeSeriesData["tcmalloc_heap"]; ok && len(heap.DataPoints) > 0 {
+		if heap, ok := as.stats.TimeSeriesData["tcmalloc_heap"]; ok && heap.Len() > 0 {
 			inUse := as.stats.TimeSeriesData["tcmalloc_in_use"]
-			if len(inUse.DataPoints) > 0 {
+			if inUse.Len() > 0 {
 				m := as.getTcmallocFragmentation(from, to)
 				if m.score < 101 || as.verbose {
 					marr = append(marr, m)
@@ -213,17 +222,15 @@ func (as *Assessment) getStatsArrayByValues(metric string, p5 float64, median fl
 	}
 	if as.stats.MaxWTCache > 0 && (metric == "wt_cache_used" || metric == "wt_cache_dirty") {
 		u := 100 * p95 / float64(as.stats.MaxWTCache)
-		if metric == "wt_cache_used" { // 80% to 100%
-			score = GetScoreByRange(u, 80, 95)
-		} else if metric == "wt_cache_dirty" { // 5% to 20%
-			score = GetScoreByRange(u, 5, 20)
-		}
+		lwm, hwm := as.getWatermark(metric) // 80% to 95% used, 5% to 20% dirty
+		score = GetScoreByRange(u, lwm, hwm)
 		return metricStats{label: label + " %", score: score, p5: math.Round(100 * p5 / float64(as.stats.MaxWTCache)),
 			median: math.Round(100 * median / float64(as.stats.MaxWTCache)), p95: math.Round(100 * p95 / float64(as.stats.MaxWTCache))}
 	} else if as.stats.ServerInfo.HostInfo.System.MemSizeMB > 0 && metric == "mem_resident" {
 		total := float64(as.stats.ServerInfo.HostInfo.System.MemSizeMB) / 1024
 		u := 100 * p95 / total
-		score = GetScoreByRange(u, 70, 90)
+		lwm, hwm := as.getWatermark(metric)
+		score = GetScoreByRange(u, lwm, hwm)
 		return metricStats{label: label + " %", score: score, p5: math.Round(100 * p5 / total),
 			median: math.Round(100 * median / total), p95: math.Round(100 * p95 / total)}
 	}
@@ -241,18 +248,18 @@ func (as *Assessment) getTcmallocFragmentation(from time.Time, to time.Time) met
 	inUse := as.stats.TimeSeriesData["tcmalloc_in_use"]
 	heapStats := FilterTimeSeriesData(heap, from, to)
 	inUseStats := FilterTimeSeriesData(inUse, from, to)
-	if len(heapStats.DataPoints) == 0 || len(inUseStats.DataPoints) == 0 {
+	if heapStats.Len() == 0 || inUseStats.Len() == 0 {
 		return metricStats{label: "tcmalloc_frag %", score: 101}
 	}
 	// Calculate fragmentation ratio for each data point
 	ratios := []float64{}
-	minLen := len(heapStats.DataPoints)
-	if len(inUseStats.DataPoints) < minLen {
-		minLen = len(inUseStats.DataPoints)
+	minLen := heapStats.Len()
+	if inUseStats.Len() < minLen {
+		minLen = inUseStats.Len()
 	}
 	for i := 0; i < minLen; i++ {
-		h := heapStats.DataPoints[i][0]
-		u := inUseStats.DataPoints[i][0]
+		h := heapStats.Values[i]
+		u := inUseStats.Values[i]
 		if h > 0 {
 			frag := 100 * (h - u) / h
 			ratios = append(ratios, frag)
@@ -277,19 +284,17 @@ func (as *Assessment) getTcmallocFragmentation(from time.Time, to time.Time) met
 		p95Idx = end
 	}
 	p5, median, p95 := ratios[p5Idx], ratios[medianIdx], ratios[p95Idx]
-	score := GetScoreByRange(p95, 20, 50) // 20% fragmentation is okay, 50% is bad
+	lwm, hwm := as.getWatermark("tcmalloc_fragmentation")
+	score := GetScoreByRange(p95, lwm, hwm) // 20% fragmentation is okay, 50% is bad
 	return metricStats{label: "tcmalloc_frag %", score: score, p5: math.Round(p5), median: math.Round(median), p95: math.Round(p95)}
 }
 
 func (as *Assessment) getStatsByData(data TimeSeriesDoc, from time.Time, to time.Time) (float64, float64, float64) {
 	stats := FilterTimeSeriesData(data, from, to)
-	if len(stats.DataPoints) == 0 {
+	if stats.Len() == 0 {
 		return 0, 0, 0
 	}
-	arr := []float64{}
-	for _, dp := range stats.DataPoints {
-		arr = append(arr, dp[0])
-	}
+	arr := append([]float64{}, stats.Values...) // columns may be shared, sort a copy
 	sort.Slice(arr, func(i int, j int) bool {
 		return arr[i] < arr[j]
 	})
@@ -328,8 +333,7 @@ func (as *Assessment) getScore(metric string, p5 float64, median float64, p95 fl
 	if FormulaMap[met].label == "" {
 		return score
 	}
-	lwm := float64(FormulaMap[met].low)
-	hwm := float64(FormulaMap[met].high)
+	lwm, hwm := as.getWatermark(met)
 	if metric == "conns_created/s" { // 300 conns created per minute, 5/second
 		score = GetScoreByRange(median, lwm, hwm)
 	} else if metric == "conns_current" { // 5% to 20%
@@ -361,7 +365,7 @@ func (as *Assessment) getScore(metric string, p5 float64, median float64, p95 fl
 	} else if strings.HasPrefix(metric, "q_queued_") {
 		score = GetScoreByRange(p95, lwm, hwm)
 	} else if metric == "scan_keys" { // 1 mil/sec key scanned
-		score = GetScoreByRange(p95, 0, 1024.0*1024)
+		score = GetScoreByRange(p95, lwm, hwm)
 	} else if metric == "scan_objects" {
 		if p95 < 1000 {
 			return 100
@@ -371,9 +375,9 @@ func (as *Assessment) getScore(metric string, p5 float64, median float64, p95 fl
 		// Calculate average ratio of scan_objects/scan_keys
 		sum := 0.0
 		count := 0
-		for i := range keys.DataPoints {
-			if keys.DataPoints[i][0] > 0 { // avoid division by zero
-				sum += objs.DataPoints[i][0] / keys.DataPoints[i][0]
+		for i := range keys.Values {
+			if keys.Values[i] > 0 { // avoid division by zero
+				sum += objs.Values[i] / keys.Values[i]
 				count++
 			}
 		}
@@ -404,9 +408,9 @@ func (as *Assessment) getScore(metric string, p5 float64, median float64, p95 fl
 		// MongoDB 7.0+ Admission Control: % of tickets in use
 		// Need to calculate as percentage of total tickets
 		totalMetric := strings.Replace(metric, "_out", "_total", 1)
-		if total, ok := as.stats.TimeSeriesData[totalMetric]; ok && len(total.DataPoints) > 0 {
+		if total, ok := as.stats.TimeSeriesData[totalMetric]; ok && total.Len() > 0 {
 			// Use first total value as reference (usually constant)
-			totalTickets := total.DataPoints[0][0]
+			totalTickets := total.Values[0]
 			if totalTickets > 0 {
 				pct := 100 * p95 / totalTickets
 				score = GetScoreByRange(pct, lwm, hwm)
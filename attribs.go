@@ -16,7 +16,9 @@ const diskMetricsPrefix = "systemMetrics/disks/"
 // Attribs stores attribs map
 type Attribs struct {
 	attribsMap *map[string][]uint64
-	diskKeys   []diskKeyInfo // cached disk keys for efficient iteration
+	diskKeys   []diskKeyInfo        // cached disk keys for efficient iteration
+	floatsMap  map[string][]float64 // float metrics, if values are preserved
+	stringsMap map[string]string    // strings of the reference document, if values are preserved
 }
 
 // diskKeyInfo stores pre-parsed disk key information
@@ -48,9 +50,20 @@ func NewAttribs(attribsMap *map[string][]uint64) *Attribs {
 	return attr
 }
 
+// NewAttribsFromMetricsData returns Attribs of a decoded chunk, including preserved values
+func NewAttribsFromMetricsData(v *decoder.MetricsData) *Attribs {
+	attr := NewAttribs(&v.DataPointsMap)
+	attr.floatsMap = v.FloatPointsMap
+	attr.stringsMap = v.Strings
+	return attr
+}
+
 // GetServerStatusDataPoints returns server status
 func (attr *Attribs) GetServerStatusDataPoints(i int) ServerStatusDoc {
 	ss := ServerStatusDoc{}
+	ss.Host = attr.GetString("serverStatus/host")
+	ss.Process = attr.GetString("serverStatus/process")
+	ss.Version = attr.GetString("serverStatus/version")
 	ss.LocalTime = time.Unix(0, int64(time.Millisecond)*int64(attr.get("serverStatus/localTime", i)))
 	ss.Mem.Resident = attr.get("serverStatus/mem/resident", i)
 	ss.Mem.Virtual = attr.get("serverStatus/mem/virtual", i)
@@ -172,6 +185,19 @@ func (attr *Attribs) GetSystemMetricsDataPoints(i int) SystemMetricsDoc {
 	return sm
 }
 
+// GetFloat returns a float value, preserved float values take precedence
+func (attr *Attribs) GetFloat(key string, i int) float64 {
+	if arr, ok := attr.floatsMap[key]; ok && i < len(arr) {
+		return arr[i]
+	}
+	return float64(attr.get(key, i))
+}
+
+// GetString returns a string value of the reference document
+func (attr *Attribs) GetString(key string) string {
+	return attr.stringsMap[key]
+}
+
 func (attr *Attribs) get(key string, i int) uint64 {
 	arr := (*attr.attribsMap)[key]
 	if i < len(arr) && !math.IsNaN(float64(arr[i])) {
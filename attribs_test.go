@@ -37,3 +37,19 @@ func TestGetSystemMetricsDataPoints(t *testing.T) {
 	v := attrib.GetSystemMetricsDataPoints(0)
 	t.Log(v)
 }
+
+func TestNewAttribsFromMetricsData(t *testing.T) {
+	md := decoder.MetricsData{
+		DataPointsMap:  map[string][]uint64{"serverStatus/uptime": {100, 101}},
+		FloatPointsMap: map[string][]float64{"serverStatus/uptime": {100.5, 101.5}},
+		Strings:        map[string]string{"serverStatus/process": "mongod", "serverStatus/version": "7.0.2"},
+	}
+	attrib := NewAttribsFromMetricsData(&md)
+	ss := attrib.GetServerStatusDataPoints(1)
+	if ss.Process != "mongod" || ss.Version != "7.0.2" || ss.Uptime != 101 {
+		t.Fatalf("unexpected server status %v %v %v", ss.Process, ss.Version, ss.Uptime)
+	}
+	if attrib.GetFloat("serverStatus/uptime", 1) != 101.5 {
+		t.Fatalf("expected 101.5, got %v", attrib.GetFloat("serverStatus/uptime", 1))
+	}
+}
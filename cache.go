@@ -0,0 +1,190 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// cache.go
+
+package ftdc
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CacheVersion is the version of the cache file format, caches of other versions are ignored
+const CacheVersion = 4
+
+// FTDCCache stores processed FTDC stats of hosts
+type FTDCCache struct {
+	Version        int
+	From           time.Time // time range of samples, zero is unbounded
+	Hosts          []CacheHost
+	KeepRawValues  bool
+	Latest         int // latest n files, zero is all files
+	PreserveValues bool
+	To             time.Time
+}
+
+// CacheHost stores processed stats of a directory and the files decoded
+type CacheHost struct {
+	Dir   string // absolute path
+	Files []CacheFile
+	Host  string
+	Stats FTDCStats
+}
+
+// CacheFile identifies a decoded file
+type CacheFile struct {
+	Name    string // base name
+	ModTime time.Time
+	Size    int64
+}
+
+// registerCacheTypes registers types of interface{} values, e.g. optime of replSetGetStatus members
+func registerCacheTypes() {
+	gob.Register(primitive.A{})
+	gob.Register(primitive.D{})
+	gob.Register(primitive.DateTime(1))
+	gob.Register(primitive.M{})
+	gob.Register(primitive.Timestamp{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// NewFTDCCache returns *FTDCCache
+func NewFTDCCache(preserveValues bool, keepRawValues bool) *FTDCCache {
+	return &FTDCCache{Version: CacheVersion, KeepRawValues: keepRawValues, PreserveValues: preserveValues}
+}
+
+// ReadCache reads a gzipped gob cache file
+func ReadCache(filename string) (*FTDCCache, error) {
+	registerCacheTypes()
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gox.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	var cache FTDCCache
+	if err = gob.NewDecoder(reader).Decode(&cache); err != nil {
+		return nil, err
+	}
+	if cache.Version != CacheVersion {
+		return nil, fmt.Errorf("cache version %v, expected %v", cache.Version, CacheVersion)
+	}
+	return &cache, nil
+}
+
+// Write writes the cache to a temporary file and renames it
+func (c *FTDCCache) Write(filename string) error {
+	registerCacheTypes()
+	tmpfile := filename + ".tmp"
+	file, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(file)
+	if err = gob.NewEncoder(zw).Encode(c); err == nil {
+		err = zw.Close()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return os.Rename(tmpfile, filename)
+}
+
+// getHost returns cached stats of a directory if it was processed with the same options
+func (c *FTDCCache) getHost(dir string, options *FTDCCache) *CacheHost {
+	if c == nil || c.PreserveValues != options.PreserveValues || c.KeepRawValues != options.KeepRawValues ||
+		c.Latest != options.Latest || !c.From.Equal(options.From) || !c.To.Equal(options.To) {
+		return nil
+	}
+	for i, ch := range c.Hosts {
+		if ch.Dir == dir {
+			return &c.Hosts[i]
+		}
+	}
+	return nil
+}
+
+// getCacheFiles returns names, sizes and mtimes of files
+func getCacheFiles(filenames []string) ([]CacheFile, error) {
+	var files []CacheFile
+	for _, filename := range filenames {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, CacheFile{Name: filepath.Base(filename), ModTime: fi.ModTime(), Size: fi.Size()})
+	}
+	return files, nil
+}
+
+// getFilesToDecode returns files newer than the cache. The last cached metrics file and
+// metrics.interim are decoded again if they changed; other changes, older files not cached
+// and cached files removed since, e.g. rotated by mongod or beyond -latest, invalidate the
+// cache, so that cached stats are of the files on disk only.
+func (ch *CacheHost) getFilesToDecode(files []CacheFile) ([]CacheFile, error) {
+	cached := map[string]CacheFile{}
+	var last string
+	for _, f := range ch.Files {
+		cached[f.Name] = f
+		if !isInterimFile(f.Name) && f.Name > last {
+			last = f.Name
+		}
+	}
+	names := map[string]bool{}
+	for _, f := range files {
+		names[f.Name] = true
+	}
+	for _, f := range ch.Files {
+		if !names[f.Name] && !isInterimFile(f.Name) {
+			return nil, errors.New(f.Name + " removed since cached")
+		}
+	}
+	var list []CacheFile
+	for _, f := range files {
+		prev, ok := cached[f.Name]
+		if !ok && f.Name < last {
+			return nil, errors.New(f.Name + " not cached")
+		} else if ok && prev.Size == f.Size && prev.ModTime.Equal(f.ModTime) {
+			continue
+		} else if ok && f.Name != last && !isInterimFile(f.Name) {
+			return nil, errors.New(f.Name + " changed since cached")
+		}
+		list = append(list, f)
+	}
+	return list, nil
+}
+
+// addFiles records decoded files, replacing previous entries of the same names
+func (ch *CacheHost) addFiles(files []CacheFile) {
+	names := map[string]int{}
+	for i, f := range ch.Files {
+		names[f.Name] = i
+	}
+	for _, f := range files {
+		if i, ok := names[f.Name]; ok {
+			ch.Files[i] = f
+		} else {
+			ch.Files = append(ch.Files, f)
+		}
+	}
+}
+
+func isInterimFile(name string) bool {
+	return strings.HasSuffix(name, ".interim")
+}
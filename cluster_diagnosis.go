@@ -0,0 +1,397 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// cluster_diagnosis.go
+
+package ftdc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ClusterFinding is a cross-node finding
+type ClusterFinding struct {
+	Category  string // "election", "state", "lag", "outlier"
+	Severity  string // "critical", "warning", "info"
+	Host      string
+	Timestamp time.Time
+	Message   string
+}
+
+// ClusterDiagnosis correlates FTDC data of replica set members
+type ClusterDiagnosis struct {
+	hosts    []string
+	stats    map[string]FTDCStats
+	from     time.Time // aligned timeline, overlapping period of all hosts
+	to       time.Time
+	findings []ClusterFinding
+}
+
+// clusterChange is a change seen by a host, the same change of other hosts has the same key
+type clusterChange struct {
+	finding ClusterFinding
+	key     string
+	term    int64 // of the new primary, 0 if not available
+}
+
+// memberLag is replication lag of a member at a point in time
+type memberLag struct {
+	date time.Time
+	lag  float64 // seconds
+}
+
+const clusterDirtyCachePct = 5.0             // wt_cache_dirty as % of max cache, eviction dirty target
+const clusterLagSeconds = 5.0                // same as replication lag anomalies
+const clusterOutlierRatio = 2.0              // value vs peers median
+const clusterOutlierMinDelta = 20.0          // percentage points
+const clusterChangeWindow = 10 * time.Minute // of the same change seen by hosts without terms
+
+// NewClusterDiagnosis returns *ClusterDiagnosis of FTDC stats by host
+func NewClusterDiagnosis(stats map[string]FTDCStats) *ClusterDiagnosis {
+	cd := &ClusterDiagnosis{stats: stats}
+	for host := range stats {
+		cd.hosts = append(cd.hosts, host)
+	}
+	sort.Strings(cd.hosts)
+	cd.alignTimeline()
+	return cd
+}
+
+// GetTimeRange returns the aligned timeline
+func (cd *ClusterDiagnosis) GetTimeRange() (time.Time, time.Time) { return cd.from, cd.to }
+
+// GetFindings returns findings
+func (cd *ClusterDiagnosis) GetFindings() []ClusterFinding { return cd.findings }
+
+// alignTimeline finds the period covered by all hosts, or by any host if they don't overlap
+func (cd *ClusterDiagnosis) alignTimeline() {
+	var first, last []time.Time
+	for _, host := range cd.hosts {
+		from, to, ok := getServerStatusTimeRange(cd.stats[host].ServerStatusColumns, cd.stats[host].ServerStatusList)
+		if !ok {
+			continue
+		}
+		first = append(first, from)
+		last = append(last, to)
+	}
+	if len(first) == 0 {
+		return
+	}
+	sort.Slice(first, func(i, j int) bool { return first[i].Before(first[j]) })
+	sort.Slice(last, func(i, j int) bool { return last[i].Before(last[j]) })
+	cd.from, cd.to = first[len(first)-1], last[0]
+	if !cd.from.Before(cd.to) { // no overlap
+		cd.from, cd.to = first[0], last[len(last)-1]
+	}
+}
+
+// Run correlates elections, replication lags and resources of all hosts
+func (cd *ClusterDiagnosis) Run() []ClusterFinding {
+	cd.findings = []ClusterFinding{}
+	statusList := cd.getReplSetStatusList(cd.hosts)
+	cd.findElections()
+	cd.findLagsOnDirtyCache(statusList)
+	cd.findOutliers()
+	sort.SliceStable(cd.findings, func(i, j int) bool {
+		return cd.findings[i].Timestamp.Before(cd.findings[j].Timestamp)
+	})
+	return cd.findings
+}
+
+// getReplSetStatusList merges replSetGetStatus of hosts by date
+func (cd *ClusterDiagnosis) getReplSetStatusList(hosts []string) []ReplSetStatusDoc {
+	var list []ReplSetStatusDoc
+	for _, host := range hosts {
+		for _, doc := range cd.stats[host].ReplSetStatusList {
+			if len(doc.Members) > 0 && !doc.Date.IsZero() {
+				list = append(list, doc)
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Date.Before(list[j].Date) })
+	return list
+}
+
+// findElections reports primary changes and member state changes. Changes are detected in
+// the view of each host; hosts see a change at slightly different times, and it's reported
+// once at the earliest time.
+func (cd *ClusterDiagnosis) findElections() {
+	var changes []clusterChange
+	for _, host := range cd.hosts {
+		var primary string
+		states := map[string]int{}
+		for _, doc := range cd.getReplSetStatusList([]string{host}) {
+			current := getPrimaryName(doc)
+			if current != "" && primary != "" && current != primary {
+				term := getPrimaryTerm(doc)
+				key := fmt.Sprintf("election %v %v", primary, current)
+				if term > 0 {
+					key = fmt.Sprintf("election %v term %d", current, term)
+				}
+				changes = append(changes, clusterChange{key: key, term: term, finding: ClusterFinding{
+					Category: "election", Severity: "warning", Host: current, Timestamp: doc.Date,
+					Message: fmt.Sprintf("election, primary changed from %v to %v", primary, current)}})
+			}
+			if current != "" {
+				primary = current
+			}
+			for _, mb := range doc.Members {
+				if state, ok := states[mb.Name]; ok && state != mb.State && mb.State != 1 && state != 1 {
+					changes = append(changes, clusterChange{key: fmt.Sprintf("state %v %d %d", mb.Name, state, mb.State), finding: ClusterFinding{
+						Category: "state", Severity: "info", Host: mb.Name, Timestamp: doc.Date,
+						Message: fmt.Sprintf("%v changed state from %v to %v", mb.Name, GetMemberStateName(state), GetMemberStateName(mb.State))}})
+				}
+				states[mb.Name] = mb.State
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].finding.Timestamp.Before(changes[j].finding.Timestamp) })
+	seen := map[string]time.Time{}
+	for _, c := range changes {
+		if t, ok := seen[c.key]; ok && (c.term > 0 || c.finding.Timestamp.Sub(t) <= clusterChangeWindow) {
+			continue
+		}
+		seen[c.key] = c.finding.Timestamp
+		cd.findings = append(cd.findings, c.finding)
+	}
+}
+
+// findLagsOnDirtyCache reports secondaries lagged while dirty cache of the primary spiked
+func (cd *ClusterDiagnosis) findLagsOnDirtyCache(statusList []ReplSetStatusDoc) {
+	lags := getMemberLags(statusList)
+	for _, host := range cd.hosts {
+		stats := cd.stats[host]
+		if stats.MaxWTCache <= 0 {
+			continue
+		}
+		dirty := stats.TimeSeriesData["wt_cache_dirty"]
+		threshold := stats.MaxWTCache * clusterDirtyCachePct / 100
+		for _, r := range findTimeRanges(dirty, threshold, cd.from, cd.to) {
+			primary := getPrimaryNameAt(statusList, r.Start)
+			if primary == "" || !isSameHost(host, primary) {
+				continue
+			}
+			// replSetGetStatus is collected once per chunk, look ahead for a chunk
+			end := r.End.Add(5 * time.Minute)
+			for _, name := range sortedKeys(lags) {
+				peak := 0.0
+				for _, ml := range lags[name] {
+					if !ml.date.Before(r.Start) && !ml.date.After(end) && ml.lag > peak {
+						peak = ml.lag
+					}
+				}
+				if peak > clusterLagSeconds {
+					cd.findings = append(cd.findings, ClusterFinding{Category: "lag", Severity: "critical",
+						Host: name, Timestamp: r.Start,
+						Message: fmt.Sprintf("%v lagged up to %.0fs while wt_cache_dirty of primary %v peaked at %.1f%% (%s)",
+							name, peak, host, 100*r.Peak/stats.MaxWTCache, r.End.Sub(r.Start).Round(time.Second))})
+				}
+			}
+		}
+	}
+}
+
+// findOutliers reports hosts of which CPU or disk utilization differs from their peers
+func (cd *ClusterDiagnosis) findOutliers() {
+	if len(cd.hosts) < 2 {
+		return
+	}
+	cpu := map[string]float64{}
+	disk := map[string]float64{}
+	for _, host := range cd.hosts {
+		stats := cd.stats[host]
+		as := NewAssessment(stats)
+		_, user, _ := as.getStatsByData(stats.TimeSeriesData["cpu_user"], cd.from, cd.to)
+		_, system, _ := as.getStatsByData(stats.TimeSeriesData["cpu_system"], cd.from, cd.to)
+		cpu[host] = user + system
+		for _, ds := range stats.DiskStats {
+			_, _, p95 := as.getStatsByData(ds.Utilization, cd.from, cd.to)
+			disk[host] = math.Max(disk[host], p95)
+		}
+	}
+	cd.addOutliers("CPU median", cpu)
+	cd.addOutliers("disk utilization p95", disk)
+}
+
+func (cd *ClusterDiagnosis) addOutliers(label string, values map[string]float64) {
+	for _, host := range cd.hosts {
+		var peers []float64
+		for _, peer := range cd.hosts {
+			if peer != host {
+				peers = append(peers, values[peer])
+			}
+		}
+		median := getMedian(peers)
+		v := values[host]
+		if v-median >= clusterOutlierMinDelta && v >= clusterOutlierRatio*median {
+			cd.findings = append(cd.findings, ClusterFinding{Category: "outlier", Severity: "warning",
+				Host: host, Timestamp: cd.from,
+				Message: fmt.Sprintf("%v %v is %.0f%%, peers median is %.0f%%", host, label, v, median)})
+		}
+	}
+}
+
+// PrintReport outputs cluster findings to stdout
+func (cd *ClusterDiagnosis) PrintReport() {
+	fmt.Println()
+	fmt.Println("╔══════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                         FTDC CLUSTER REPORT                                  ║")
+	fmt.Println("╚══════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+	fmt.Printf("📅 Aligned Period: %s to %s\n", cd.from.Format("2006-01-02 15:04:05"), cd.to.Format("2006-01-02 15:04:05"))
+	fmt.Printf("🖥  Hosts: %s\n", strings.Join(cd.hosts, ", "))
+	fmt.Println()
+	if len(cd.findings) == 0 {
+		fmt.Println("✅ No cross-node issues detected!")
+		fmt.Println()
+		return
+	}
+	for _, f := range cd.findings {
+		severityIcon := map[string]string{"critical": "🔴", "warning": "🟡", "info": "🔵"}[f.Severity]
+		fmt.Printf("   %s %s  %-9s %s\n", severityIcon, f.Timestamp.Format("Jan 02 15:04:05"), f.Category, f.Message)
+	}
+	fmt.Println()
+}
+
+// getMemberLags returns replication lags of secondaries by member name
+func getMemberLags(statusList []ReplSetStatusDoc) map[string][]memberLag {
+	lags := map[string][]memberLag{}
+	for _, doc := range statusList {
+		var ts int64
+		for _, mb := range doc.Members {
+			if mb.State == 1 {
+				ts = GetOptime(mb.Optime)
+				break
+			}
+		}
+		if ts == 0 {
+			continue
+		}
+		for _, mb := range doc.Members {
+			if mb.State == 2 { // SECONDARY
+				lags[mb.Name] = append(lags[mb.Name], memberLag{date: doc.Date, lag: float64(ts - GetOptime(mb.Optime))})
+			}
+		}
+	}
+	return lags
+}
+
+// getPrimaryName returns name of the primary member
+func getPrimaryName(doc ReplSetStatusDoc) string {
+	for _, mb := range doc.Members {
+		if mb.State == 1 {
+			return mb.Name
+		}
+	}
+	return ""
+}
+
+// getPrimaryTerm returns term of the primary optime, 0 if not available
+func getPrimaryTerm(doc ReplSetStatusDoc) int64 {
+	for _, mb := range doc.Members {
+		if optime, ok := mb.Optime.(primitive.D); ok && mb.State == 1 {
+			for _, elem := range optime {
+				if elem.Key != "t" {
+					continue
+				}
+				switch v := elem.Value.(type) {
+				case int64:
+					return v
+				case int32:
+					return int64(v)
+				case float64:
+					return int64(v)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// getPrimaryNameAt returns the primary as of a point in time
+func getPrimaryNameAt(statusList []ReplSetStatusDoc, t time.Time) string {
+	var primary string
+	for _, doc := range statusList {
+		if doc.Date.After(t) && primary != "" {
+			break
+		}
+		if name := getPrimaryName(doc); name != "" {
+			primary = name
+		}
+	}
+	return primary
+}
+
+// isSameHost returns true if a host label is the host of a member name, e.g. shard01-a and shard01-a.example.net:27017
+func isSameHost(label string, name string) bool {
+	if n := strings.LastIndex(name, ":"); n > 0 {
+		name = name[:n]
+	}
+	if label == name {
+		return true
+	}
+	short := func(s string) string {
+		if n := strings.Index(s, "."); n > 0 {
+			return s[:n]
+		}
+		return s
+	}
+	return short(label) == short(name)
+}
+
+// findTimeRanges returns time ranges above a threshold for at least 10 seconds
+func findTimeRanges(data TimeSeriesDoc, threshold float64, from time.Time, to time.Time) []TimeRange {
+	var ranges []TimeRange
+	var current *TimeRange
+	for i, v := range data.Values {
+		ts := time.Unix(0, int64(data.Times[i])*int64(time.Millisecond))
+		if ts.Before(from) || ts.After(to) {
+			continue
+		}
+		if v > threshold {
+			if current == nil {
+				current = &TimeRange{Start: ts, Peak: v}
+			}
+			current.Peak = math.Max(current.Peak, v)
+			current.End = ts
+		} else if current != nil {
+			ranges = append(ranges, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		ranges = append(ranges, *current)
+	}
+	var significant []TimeRange
+	for _, r := range ranges {
+		if r.End.Sub(r.Start) >= 10*time.Second {
+			significant = append(significant, r)
+		}
+	}
+	return significant
+}
+
+func getMedian(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	arr := append([]float64{}, values...)
+	sort.Float64s(arr)
+	if len(arr)%2 == 1 {
+		return arr[len(arr)/2]
+	}
+	return (arr[len(arr)/2-1] + arr[len(arr)/2]) / 2
+}
+
+func sortedKeys(m map[string][]memberLag) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
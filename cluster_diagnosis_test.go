@@ -0,0 +1,117 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// cluster_diagnosis_test.go
+
+package ftdc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getTestClusterStats(host string, start time.Time, cpu float64) FTDCStats {
+	stats := newTestStats(start, 600, map[string]func(int) float64{
+		"wt_cache_dirty": func(i int) float64 {
+			if host == "shard01-a" && i >= 100 && i < 160 {
+				return 1.5 // 15% of cache
+			}
+			return 0.1
+		},
+		"cpu_user":   func(int) float64 { return cpu },
+		"cpu_system": func(int) float64 { return 5 },
+	})
+	stats.MaxWTCache = 10
+
+	optime := func(t time.Time) primitive.D {
+		return primitive.D{{Key: "ts", Value: primitive.Timestamp{T: uint32(t.Unix())}}}
+	}
+	for i, primary := range []string{"shard01-a", "shard01-a", "shard01-b"} {
+		tm := start.Add(time.Duration(i*150) * time.Second)
+		lag := time.Duration(0)
+		if i == 1 {
+			lag = 30 * time.Second
+		}
+		doc := ReplSetStatusDoc{Date: tm}
+		for _, name := range []string{"shard01-a", "shard01-b", "shard01-c"} {
+			state := 2
+			if name == primary {
+				state = 1
+			}
+			doc.Members = append(doc.Members, MemberDoc{Name: name + ".example.net:27017", State: state, Optime: optime(tm.Add(-lag))})
+		}
+		for n, mb := range doc.Members {
+			if mb.State == 1 {
+				doc.Members[n].Optime = optime(tm)
+			}
+		}
+		stats.ReplSetStatusList = append(stats.ReplSetStatusList, doc)
+	}
+	return stats
+}
+
+func TestClusterDiagnosis(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	cd := NewClusterDiagnosis(map[string]FTDCStats{
+		"shard01-a": getTestClusterStats("shard01-a", start, 10),
+		"shard01-b": getTestClusterStats("shard01-b", start.Add(10*time.Second), 12),
+		"shard01-c": getTestClusterStats("shard01-c", start.Add(20*time.Second), 70),
+	})
+	from, to := cd.GetTimeRange()
+	if !from.Equal(start.Add(20*time.Second)) || !to.Equal(start.Add(599*time.Second)) {
+		t.Fatalf("unexpected time range %v %v", from, to)
+	}
+	categories := map[string]string{}
+	for _, f := range cd.Run() {
+		categories[f.Category] += f.Message + ";"
+	}
+	if !strings.Contains(categories["election"], "from shard01-a.example.net:27017 to shard01-b.example.net:27017") {
+		t.Fatalf("election not found, %v", categories)
+	}
+	if !strings.Contains(categories["lag"], "shard01-b.example.net:27017 lagged up to 30s") ||
+		!strings.Contains(categories["lag"], "primary shard01-a") {
+		t.Fatalf("lag not found, %v", categories)
+	}
+	if !strings.Contains(categories["outlier"], "shard01-c CPU median is 75%") || strings.Contains(categories["outlier"], "shard01-a") {
+		t.Fatalf("outlier not found, %v", categories)
+	}
+}
+
+func TestClusterDiagnosisElections(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	getStatus := func(tm time.Time, primary string, term int64) ReplSetStatusDoc {
+		doc := ReplSetStatusDoc{Date: tm}
+		for _, name := range []string{"rs-a:27017", "rs-b:27017", "rs-c:27017"} {
+			state := 2
+			if name == primary {
+				state = 1
+			}
+			optime := primitive.D{{Key: "ts", Value: primitive.Timestamp{T: uint32(tm.Unix())}}, {Key: "t", Value: term}}
+			doc.Members = append(doc.Members, MemberDoc{Name: name, State: state, Optime: optime})
+		}
+		return doc
+	}
+	// hosts see the election at different times, rs-b reports the old primary after rs-a saw the new one
+	stats := map[string]FTDCStats{}
+	for host, offset := range map[string]time.Duration{"rs-a": 0, "rs-b": 5 * time.Second, "rs-c": 10 * time.Second} {
+		var list []ReplSetStatusDoc
+		list = append(list, getStatus(start.Add(offset), "rs-a:27017", 1))
+		if host == "rs-b" {
+			list = append(list, getStatus(start.Add(300*time.Second+offset), "rs-a:27017", 1))
+			list = append(list, getStatus(start.Add(600*time.Second+offset), "rs-b:27017", 2))
+		} else {
+			list = append(list, getStatus(start.Add(300*time.Second+offset), "rs-b:27017", 2))
+		}
+		stats[host] = FTDCStats{ReplSetStatusList: list}
+	}
+	var elections []ClusterFinding
+	for _, f := range NewClusterDiagnosis(stats).Run() {
+		if f.Category == "election" {
+			elections = append(elections, f)
+		}
+	}
+	if len(elections) != 1 || elections[0].Host != "rs-b:27017" || !elections[0].Timestamp.Equal(start.Add(300*time.Second)) {
+		t.Fatalf("expected an election, got %v", elections)
+	}
+}
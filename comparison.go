@@ -0,0 +1,590 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// comparison.go
+
+package ftdc
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MetricComparison holds p5/median/p95 of a metric in the baseline and target periods
+type MetricComparison struct {
+	Metric      string
+	Baseline    [3]float64 // p5, median, p95
+	Target      [3]float64
+	DeltaPct    [3]float64 // changes in percentage of baseline, ±Inf if baseline is 0
+	PValue      float64    // two-sided Mann-Whitney U test
+	Significant bool
+	Direction   int // 1: higher is worse, -1: lower is worse, 0: neither
+	Regression  bool
+	Improvement bool
+}
+
+// Comparison compares FTDC metrics of two periods, e.g. before and after an upgrade
+type Comparison struct {
+	baseline   FTDCStats
+	baseFrom   time.Time
+	baseTo     time.Time
+	target     FTDCStats
+	targetFrom time.Time
+	targetTo   time.Time
+	results    []MetricComparison
+}
+
+const comparePValue = 0.01      // significance level of the Mann-Whitney U test
+const compareMinChangePct = 10. // minimum change of median or p95 to be significant
+
+// compareDirections are metrics of which changes are regressions, prefixes end with _
+var compareDirections = map[string]int{
+	"conns_available": -1, "conns_created/s": 1, "cpu_idle": -1, "cpu_iowait": 1, "cpu_softirq": 1,
+	"cpu_steal": 1, "cpu_system": 1, "cpu_user": 1, "disku_": 1, "flowctl_acquiring_us": 1,
+	"flowctl_lagged_count": 1, "flowctl_rate_limit": -1, "latency_": 1, "mem_page_faults": 1,
+	"q_queued_": 1, "query_targeting_": 1, "queues_read_available": -1, "queues_read_out": 1,
+	"queues_write_available": -1, "queues_write_out": 1, "repl_lag_": 1, "ticket_avail_": -1,
+	"txn_aborted/s": 1, "wt_cache_dirty": 1, "wt_modified_evicted": 1, "write_conflicts/s": 1,
+}
+
+// NewComparison returns *Comparison of two FTDC stats, zero times are the whole data
+func NewComparison(baseline FTDCStats, baseFrom, baseTo time.Time, target FTDCStats, targetFrom, targetTo time.Time) *Comparison {
+	c := &Comparison{baseline: baseline, target: target}
+	c.baseFrom, c.baseTo = getStatsTimeRange(baseline, baseFrom, baseTo)
+	c.targetFrom, c.targetTo = getStatsTimeRange(target, targetFrom, targetTo)
+	return c
+}
+
+// NewTimeRangeComparison returns *Comparison of two time ranges of the same FTDC stats
+func NewTimeRangeComparison(stats FTDCStats, baseFrom, baseTo, targetFrom, targetTo time.Time) *Comparison {
+	return NewComparison(stats, baseFrom, baseTo, stats, targetFrom, targetTo)
+}
+
+// Run compares metrics of both periods, results are sorted by regressions, improvements
+// and other significant changes
+func (c *Comparison) Run() []MetricComparison {
+	c.results = nil
+	as := NewAssessment(c.baseline)
+	for _, metric := range getDiagnosisMetrics() {
+		if metric == "replication_lags" {
+			continue
+		}
+		c.compare(as, metric, c.baseline.TimeSeriesData[metric], c.target.TimeSeriesData[metric])
+	}
+	disks := map[string]bool{}
+	for _, stats := range []FTDCStats{c.baseline, c.target} {
+		for disk := range stats.DiskStats {
+			disks[disk] = true
+		}
+	}
+	for _, disk := range getSortedKeys(disks) {
+		c.compare(as, "iops_"+disk, c.baseline.DiskStats[disk].IOPS, c.target.DiskStats[disk].IOPS)
+		c.compare(as, "disku_"+disk, c.baseline.DiskStats[disk].Utilization, c.target.DiskStats[disk].Utilization)
+	}
+	hosts := map[string]bool{}
+	for _, stats := range []FTDCStats{c.baseline, c.target} {
+		for host := range stats.ReplicationLags {
+			hosts[host] = true
+		}
+	}
+	for _, host := range getSortedKeys(hosts) {
+		c.compare(as, "repl_lag_"+host, c.baseline.ReplicationLags[host], c.target.ReplicationLags[host])
+	}
+	rank := func(mc MetricComparison) int {
+		if mc.Regression {
+			return 0
+		} else if mc.Improvement {
+			return 1
+		} else if mc.Significant {
+			return 2
+		}
+		return 3
+	}
+	sort.SliceStable(c.results, func(i, j int) bool {
+		ri, rj := rank(c.results[i]), rank(c.results[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return getMaxChange(c.results[i]) > getMaxChange(c.results[j])
+	})
+	return c.results
+}
+
+// GetResults returns the comparison results
+func (c *Comparison) GetResults() []MetricComparison {
+	return c.results
+}
+
+// GetRegressions returns statistically significant regressions
+func (c *Comparison) GetRegressions() []MetricComparison {
+	var list []MetricComparison
+	for _, mc := range c.results {
+		if mc.Regression {
+			list = append(list, mc)
+		}
+	}
+	return list
+}
+
+// compare computes stats of a metric in both periods
+func (c *Comparison) compare(as *Assessment, metric string, baseData TimeSeriesDoc, targetData TimeSeriesDoc) {
+	baseValues := getValuesInRange(baseData, c.baseFrom, c.baseTo)
+	targetValues := getValuesInRange(targetData, c.targetFrom, c.targetTo)
+	if len(baseValues) == 0 || len(targetValues) == 0 {
+		return
+	}
+	mc := MetricComparison{Metric: metric, Direction: getCompareDirection(metric)}
+	mc.Baseline[0], mc.Baseline[1], mc.Baseline[2] = as.getStatsByData(baseData, c.baseFrom, c.baseTo)
+	mc.Target[0], mc.Target[1], mc.Target[2] = as.getStatsByData(targetData, c.targetFrom, c.targetTo)
+	for i := range mc.DeltaPct {
+		mc.DeltaPct[i] = getChangePct(mc.Baseline[i], mc.Target[i])
+	}
+	mc.PValue = mannWhitneyU(baseValues, targetValues)
+	change := mc.DeltaPct[1] // median, or p95 if the median barely moved
+	if math.Abs(change) < compareMinChangePct {
+		change = mc.DeltaPct[2]
+	}
+	mc.Significant = mc.PValue < comparePValue && math.Abs(change) >= compareMinChangePct
+	if mc.Significant && mc.Direction != 0 {
+		mc.Regression = float64(mc.Direction)*change > 0
+		mc.Improvement = !mc.Regression
+	}
+	c.results = append(c.results, mc)
+}
+
+// PrintReport outputs comparison to stdout
+func (c *Comparison) PrintReport() {
+	fmt.Println()
+	fmt.Println("╔══════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                         FTDC COMPARISON REPORT                               ║")
+	fmt.Println("╚══════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+	fmt.Printf("📅 Baseline: %s to %s (%s)\n", c.baseFrom.Format("2006-01-02 15:04:05"),
+		c.baseTo.Format("2006-01-02 15:04:05"), getStatsHostname(c.baseline))
+	fmt.Printf("📅 Target:   %s to %s (%s)\n", c.targetFrom.Format("2006-01-02 15:04:05"),
+		c.targetTo.Format("2006-01-02 15:04:05"), getStatsHostname(c.target))
+	fmt.Println()
+
+	var unchanged int
+	for _, mc := range c.results {
+		if !mc.Significant {
+			unchanged++
+		}
+	}
+	if unchanged == len(c.results) {
+		fmt.Println("✅ No significant changes detected!")
+		fmt.Println()
+		return
+	}
+	fmt.Println("─────────────────────────────────────────────────────────────────────────────────")
+	fmt.Printf("   %-24s %-26s %-26s %s\n", "METRIC", "BASELINE p5/median/p95", "TARGET p5/median/p95", "Δ MEDIAN")
+	fmt.Println("─────────────────────────────────────────────────────────────────────────────────")
+	for _, mc := range c.results {
+		if !mc.Significant {
+			continue
+		}
+		icon := "🔵"
+		if mc.Regression {
+			icon = "🔴"
+		} else if mc.Improvement {
+			icon = "🟢"
+		}
+		fmt.Printf("%s %-24s %-26s %-26s %s\n", icon, mc.Metric, formatComparisonStats(mc.Baseline, mc.Metric),
+			formatComparisonStats(mc.Target, mc.Metric), formatChangePct(mc.DeltaPct[1]))
+	}
+	fmt.Println()
+	fmt.Printf("   %d regression(s), %d metric(s) without significant changes (p >= %v or change < %.0f%%)\n",
+		len(c.GetRegressions()), unchanged, comparePValue, compareMinChangePct)
+	fmt.Println()
+}
+
+// GenerateHTML creates a side-by-side HTML report
+func (c *Comparison) GenerateHTML(filename string) error {
+	tmpl := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>FTDC Comparison Report</title>
+    <style>
+        :root {
+            --bg-primary: #0d1117;
+            --bg-secondary: #161b22;
+            --bg-tertiary: #21262d;
+            --text-primary: #c9d1d9;
+            --text-secondary: #8b949e;
+            --accent-green: #238636;
+            --accent-red: #da3633;
+            --accent-yellow: #d29922;
+            --accent-blue: #58a6ff;
+            --border-color: #30363d;
+        }
+        * { box-sizing: border-box; margin: 0; padding: 0; }
+        body {
+            font-family: 'SF Mono', 'Fira Code', 'Consolas', monospace;
+            background: var(--bg-primary);
+            color: var(--text-primary);
+            line-height: 1.6;
+            padding: 2rem;
+        }
+        .container { max-width: 1200px; margin: 0 auto; }
+        header {
+            text-align: center;
+            padding: 2rem;
+            background: linear-gradient(135deg, var(--bg-secondary) 0%, var(--bg-tertiary) 100%);
+            border-radius: 12px;
+            border: 1px solid var(--border-color);
+            margin-bottom: 2rem;
+        }
+        h1 {
+            font-size: 1.8rem;
+            font-weight: 600;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(90deg, var(--accent-blue), #a371f7);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+        .meta {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(280px, 1fr));
+            gap: 1rem;
+            margin-top: 1.5rem;
+            text-align: left;
+        }
+        .meta-item {
+            background: var(--bg-primary);
+            padding: 0.75rem 1rem;
+            border-radius: 6px;
+            border: 1px solid var(--border-color);
+        }
+        .meta-label { color: var(--text-secondary); font-size: 0.75rem; text-transform: uppercase; }
+        .meta-value { font-size: 0.9rem; margin-top: 0.25rem; }
+        .summary {
+            background: var(--bg-secondary);
+            border-radius: 12px;
+            padding: 1.5rem;
+            margin-bottom: 2rem;
+            border: 1px solid var(--border-color);
+        }
+        .summary h2 { font-size: 1rem; margin-bottom: 1rem; }
+        .compare-table {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 0.85rem;
+        }
+        .compare-table th {
+            text-align: left;
+            padding: 0.75rem;
+            background: var(--bg-tertiary);
+            color: var(--text-secondary);
+            font-weight: 500;
+            text-transform: uppercase;
+            font-size: 0.7rem;
+            letter-spacing: 0.5px;
+        }
+        .compare-table th.group { text-align: center; border-bottom: 1px solid var(--border-color); }
+        .compare-table td {
+            padding: 0.5rem 0.75rem;
+            border-bottom: 1px solid var(--border-color);
+        }
+        .compare-table tr:hover { background: var(--bg-tertiary); }
+        .compare-table tr.unchanged { color: var(--text-secondary); }
+        .compare-table td.baseline { background: rgba(88, 166, 255, 0.05); }
+        .compare-table td.target { background: rgba(163, 113, 247, 0.05); }
+        .change.regression { color: var(--accent-red); font-weight: 600; }
+        .change.improvement { color: var(--accent-green); font-weight: 600; }
+        .change.changed { color: var(--accent-yellow); }
+        .no-changes {
+            text-align: center;
+            padding: 2rem;
+            color: var(--accent-green);
+            font-size: 1.1rem;
+        }
+        footer {
+            text-align: center;
+            padding: 2rem;
+            color: var(--text-secondary);
+            font-size: 0.8rem;
+        }
+        footer a { color: var(--accent-blue); text-decoration: none; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <header>
+            <h1>⚖️ FTDC Comparison Report</h1>
+            <div class="meta">
+                <div class="meta-item">
+                    <div class="meta-label">Baseline</div>
+                    <div class="meta-value">{{.BaseFrom}} → {{.BaseTo}}</div>
+                    <div class="meta-value">{{.BaseHost}}</div>
+                </div>
+                <div class="meta-item">
+                    <div class="meta-label">Target</div>
+                    <div class="meta-value">{{.TargetFrom}} → {{.TargetTo}}</div>
+                    <div class="meta-value">{{.TargetHost}}</div>
+                </div>
+                <div class="meta-item">
+                    <div class="meta-label">Significance</div>
+                    <div class="meta-value">p &lt; {{.PValue}} and change ≥ {{.MinChange}}%</div>
+                    <div class="meta-value">{{.Regressions}} regression(s)</div>
+                </div>
+            </div>
+        </header>
+
+        <div class="summary">
+            <h2>📊 Metrics</h2>
+            {{if not .Results}}
+            <div class="no-changes">✅ No metrics to compare</div>
+            {{else}}
+            <table class="compare-table">
+                <thead>
+                    <tr>
+                        <th></th>
+                        <th class="group" colspan="3">Baseline</th>
+                        <th class="group" colspan="3">Target</th>
+                        <th colspan="3"></th>
+                    </tr>
+                    <tr>
+                        <th>Metric</th>
+                        <th>p5</th>
+                        <th>Median</th>
+                        <th>p95</th>
+                        <th>p5</th>
+                        <th>Median</th>
+                        <th>p95</th>
+                        <th>Δ Median</th>
+                        <th>Δ p95</th>
+                        <th>p-value</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .Results}}
+                    <tr{{if not .Significant}} class="unchanged"{{end}}>
+                        <td>{{.Metric}}</td>
+                        {{$metric := .Metric}}
+                        {{range .Baseline}}<td class="baseline">{{formatValue . $metric}}</td>{{end}}
+                        {{range .Target}}<td class="target">{{formatValue . $metric}}</td>{{end}}
+                        <td class="change {{changeClass .}}">{{formatChange (index .DeltaPct 1)}}</td>
+                        <td class="change {{changeClass .}}">{{formatChange (index .DeltaPct 2)}}</td>
+                        <td>{{printf "%.4f" .PValue}}</td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+            {{end}}
+        </div>
+
+        <footer>
+            Generated by <a href="https://github.com/simagix/mongo-ftdc">mongo-ftdc</a> • {{.GeneratedAt}}
+        </footer>
+    </div>
+</body>
+</html>`
+
+	data := struct {
+		BaseFrom    string
+		BaseTo      string
+		BaseHost    string
+		TargetFrom  string
+		TargetTo    string
+		TargetHost  string
+		PValue      float64
+		MinChange   float64
+		Regressions int
+		Results     []MetricComparison
+		GeneratedAt string
+	}{
+		BaseFrom:    c.baseFrom.Format("2006-01-02 15:04:05"),
+		BaseTo:      c.baseTo.Format("2006-01-02 15:04:05"),
+		BaseHost:    getStatsHostname(c.baseline),
+		TargetFrom:  c.targetFrom.Format("2006-01-02 15:04:05"),
+		TargetTo:    c.targetTo.Format("2006-01-02 15:04:05"),
+		TargetHost:  getStatsHostname(c.target),
+		PValue:      comparePValue,
+		MinChange:   compareMinChangePct,
+		Regressions: len(c.GetRegressions()),
+		Results:     c.results,
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05 MST"),
+	}
+
+	funcMap := template.FuncMap{
+		"formatValue":  formatComparisonValue,
+		"formatChange": formatChangePct,
+		"changeClass": func(mc MetricComparison) string {
+			if mc.Regression {
+				return "regression"
+			} else if mc.Improvement {
+				return "improvement"
+			} else if mc.Significant {
+				return "changed"
+			}
+			return ""
+		},
+	}
+
+	t, err := template.New("comparison").Funcs(funcMap).Parse(tmpl)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return t.Execute(f, data)
+}
+
+// getStatsTimeRange returns from and to, zero times are replaced by the first and last samples
+func getStatsTimeRange(stats FTDCStats, from time.Time, to time.Time) (time.Time, time.Time) {
+	first, last, ok := getServerStatusTimeRange(stats.ServerStatusColumns, stats.ServerStatusList)
+	if !ok {
+		return from, to
+	}
+	if from.IsZero() {
+		from = first
+	}
+	if to.IsZero() {
+		to = last
+	}
+	return from, to
+}
+
+// getStatsHostname returns hostname of hostInfo
+func getStatsHostname(stats FTDCStats) string {
+	if hostname := stats.ServerInfo.HostInfo.System.Hostname; hostname != "" {
+		return hostname
+	}
+	return "-"
+}
+
+// getValuesInRange returns values of data points used by getStatsByData
+func getValuesInRange(data TimeSeriesDoc, from time.Time, to time.Time) []float64 {
+	var values []float64
+	for _, v := range FilterTimeSeriesData(data, from, to).Values {
+		if !math.IsNaN(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// getSortedKeys returns sorted keys of a set
+func getSortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getCompareDirection returns 1 if higher values are worse, -1 if lower are worse, otherwise 0
+func getCompareDirection(metric string) int {
+	if direction, ok := compareDirections[metric]; ok {
+		return direction
+	}
+	for key, direction := range compareDirections {
+		if strings.HasSuffix(key, "_") && strings.HasPrefix(metric, key) {
+			return direction
+		}
+	}
+	return 0
+}
+
+// getChangePct returns change in percentage of the baseline value
+func getChangePct(base float64, target float64) float64 {
+	if base == target {
+		return 0
+	} else if base == 0 {
+		return math.Inf(int(math.Copysign(1, target)))
+	}
+	return 100 * (target - base) / math.Abs(base)
+}
+
+// getMaxChange returns the larger absolute change of median and p95
+func getMaxChange(mc MetricComparison) float64 {
+	return math.Max(math.Abs(mc.DeltaPct[1]), math.Abs(mc.DeltaPct[2]))
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test of two samples, using
+// the normal approximation with tie correction
+func mannWhitneyU(a []float64, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type observation struct {
+		value    float64
+		baseline bool
+	}
+	var all []observation
+	for _, v := range a {
+		all = append(all, observation{v, true})
+	}
+	for _, v := range b {
+		all = append(all, observation{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+	var rankSum, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // average of ranks i+1 to j
+		for k := i; k < j; k++ {
+			if all[k].baseline {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	n := n1 + n2
+	u := rankSum - n1*(n1+1)/2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := math.Max(math.Abs(u-n1*n2/2)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// formatComparisonStats formats p5/median/p95
+func formatComparisonStats(values [3]float64, metric string) string {
+	return fmt.Sprintf("%s/%s/%s", formatComparisonValue(values[0], metric),
+		formatComparisonValue(values[1], metric), formatComparisonValue(values[2], metric))
+}
+
+// formatComparisonValue formats a value based on metric type
+func formatComparisonValue(value float64, metric string) string {
+	if strings.HasPrefix(metric, "latency_") {
+		return fmt.Sprintf("%.1fms", value)
+	} else if strings.HasPrefix(metric, "cpu_") || strings.HasPrefix(metric, "disku_") {
+		return fmt.Sprintf("%.1f%%", value)
+	} else if strings.HasPrefix(metric, "repl_lag_") {
+		return fmt.Sprintf("%.1fs", value)
+	} else if math.Abs(value) >= 1000000 {
+		return fmt.Sprintf("%.1fM", value/1000000)
+	} else if math.Abs(value) >= 1000 {
+		return fmt.Sprintf("%.1fK", value/1000)
+	} else if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// formatChangePct formats a change, e.g. +12.5%
+func formatChangePct(pct float64) string {
+	if math.IsInf(pct, 0) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", pct)
+}
@@ -0,0 +1,93 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// comparison_test.go
+
+package ftdc
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestComparisonStats(start time.Time, latency float64, idle float64) FTDCStats {
+	noise := func(i int) float64 { return float64(i%10) / 10 }
+	return newTestStats(start, 600, map[string]func(int) float64{
+		"latency_read": func(i int) float64 { return latency + noise(i) },
+		"ops_query":    func(i int) float64 { return 1000 + float64((i*7)%20) },
+		"cpu_idle":     func(i int) float64 { return idle + noise(i) },
+	})
+}
+
+func TestComparison(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	baseline := getTestComparisonStats(start, 2, 50)
+	target := getTestComparisonStats(start.Add(24*time.Hour), 4, 80)
+	c := NewComparison(baseline, time.Time{}, time.Time{}, target, time.Time{}, time.Time{})
+	results := c.Run()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 metrics, got %v", len(results))
+	}
+	byMetric := map[string]MetricComparison{}
+	for _, mc := range results {
+		byMetric[mc.Metric] = mc
+	}
+	if mc := byMetric["latency_read"]; !mc.Regression || mc.PValue >= comparePValue || math.Abs(mc.DeltaPct[1]-80) > 1 {
+		t.Fatalf("expected a latency regression, got %+v", mc)
+	}
+	if mc := byMetric["cpu_idle"]; !mc.Improvement || mc.Regression {
+		t.Fatalf("expected a cpu_idle improvement, got %+v", mc)
+	}
+	if mc := byMetric["ops_query"]; mc.Significant || mc.PValue < 0.5 {
+		t.Fatalf("expected no ops_query change, got %+v", mc)
+	}
+	if results[0].Metric != "latency_read" || len(c.GetRegressions()) != 1 {
+		t.Fatalf("expected regressions first, got %v", results[0].Metric)
+	}
+
+	filename := filepath.Join(t.TempDir(), "compare.html")
+	if err := c.GenerateHTML(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `class="change regression">&#43;80.0%`) {
+		t.Fatal("expected a regression in the HTML report")
+	}
+	c.PrintReport()
+}
+
+func TestTimeRangeComparison(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	stats := getTestComparisonStats(start, 2, 50)
+	c := NewTimeRangeComparison(stats, start, start.Add(5*time.Minute), start.Add(5*time.Minute), time.Time{})
+	for _, mc := range c.Run() {
+		if mc.Significant {
+			t.Fatalf("unexpected change %+v", mc)
+		}
+	}
+	if !c.targetTo.Equal(stats.ServerStatusColumns.GetTime(599)) {
+		t.Fatalf("unexpected time range %v", c.targetTo)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if p := mannWhitneyU(a, a); p < 0.9 {
+		t.Fatalf("expected no difference, got p=%v", p)
+	}
+	b := []float64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	if p := mannWhitneyU(a, b); p > 0.001 {
+		t.Fatalf("expected a difference, got p=%v", p)
+	}
+	if p := mannWhitneyU([]float64{1, 1}, []float64{1, 1}); p != 1 {
+		t.Fatalf("expected p=1 of ties, got %v", p)
+	}
+	if getCompareDirection("disku_sda") != 1 || getCompareDirection("ticket_avail_read") != -1 || getCompareDirection("ops_query") != 0 {
+		t.Fatal("unexpected directions")
+	}
+}
@@ -5,7 +5,7 @@ package decoder
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
 	"io"
 	"strconv"
 
@@ -16,16 +16,30 @@ import (
 // PathSeparator -
 const PathSeparator = "/" // path separator
 
+// maxChunkValues limits metrics times samples of a chunk, e.g. 5,000 metrics of 6,000
+// samples, a larger header is corrupted
+const maxChunkValues = 1 << 25
+
 // Decode decodes MongoDB FTDC data
 func (m *Metrics) decode(buffer []byte) (MetricsData, error) {
 	var err error
 	var dp = MetricsData{DataPointsMap: map[string][]uint64{}}
 
 	r := bytes.NewReader(buffer)
-	docSize := GetUint32(r) // first bson document length
+	docSize, err := ReadUint32(r) // first bson document length
+	if err != nil {
+		return dp, err
+	} else if docSize < 5 || uint64(docSize)+8 > uint64(len(buffer)) {
+		return dp, fmt.Errorf("%w, reference document of %d bytes in %d", ErrTruncated, docSize, len(buffer))
+	}
 	r.Seek(int64(docSize), io.SeekStart)
-	numAttribs := GetUint32(r)  // 4 bytes # of keys
-	dp.NumDeltas = GetUint32(r) // 4 bytes # of deltas
+	numAttribs, _ := ReadUint32(r)  // 4 bytes # of keys
+	dp.NumDeltas, _ = ReadUint32(r) // 4 bytes # of deltas
+	if numAttribs > docSize {       // a metric takes at least a byte of the reference document
+		return dp, fmt.Errorf("inconsistent FTDC data, %d metrics in a reference document of %d bytes", numAttribs, docSize)
+	} else if uint64(numAttribs)*(uint64(dp.NumDeltas)+1) > maxChunkValues {
+		return dp, fmt.Errorf("%w, %d metrics of %d deltas", ErrDeltaOverrun, numAttribs, dp.NumDeltas)
+	}
 	ptr, _ := r.Seek(0, io.SeekCurrent)
 	r = bytes.NewReader(buffer[ptr:]) // reset reader to where deltas begin
 
@@ -41,19 +55,24 @@ func (m *Metrics) decode(buffer []byte) (MetricsData, error) {
 	// replSetGetStatus
 	// local.oplog.rs.stats
 	var docElem = bson.D{}
-	bson.Unmarshal(buffer[:docSize], &docElem) // first document
-	traverseDocElem(&attribsList, &dp.DataPointsMap, docElem, "", sliceCap)
-
-	// Verify list matches header (map may have fewer due to duplicate BSON keys)
-	if len(attribsList) != int(numAttribs) {
-		return dp, errors.New("inconsistent FTDC data")
+	if err = bson.Unmarshal(buffer[:docSize], &docElem); err != nil { // first document
+		return dp, err
+	}
+	// Verify list matches header before allocating (map may have fewer due to duplicate BSON keys)
+	numMetrics := 0
+	walkDocElem(docElem, "", func(key string, v uint64) { numMetrics++ })
+	if numMetrics != int(numAttribs) {
+		return dp, fmt.Errorf("inconsistent FTDC data, %d metrics in reference document but %d in header",
+			numMetrics, numAttribs)
 	}
+	traverseDocElem(&attribsList, &dp.DataPointsMap, docElem, "", sliceCap)
 
 	// deltas
 	// d where d > 0, return d
 	// 0d -> there are d number of zeros
 	var delta uint64
 	var zerosLeft uint64
+	remaining := uint64(numAttribs) * uint64(dp.NumDeltas) // deltas not yet decoded
 	for _, attr := range attribsList {
 		list := dp.DataPointsMap[attr]
 		v := list[0]
@@ -62,17 +81,27 @@ func (m *Metrics) decode(buffer []byte) (MetricsData, error) {
 				delta = 0
 				zerosLeft--
 			} else {
-				delta = Uvarint(r)
+				if delta, err = ReadUvarint(r); err != nil {
+					return dp, fmt.Errorf("%w, delta %d of %v", err, j, attr)
+				}
 				if delta == 0 {
-					zerosLeft = Uvarint(r)
+					if zerosLeft, err = ReadUvarint(r); err != nil {
+						return dp, fmt.Errorf("%w, zeros %d of %v", err, j, attr)
+					} else if zerosLeft >= remaining { // the run includes this zero
+						return dp, fmt.Errorf("%w, %d zeros at delta %d of %v", ErrDeltaOverrun, zerosLeft+1, j, attr)
+					}
 				}
 			}
+			remaining--
 			v += delta
 			list = append(list, v) // no reallocation due to pre-allocated capacity
 		}
 		dp.DataPointsMap[attr] = list
 	}
 	dp.Block = buffer[:docSize]
+	if m.preserveValues {
+		addValues(&dp, docElem)
+	}
 	return dp, err
 }
 
@@ -89,45 +118,100 @@ func addAttribute(attribsList *[]string, attribsMap *map[string][]uint64, key st
 }
 
 func traverseDocElem(attribsList *[]string, attribsMap *map[string][]uint64, docElem interface{}, parentPath string, sliceCap int) {
+	walkDocElem(docElem, parentPath, func(key string, v uint64) {
+		addAttribute(attribsList, attribsMap, key, v, sliceCap)
+	})
+}
+
+// walkDocElem calls fn for every metric in the order FTDC encodes them
+func walkDocElem(docElem interface{}, parentPath string, fn func(key string, v uint64)) {
+	walkDocValues(docElem, parentPath, func(key string, value interface{}) {
+		switch value := value.(type) {
+		case bool:
+			v := uint64(0)
+			if value {
+				v = 1
+			}
+			fn(key, v)
+		case primitive.Timestamp:
+			fn(key+"/t", uint64(value.T))
+			fn(key+"/i", uint64(value.I))
+		case primitive.ObjectID: // ignore it
+		case string: // ignore it
+		case float64:
+			fn(key, uint64(value))
+		case int:
+			fn(key, uint64(value))
+		case int32:
+			fn(key, uint64(value))
+		case int64:
+			fn(key, uint64(value))
+		case primitive.DateTime:
+			fn(key, uint64(value))
+		case primitive.Decimal128: // mongod encodes decimals as int64
+			fn(key, uint64(int64(decimalToFloat(value))))
+		default:
+			// log.Fatalf("'%s' ==> %T\n", key, value)
+		}
+	})
+}
+
+// walkDocValues calls fn for every leaf value of a document
+func walkDocValues(docElem interface{}, parentPath string, fn func(key string, value interface{})) {
 	switch value := docElem.(type) {
 	case bson.A:
 		for i, v := range value {
 			fld := parentPath + PathSeparator + strconv.Itoa(i)
-			traverseDocElem(attribsList, attribsMap, v, fld, sliceCap)
+			walkDocValues(v, fld, fn)
 		}
-	case bool:
-		v := uint64(0)
-		if value {
-			v = 1
-		}
-		addAttribute(attribsList, attribsMap, parentPath, v, sliceCap)
 	case bson.D:
-		elem := docElem.(bson.D)
-		for _, elem := range elem {
+		for _, elem := range value {
 			name := elem.Key
 			if parentPath != "" {
 				name = parentPath + PathSeparator + name
 			}
-			traverseDocElem(attribsList, attribsMap, elem.Value, name, sliceCap)
+			walkDocValues(elem.Value, name, fn)
 		}
-	case primitive.Timestamp:
-		tKey := parentPath + "/t"
-		addAttribute(attribsList, attribsMap, tKey, uint64(value.T), sliceCap)
-		iKey := parentPath + "/i"
-		addAttribute(attribsList, attribsMap, iKey, uint64(value.I), sliceCap)
-	case primitive.ObjectID: // ignore it
-	case string: // ignore it
-	case float64:
-		addAttribute(attribsList, attribsMap, parentPath, uint64(value), sliceCap)
-	case int:
-		addAttribute(attribsList, attribsMap, parentPath, uint64(value), sliceCap)
-	case int32:
-		addAttribute(attribsList, attribsMap, parentPath, uint64(value), sliceCap)
-	case int64:
-		addAttribute(attribsList, attribsMap, parentPath, uint64(value), sliceCap)
-	case primitive.DateTime:
-		addAttribute(attribsList, attribsMap, parentPath, uint64(value), sliceCap)
 	default:
-		// log.Fatalf("'%s' ==> %T\n", parentPath, value)
+		fn(parentPath, value)
 	}
 }
+
+// addValues keeps strings and floats of the reference document. FTDC stores
+// integer deltas only, float series keep the exact first value followed by
+// integer changes.
+func addValues(dp *MetricsData, docElem bson.D) {
+	dp.Strings = map[string]string{}
+	dp.FloatPointsMap = map[string][]float64{}
+	walkDocValues(docElem, "", func(key string, value interface{}) {
+		var f float64
+		switch value := value.(type) {
+		case string:
+			dp.Strings[key] = value
+			return
+		case primitive.ObjectID:
+			dp.Strings[key] = value.Hex()
+			return
+		case float64:
+			f = value
+		case primitive.Decimal128:
+			f = decimalToFloat(value)
+		default:
+			return
+		}
+		list := dp.DataPointsMap[key]
+		if len(list) == 0 {
+			return
+		}
+		floats := make([]float64, len(list))
+		for i, v := range list {
+			floats[i] = f + float64(int64(v-list[0]))
+		}
+		dp.FloatPointsMap[key] = floats
+	})
+}
+
+func decimalToFloat(d primitive.Decimal128) float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
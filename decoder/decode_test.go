@@ -4,10 +4,12 @@
 package decoder
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var filename = "../testdata/metrics.2020-05-13T14-20-19Z-00000"
@@ -64,3 +66,39 @@ func TestTraverseDocElem(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestPreserveValues(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	oid := primitive.NewObjectID()
+	for i := 0; i < 5; i++ {
+		doc := getTestSample(i)
+		doc = append(doc, bson.E{Key: "ratio", Value: 0.25 + float64(i)})
+		doc = append(doc, bson.E{Key: "electionId", Value: oid})
+		w.WriteSample(doc)
+	}
+	w.Close()
+	buffer := buf.Bytes()
+
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if m.Data[0].Strings != nil || m.Data[0].FloatPointsMap != nil {
+		t.Fatal("values should not be preserved by default")
+	}
+
+	m = NewMetrics()
+	m.SetPreserveValues(true)
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	md := m.Data[0]
+	if md.Strings["serverStatus/host"] != "localhost" || md.Strings["electionId"] != oid.Hex() {
+		t.Fatalf("unexpected strings %v", md.Strings)
+	}
+	floats := md.FloatPointsMap["ratio"]
+	if len(floats) != 5 || floats[0] != 0.25 || floats[4] != 4.25 {
+		t.Fatalf("unexpected floats %v", floats)
+	}
+}
@@ -3,20 +3,83 @@
 
 package decoder
 
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTruncated is returned if a document, chunk or delta stream ends early
+	ErrTruncated = errors.New("truncated FTDC data")
+	// ErrBadVarint is returned if a delta varint overflows 64 bits
+	ErrBadVarint = errors.New("bad varint")
+	// ErrDeltaOverrun is returned if deltas exceed metrics and samples of a chunk
+	ErrDeltaOverrun = errors.New("delta overrun")
+)
+
 // MetricsData -
 type MetricsData struct {
-	Block         []byte
-	DataPointsMap map[string][]uint64
-	NumDeltas     uint32
+	Block          []byte
+	FloatPointsMap map[string][]float64 // float metrics, if values are preserved
+	Strings        map[string]string    // strings and ObjectIDs, if values are preserved
+	DataPointsMap  map[string][]uint64
+	NumDeltas      uint32
 }
 
 // Metrics -
 type Metrics struct {
-	Doc  interface{}   // type 0
-	Data []MetricsData // type 1
+	Doc    interface{}   // type 0
+	Data   []MetricsData // type 1
+	Report DecodeReport  // chunks that failed to decode
+
+	preserveValues bool
 }
 
 // NewMetrics -
 func NewMetrics() *Metrics {
 	return &Metrics{}
 }
+
+// SetPreserveValues keeps strings, ObjectIDs and float values of reference documents
+func (m *Metrics) SetPreserveValues(preserveValues bool) { m.preserveValues = preserveValues }
+
+// DecodeError describes a chunk that failed to decode
+type DecodeError struct {
+	Offset int64  // byte offset of the chunk in the file
+	Reason string // why it failed
+	Err    error  `json:"-"`
+}
+
+// Error returns error message
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("offset %d: %v", e.Offset, e.Reason)
+}
+
+// Unwrap returns the cause, e.g. ErrTruncated
+func (e DecodeError) Unwrap() error { return e.Err }
+
+// DecodeReport summarizes decoding of a FTDC file
+type DecodeReport struct {
+	Filename string
+	Blocks   int // number of metrics chunks found
+	Decoded  int // number of metrics chunks decoded
+	Skipped  int // number of metrics chunks outside of the time range
+	Errors   []DecodeError
+}
+
+// addError records a chunk that failed to decode
+func (r *DecodeReport) addError(offset int64, err error) {
+	r.Errors = append(r.Errors, DecodeError{Offset: offset, Reason: err.Error(), Err: err})
+}
+
+// String returns a one line summary
+func (r DecodeReport) String() string {
+	str := fmt.Sprintf("%v: %d of %d blocks decoded", r.Filename, r.Decoded, r.Blocks)
+	if r.Skipped > 0 {
+		str += fmt.Sprintf(", %d skipped", r.Skipped)
+	}
+	if len(r.Errors) > 0 {
+		str += fmt.Sprintf(", %d error(s), first at %v", len(r.Errors), r.Errors[0].Error())
+	}
+	return str
+}
@@ -0,0 +1,149 @@
+// Copyright 2018-present Kuei-chun Chen. All rights reserved.
+// fuzz_test.go
+
+package decoder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getSeedFiles returns FTDC files of testdata and a generated one
+func getSeedFiles(tb testing.TB) [][]byte {
+	var seeds [][]byte
+	filenames, _ := filepath.Glob("../testdata/metrics.*")
+	for _, filename := range filenames {
+		if data, err := os.ReadFile(filename); err == nil {
+			seeds = append(seeds, data)
+		}
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetMaxSamples(10)
+	for i := 0; i < 25; i++ {
+		w.WriteSample(getTestSample(i))
+	}
+	w.Close()
+	return append(seeds, buf.Bytes())
+}
+
+// getChunks returns uncompressed metrics chunks of a FTDC file
+func getChunks(data []byte) [][]byte {
+	var chunks [][]byte
+	for len(data) >= 4 {
+		length := binary.LittleEndian.Uint32(data)
+		if length < 5 || int(length) > len(data) {
+			break
+		}
+		var doc bson.M
+		if bson.Unmarshal(data[:length], &doc) == nil {
+			if bin, ok := doc["data"].(primitive.Binary); ok && len(bin.Data) > 4 {
+				if r, err := zlib.NewReader(bytes.NewReader(bin.Data[4:])); err == nil {
+					if chunk, err := io.ReadAll(r); err == nil {
+						chunks = append(chunks, chunk)
+					}
+				}
+			}
+		}
+		data = data[length:]
+	}
+	return chunks
+}
+
+func TestDecodeErrors(t *testing.T) {
+	seeds := getSeedFiles(t)
+	chunk := getChunks(seeds[len(seeds)-1])[0] // generated
+	m := NewMetrics()
+	if _, err := m.decode(chunk); err != nil {
+		t.Fatal(err)
+	}
+	deltas := int(binary.LittleEndian.Uint32(chunk)) + 8 // deltas follow the reference document and header
+	overrun := append(append([]byte{}, chunk[:deltas]...), 0x00, 0xff, 0xff, 0xff, 0x7f)
+	for _, tc := range []struct {
+		data     []byte
+		expected error
+	}{
+		{chunk[:3], ErrTruncated},
+		{chunk[:deltas-4], ErrTruncated},
+		{chunk[:deltas+2], ErrTruncated},
+		{append(append([]byte{}, chunk[:deltas]...), bytes.Repeat([]byte{0xff}, 11)...), ErrBadVarint},
+		{overrun, ErrDeltaOverrun},
+	} {
+		if _, err := m.decode(tc.data); !errors.Is(err, tc.expected) {
+			t.Fatalf("expected %v, got %v", tc.expected, err)
+		}
+	}
+
+	// a chunk of corrupted deltas is reported with the cause
+	var buf bytes.Buffer
+	block, _ := CompressBlock(overrun)
+	doc, _ := bson.Marshal(bson.D{{Key: "_id", Value: primitive.DateTime(0)}, {Key: "type", Value: int32(1)},
+		{Key: "data", Value: primitive.Binary{Data: block}}})
+	buf.Write(doc)
+	buffer := buf.Bytes()
+	if err := m.ReadAllMetrics(&buffer); !errors.Is(err, ErrDeltaOverrun) {
+		t.Fatalf("expected ErrDeltaOverrun, got %v", err)
+	}
+	reader := NewReader(bytes.NewReader(buffer))
+	if _, err := reader.Next(); err != io.EOF || len(reader.Report().Errors) != 1 ||
+		!errors.Is(reader.Report().Errors[0], ErrDeltaOverrun) {
+		t.Fatalf("expected ErrDeltaOverrun, got %v", reader.Report())
+	}
+}
+
+func TestReadInvalidLength(t *testing.T) {
+	buffer := []byte{0xff, 0xff, 0xff, 0x7f, 0x00} // 2GB document
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err == nil {
+		t.Fatal("expected invalid document length")
+	}
+	reader := NewReader(bytes.NewReader(buffer))
+	if _, err := reader.Next(); err != io.EOF || len(reader.Report().Errors) != 1 {
+		t.Fatalf("expected invalid document length, got %v", reader.Report())
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range getSeedFiles(f) {
+		for _, chunk := range getChunks(seed) {
+			f.Add(chunk)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m := NewMetrics()
+		m.SetPreserveValues(true)
+		dp, err := m.decode(data)
+		if err != nil {
+			return
+		}
+		for attr, list := range dp.DataPointsMap {
+			if len(list) < int(dp.NumDeltas)+1 {
+				t.Fatalf("%v has %d of %d values", attr, len(list), dp.NumDeltas+1)
+			}
+		}
+	})
+}
+
+func FuzzReadAllMetrics(f *testing.F) {
+	for _, seed := range getSeedFiles(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m := NewMetrics()
+		m.ReadAllMetrics(&data)
+		reader := NewReader(bytes.NewReader(data))
+		reader.ForEach(func(chunk *Chunk) error { return nil })
+		if report := reader.Report(); report.Decoded != m.Report.Decoded {
+			t.Fatalf("decoded %d chunks by Reader, %d by ReadAllMetrics", report.Decoded, m.Report.Decoded)
+		}
+	})
+}
@@ -6,44 +6,72 @@ package decoder
 import (
 	"bytes"
 	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"runtime"
+	"sort"
 	"sync"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// ReadAllMetrics reads all metrics with parallel block processing
+// ReadAllMetrics reads all metrics with parallel block processing. Chunks that
+// fail to decode are skipped and recorded in m.Report, an error is returned only
+// if none of the chunks can be decoded.
 func (m *Metrics) ReadAllMetrics(data *[]byte) error {
 	var pos uint32
 	buffer := *data
+	m.Report = DecodeReport{}
 
 	// First pass: extract compressed data blocks (sequential)
 	var compressedBlocks [][]byte
+	var offsets []int64
 
 	for {
 		if pos >= uint32(len(buffer)) {
 			break
 		}
-		bs := buffer[pos:(pos + 4)]
-		length := GetUint32(bytes.NewReader(bs))
-		bs = buffer[pos:(pos + length)]
+		if uint64(pos)+4 > uint64(len(buffer)) {
+			m.Report.addError(int64(pos), ErrTruncated)
+			break
+		}
+		length := binary.LittleEndian.Uint32(buffer[pos:])
+		if length == 0 { // end of metrics.interim
+			break
+		} else if err := checkDocumentLength(length); err != nil {
+			m.Report.addError(int64(pos), err)
+			break
+		} else if uint64(pos)+uint64(length) > uint64(len(buffer)) {
+			m.Report.addError(int64(pos), ErrTruncated)
+			break
+		}
+		bs := buffer[pos:(pos + length)]
+		offset := int64(pos)
 		pos += length
 
 		var out = bson.M{}
 		if err := bson.Unmarshal(bs, &out); err != nil {
-			return err
+			m.Report.addError(offset, err)
+			continue
 		} else if out["type"] == int32(0) {
 			m.Doc = out["doc"]
 		} else if out["type"] == int32(1) {
-			// Skip first 4 bytes of binary data (uncompressed size)
-			compressedBlocks = append(compressedBlocks, (out["data"].(primitive.Binary)).Data[4:])
+			m.Report.Blocks++
+			data, ok := out["data"].(primitive.Binary)
+			if !ok || len(data.Data) < 4 {
+				m.Report.addError(offset, errors.New("invalid metrics chunk"))
+				continue
+			}
+			compressedBlocks = append(compressedBlocks, data.Data)
+			offsets = append(offsets, offset)
 		}
 	}
 
 	if len(compressedBlocks) == 0 {
-		return nil
+		return m.reportError()
 	}
 
 	// Second pass: decompress and decode blocks in parallel
@@ -53,8 +81,7 @@ func (m *Metrics) ReadAllMetrics(data *[]byte) error {
 	}
 
 	metricsData := make([]MetricsData, len(compressedBlocks))
-	var firstErr error
-	var errOnce sync.Once
+	blockErrors := make([]error, len(compressedBlocks))
 	sem := make(chan struct{}, numWorkers)
 	var wg sync.WaitGroup
 
@@ -64,41 +91,58 @@ func (m *Metrics) ReadAllMetrics(data *[]byte) error {
 			defer wg.Done()
 			sem <- struct{}{}        // acquire semaphore
 			defer func() { <-sem }() // release semaphore
-
-			// Skip if error already occurred
-			if firstErr != nil {
-				return
-			}
-
-			// Decompress
-			r, err := zlib.NewReader(bytes.NewReader(data))
-			if err != nil {
-				errOnce.Do(func() { firstErr = err })
-				return
-			}
-			decompressed, err := io.ReadAll(r)
-			r.Close()
-			if err != nil {
-				errOnce.Do(func() { firstErr = err })
-				return
-			}
-
-			// Decode
-			md, err := m.decode(decompressed)
-			if err != nil {
-				errOnce.Do(func() { firstErr = err })
-				return
-			}
-			metricsData[idx] = md
+			metricsData[idx], blockErrors[idx] = m.decodeCompressed(data)
 		}(i, compressed)
 	}
 
 	wg.Wait()
 
-	if firstErr != nil {
-		return firstErr
+	// Keep decoded blocks in order and report the others
+	m.Data = make([]MetricsData, 0, len(metricsData))
+	for i, md := range metricsData {
+		if blockErrors[i] != nil {
+			m.Report.addError(offsets[i], blockErrors[i])
+			continue
+		}
+		m.Data = append(m.Data, md)
 	}
+	sort.Slice(m.Report.Errors, func(i int, j int) bool {
+		return m.Report.Errors[i].Offset < m.Report.Errors[j].Offset
+	})
+	m.Report.Decoded = len(m.Data)
+	if len(m.Data) == 0 {
+		return m.reportError()
+	}
+	return nil
+}
 
-	m.Data = metricsData
+// reportError returns the first decoding error if any
+func (m *Metrics) reportError() error {
+	if len(m.Report.Errors) > 0 {
+		return m.Report.Errors[0]
+	}
 	return nil
 }
+
+// decodeCompressed decompresses and decodes a metrics chunk, the first 4 bytes are the
+// uncompressed size
+func (m *Metrics) decodeCompressed(data []byte) (MetricsData, error) {
+	size := binary.LittleEndian.Uint32(data)
+	if size > maxChunkSize {
+		return MetricsData{}, fmt.Errorf("invalid uncompressed size %d", size)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data[4:]))
+	if err != nil {
+		return MetricsData{}, err
+	}
+	decompressed, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	r.Close()
+	if err == io.ErrUnexpectedEOF {
+		return MetricsData{}, fmt.Errorf("%w, zlib stream", ErrTruncated)
+	} else if err != nil {
+		return MetricsData{}, err
+	} else if len(decompressed) != int(size) {
+		return MetricsData{}, fmt.Errorf("uncompressed size %d, expected %d", len(decompressed), size)
+	}
+	return m.decode(decompressed)
+}
@@ -0,0 +1,206 @@
+// Copyright 2018-present Kuei-chun Chen. All rights reserved.
+// reader.go
+
+package decoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxDocumentSize is the BSON size limit of mongod, 16MB and 16KB of internal use
+const maxDocumentSize = 16*1024*1024 + 16*1024
+
+// maxChunkSize limits the uncompressed size of a metrics chunk
+const maxChunkSize = 64 * 1024 * 1024
+
+// Chunk is a decoded FTDC document, either metadata (type 0) or metrics (type 1)
+type Chunk struct {
+	ID     time.Time    // _id of the chunk
+	Offset int64        // byte offset of the chunk in the stream
+	Type   int32        // 0: metadata, 1: metrics
+	Doc    interface{}  // type 0 only
+	Data   *MetricsData // type 1 only
+}
+
+// Reader decodes FTDC chunks one at a time from an io.Reader
+type Reader struct {
+	from       time.Time // chunks outside of from and to are skipped, zero is unbounded
+	metrics    *Metrics
+	offset     int64
+	pending    []byte // next document read ahead
+	pendingErr error
+	r          *bufio.Reader
+	report     DecodeReport
+	to         time.Time
+}
+
+// NewReader returns a streaming FTDC reader
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{metrics: NewMetrics(), r: br}
+}
+
+// SetPreserveValues keeps strings, ObjectIDs and float values of reference documents
+func (r *Reader) SetPreserveValues(preserveValues bool) { r.metrics.SetPreserveValues(preserveValues) }
+
+// SetTimeRange skips metrics chunks entirely before from or after to without decoding
+// deltas. A chunk ends where the next one starts. Zero from or to is unbounded.
+func (r *Reader) SetTimeRange(from time.Time, to time.Time) { r.from, r.to = from, to }
+
+// Offset returns number of bytes consumed by complete chunks
+func (r *Reader) Offset() int64 { return r.offset }
+
+// Report returns chunks read so far and those failed to decode
+func (r *Reader) Report() DecodeReport { return r.report }
+
+// Next returns the next chunk, io.EOF is returned when there are no more chunks.
+// Chunks that fail to decode are recorded in Report() and skipped, a truncated
+// or corrupted document ends the stream.
+func (r *Reader) Next() (*Chunk, error) {
+	for {
+		buffer, err := r.nextDocument()
+		if err == io.EOF {
+			return nil, err
+		} else if err != nil {
+			r.report.addError(r.offset, err)
+			return nil, io.EOF
+		}
+		offset := r.offset
+		r.offset += int64(len(buffer))
+		if r.isOutOfRange(buffer) {
+			r.report.Blocks++
+			r.report.Skipped++
+			continue
+		}
+
+		var out = bson.M{}
+		if err = bson.Unmarshal(buffer, &out); err != nil {
+			r.report.addError(offset, err)
+			continue
+		}
+		chunk := Chunk{Offset: offset}
+		if id, ok := out["_id"].(primitive.DateTime); ok {
+			chunk.ID = id.Time()
+		}
+		if out["type"] == int32(0) {
+			chunk.Type = 0
+			chunk.Doc = out["doc"]
+			return &chunk, nil
+		} else if out["type"] == int32(1) {
+			r.report.Blocks++
+			data, ok := out["data"].(primitive.Binary)
+			if !ok || len(data.Data) < 4 {
+				r.report.addError(offset, errors.New("invalid metrics chunk"))
+				continue
+			}
+			md, err := r.metrics.decodeCompressed(data.Data)
+			if err != nil {
+				r.report.addError(offset, err)
+				continue
+			}
+			r.report.Decoded++
+			chunk.Type = 1
+			chunk.Data = &md
+			return &chunk, nil
+		}
+		// unknown type, skip it
+	}
+}
+
+// ForEach calls fn for every chunk until the end of stream or fn returns an error
+func (r *Reader) ForEach(fn func(chunk *Chunk) error) error {
+	for {
+		chunk, err := r.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = fn(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// nextDocument returns the document read ahead if any, or reads one
+func (r *Reader) nextDocument() ([]byte, error) {
+	if r.pending != nil || r.pendingErr != nil {
+		buffer, err := r.pending, r.pendingErr
+		r.pending, r.pendingErr = nil, nil
+		return buffer, err
+	}
+	return r.readDocument()
+}
+
+// isOutOfRange returns true if a metrics chunk starts after to, or the next chunk starts
+// before from
+func (r *Reader) isOutOfRange(buffer []byte) bool {
+	if r.from.IsZero() && r.to.IsZero() {
+		return false
+	}
+	doc := bson.Raw(buffer)
+	if t, ok := doc.Lookup("type").Int32OK(); !ok || t != 1 {
+		return false
+	}
+	id, ok := doc.Lookup("_id").DateTimeOK()
+	if !ok {
+		return false
+	}
+	if !r.to.IsZero() && id > r.to.UnixMilli() {
+		return true
+	}
+	if r.from.IsZero() {
+		return false
+	}
+	if r.pending == nil && r.pendingErr == nil {
+		r.pending, r.pendingErr = r.readDocument()
+	}
+	if r.pending == nil {
+		return false
+	}
+	next, ok := bson.Raw(r.pending).Lookup("_id").DateTimeOK()
+	return ok && next <= r.from.UnixMilli()
+}
+
+// readDocument reads a complete BSON document
+func (r *Reader) readDocument() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r.r, header); err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncated
+	} else if err != nil {
+		return nil, err // io.EOF
+	}
+	length := binary.LittleEndian.Uint32(header)
+	if length == 0 { // mongod ends metrics.interim with zeros, stale bytes may follow
+		return nil, io.EOF
+	} else if err := checkDocumentLength(length); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, length)
+	copy(buffer, header)
+	if _, err := io.ReadFull(r.r, buffer[4:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncated
+	} else if err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// checkDocumentLength validates a BSON document length before reading or allocating it
+func checkDocumentLength(length uint32) error {
+	if length < 5 || length > maxDocumentSize {
+		return fmt.Errorf("invalid document length %d", length)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2018-present Kuei-chun Chen. All rights reserved.
+// reader_test.go
+
+package decoder
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReaderNext(t *testing.T) {
+	var err error
+	var buffer []byte
+
+	if buffer, err = os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics()
+	if err = m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	blocks := 0
+	reader := NewReader(file)
+	if err = reader.ForEach(func(chunk *Chunk) error {
+		if chunk.Type != 1 {
+			return nil
+		}
+		if chunk.Data.NumDeltas != m.Data[blocks].NumDeltas {
+			t.Fatalf("block %d: expected %d deltas, got %d", blocks, m.Data[blocks].NumDeltas, chunk.Data.NumDeltas)
+		}
+		blocks++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if blocks != len(m.Data) {
+		t.Fatalf("expected %d blocks, got %d", len(m.Data), blocks)
+	}
+	if reader.Offset() != int64(len(buffer)) {
+		t.Fatalf("expected offset %d, got %d", len(buffer), reader.Offset())
+	}
+}
+
+func getTestBuffer(t *testing.T, numSamples int) ([]byte, []int64) {
+	var buf bytes.Buffer
+	var offsets []int64
+	w := NewWriter(&buf)
+	w.SetMaxSamples(10)
+	for i := 0; i < numSamples; i++ {
+		if i%10 == 0 {
+			offsets = append(offsets, int64(buf.Len()))
+		}
+		if err := w.WriteSample(getTestSample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	return buf.Bytes(), offsets
+}
+
+func TestReadTruncated(t *testing.T) {
+	buffer, offsets := getTestBuffer(t, 30)
+	buffer = buffer[:len(buffer)-20] // copied while mongod is writing
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 2 || len(m.Report.Errors) != 1 || m.Report.Errors[0].Offset != offsets[2] {
+		t.Fatalf("expected 2 blocks and an error at %d, got %d blocks, %v", offsets[2], len(m.Data), m.Report)
+	}
+
+	reader := NewReader(bytes.NewReader(buffer))
+	blocks := 0
+	if err := reader.ForEach(func(chunk *Chunk) error {
+		blocks++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	report := reader.Report()
+	if blocks != 2 || len(report.Errors) != 1 || reader.Offset() != offsets[2] {
+		t.Fatalf("expected 2 blocks and offset %d, got %d blocks, offset %d", offsets[2], blocks, reader.Offset())
+	}
+}
+
+func TestReadInterim(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < 25; i++ {
+		w.WriteSample(getTestSample(i))
+	}
+	w.Close()
+	chunk := buf.Bytes()
+	// mongod rewrites metrics.interim from the start and ends it with 8 zero bytes,
+	// bytes of a previous longer chunk may follow
+	buffer := append(append(append([]byte{}, chunk...), make([]byte, 8)...), chunk[:100]...)
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 1 || m.Data[0].NumDeltas != 24 || len(m.Report.Errors) != 0 {
+		t.Fatalf("expected a block of 25 samples, got %d blocks, %v", len(m.Data), m.Report)
+	}
+
+	reader := NewReader(bytes.NewReader(buffer))
+	blocks := 0
+	if err := reader.ForEach(func(chunk *Chunk) error {
+		blocks++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if blocks != 1 || len(reader.Report().Errors) != 0 || reader.Offset() != int64(len(chunk)) {
+		t.Fatalf("expected a block, got %d blocks, %v", blocks, reader.Report())
+	}
+}
+
+func TestReadCorrupted(t *testing.T) {
+	buffer, offsets := getTestBuffer(t, 30)
+	// corrupt compressed data of the second block
+	pos := int(offsets[1]) + 40
+	for i := pos; i < pos+20; i++ {
+		buffer[i] = 0xFF
+	}
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Data) != 2 || m.Report.Blocks != 3 || m.Report.Decoded != 2 {
+		t.Fatalf("expected 2 of 3 blocks, got %v", m.Report)
+	}
+	if len(m.Report.Errors) != 1 || m.Report.Errors[0].Offset != offsets[1] {
+		t.Fatalf("expected an error at %d, got %v", offsets[1], m.Report.Errors)
+	}
+	if m.Data[1].DataPointsMap["serverStatus/opcounters/insert"][0] != 200 {
+		t.Fatalf("expected 200, got %d", m.Data[1].DataPointsMap["serverStatus/opcounters/insert"][0])
+	}
+
+	reader := NewReader(bytes.NewReader(buffer))
+	blocks := 0
+	reader.ForEach(func(chunk *Chunk) error {
+		blocks++
+		return nil
+	})
+	if blocks != 2 || len(reader.Report().Errors) != 1 {
+		t.Fatalf("expected 2 blocks, got %d, %v", blocks, reader.Report())
+	}
+}
+
+func TestReaderTimeRange(t *testing.T) {
+	buffer, offsets := getTestBuffer(t, 30) // chunks start at 14:20:19, 14:20:29 and 14:20:39
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	reader := NewReader(bytes.NewReader(buffer))
+	reader.SetTimeRange(start.Add(15*time.Second), start.Add(18*time.Second))
+	var chunks []*Chunk
+	if err := reader.ForEach(func(chunk *Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	report := reader.Report()
+	if len(chunks) != 1 || chunks[0].Offset != offsets[1] || report.Skipped != 2 || report.Blocks != 3 {
+		t.Fatalf("expected the second chunk only, got %d chunks, %v", len(chunks), report)
+	}
+	if reader.Offset() != int64(len(buffer)) {
+		t.Fatalf("expected offset %d, got %d", len(buffer), reader.Offset())
+	}
+
+	reader = NewReader(bytes.NewReader(buffer))
+	reader.SetTimeRange(start.Add(10*time.Second), time.Time{})
+	chunks = nil
+	reader.ForEach(func(chunk *Chunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if len(chunks) != 2 || chunks[0].Offset != offsets[1] {
+		t.Fatalf("expected the last 2 chunks, got %d", len(chunks))
+	}
+}
@@ -8,15 +8,32 @@ import (
 	"io"
 )
 
-// GetUint32 -
+// GetUint32 returns a little endian uint32, or 0 if not enough bytes, see ReadUint32
 func GetUint32(r io.Reader) uint32 {
+	v, _ := ReadUint32(r)
+	return v
+}
+
+// ReadUint32 reads a little endian uint32, ErrTruncated is returned if not enough bytes
+func ReadUint32(r io.Reader) (uint32, error) {
 	var size uint32
-	binary.Read(r, binary.LittleEndian, &size)
-	return size
+	if err := binary.Read(r, binary.LittleEndian, &size); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, ErrTruncated
+	} else if err != nil {
+		return 0, err
+	}
+	return size, nil
 }
 
-// Uvarint -
+// Uvarint returns an unsigned varint, or 0 if truncated or overflowed, see ReadUvarint
 func Uvarint(r io.ByteReader) uint64 {
+	v, _ := ReadUvarint(r)
+	return v
+}
+
+// ReadUvarint reads an unsigned varint, ErrTruncated is returned if bytes run out and
+// ErrBadVarint if it overflows 64 bits
+func ReadUvarint(r io.ByteReader) (uint64, error) {
 	var x uint64
 	var s uint
 	var b byte
@@ -24,13 +41,16 @@ func Uvarint(r io.ByteReader) uint64 {
 
 	for i := 0; ; i++ {
 		if b, err = r.ReadByte(); err != nil {
-			return 0
+			return 0, ErrTruncated
 		}
 		if b < 0x80 {
 			if i > 9 || i == 9 && b > 1 {
-				return 0 // overflow
+				return 0, ErrBadVarint // overflow
 			}
-			return x | uint64(b)<<s
+			return x | uint64(b)<<s, nil
+		}
+		if i >= 9 {
+			return 0, ErrBadVarint
 		}
 		x |= uint64(b&0x7f) << s
 		s += 7
@@ -5,6 +5,7 @@ package decoder
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -29,3 +30,21 @@ func TestUvarint(t *testing.T) {
 		t.Fatal(ui, 15)
 	}
 }
+
+func TestReadUint32(t *testing.T) {
+	if _, err := ReadUint32(bytes.NewReader([]byte{0x0f, 0x00})); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestReadUvarint(t *testing.T) {
+	if ui, err := ReadUvarint(bytes.NewReader([]byte{0xac, 0x02})); err != nil || ui != 300 {
+		t.Fatal(ui, err)
+	}
+	if _, err := ReadUvarint(bytes.NewReader([]byte{0xac})); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if _, err := ReadUvarint(bytes.NewReader(bytes.Repeat([]byte{0xff}, 11))); !errors.Is(err, ErrBadVarint) {
+		t.Fatalf("expected ErrBadVarint, got %v", err)
+	}
+}
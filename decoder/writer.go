@@ -0,0 +1,224 @@
+// Copyright 2018-present Kuei-chun Chen. All rights reserved.
+// writer.go
+
+package decoder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultMaxSamples is the number of samples per chunk, same as mongod
+const DefaultMaxSamples = 300
+
+// Writer encodes samples into FTDC chunks readable by mongod and this package
+type Writer struct {
+	id         time.Time  // _id of the pending chunk
+	keys       []string   // metric names of the reference document
+	maxSamples int        // samples per chunk
+	numSamples int        // samples in the pending chunk
+	refDoc     []byte     // reference document of the pending chunk
+	values     [][]uint64 // [metric][sample]
+	w          io.Writer
+}
+
+// NewWriter returns a FTDC writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{maxSamples: DefaultMaxSamples, w: w}
+}
+
+// SetMaxSamples sets number of samples per chunk
+func (w *Writer) SetMaxSamples(maxSamples int) {
+	if maxSamples > 0 {
+		w.maxSamples = maxSamples
+	}
+}
+
+// WriteMetadata writes a type 0 metadata document, e.g. {hostInfo: ..., buildInfo: ...}
+func (w *Writer) WriteMetadata(doc interface{}) error {
+	data, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: primitive.NewDateTimeFromTime(time.Now())},
+		{Key: "type", Value: int32(0)},
+		{Key: "doc", Value: doc},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(data)
+	return err
+}
+
+// WriteSample adds a sample, the first sample of a chunk becomes its reference document.
+// A chunk is written when it is full or when the schema of the sample differs from the
+// reference document.
+func (w *Writer) WriteSample(doc bson.D) error {
+	keys, values := flattenDoc(doc)
+	if w.numSamples > 0 && !sameKeys(w.keys, keys) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if w.numSamples == 0 {
+		refDoc, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		w.id = getStartTime(doc)
+		w.keys = keys
+		w.refDoc = refDoc
+		w.values = make([][]uint64, len(keys))
+		for i := range w.values {
+			w.values[i] = make([]uint64, 0, w.maxSamples)
+		}
+	}
+	for i, v := range values {
+		w.values[i] = append(w.values[i], v)
+	}
+	w.numSamples++
+	if w.numSamples >= w.maxSamples {
+		return w.Flush()
+	}
+	return nil
+}
+
+// WriteMetricsData writes a decoded chunk as is, pending samples are flushed first
+func (w *Writer) WriteMetricsData(md MetricsData) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var doc = bson.D{}
+	if err := bson.Unmarshal(md.Block, &doc); err != nil {
+		return err
+	}
+	keys, _ := flattenDoc(doc)
+	values := make([][]uint64, len(keys))
+	for i, key := range keys {
+		values[i] = md.DataPointsMap[key]
+		if len(values[i]) != int(md.NumDeltas)+1 {
+			return errors.New("inconsistent FTDC data")
+		}
+	}
+	return w.writeChunk(getStartTime(doc), md.Block, values, int(md.NumDeltas)+1)
+}
+
+// Flush writes pending samples as a chunk
+func (w *Writer) Flush() error {
+	if w.numSamples == 0 {
+		return nil
+	}
+	err := w.writeChunk(w.id, w.refDoc, w.values, w.numSamples)
+	w.numSamples = 0
+	w.keys = nil
+	w.refDoc = nil
+	w.values = nil
+	return err
+}
+
+// Close flushes pending samples
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// writeChunk writes a type 1 document of delta encoded and compressed samples
+func (w *Writer) writeChunk(id time.Time, refDoc []byte, values [][]uint64, numSamples int) error {
+	var buf bytes.Buffer
+	buf.Write(refDoc)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(values)))
+	binary.Write(&buf, binary.LittleEndian, uint32(numSamples-1))
+
+	// deltas
+	// d where d > 0, write d
+	// d where d == 0, write 0 followed by number of additional zeros
+	var zeros uint64
+	varint := make([]byte, binary.MaxVarintLen64)
+	for _, list := range values {
+		for j := 1; j < numSamples; j++ {
+			delta := list[j] - list[j-1]
+			if delta == 0 {
+				zeros++
+				continue
+			}
+			if zeros > 0 {
+				buf.Write(varint[:binary.PutUvarint(varint, 0)])
+				buf.Write(varint[:binary.PutUvarint(varint, zeros-1)])
+				zeros = 0
+			}
+			buf.Write(varint[:binary.PutUvarint(varint, delta)])
+		}
+	}
+	if zeros > 0 {
+		buf.Write(varint[:binary.PutUvarint(varint, 0)])
+		buf.Write(varint[:binary.PutUvarint(varint, zeros-1)])
+	}
+
+	data, err := CompressBlock(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	chunk, err := bson.Marshal(bson.D{
+		{Key: "_id", Value: primitive.NewDateTimeFromTime(id)},
+		{Key: "type", Value: int32(1)},
+		{Key: "data", Value: primitive.Binary{Data: data}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(chunk)
+	return err
+}
+
+// CompressBlock compresses decoded chunk data, prefixed with its uncompressed size
+func CompressBlock(decompressed []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(decompressed)))
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(decompressed); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flattenDoc returns metric names and values in the order FTDC encodes them
+func flattenDoc(doc bson.D) ([]string, []uint64) {
+	var keys []string
+	var values []uint64
+	walkDocElem(doc, "", func(key string, v uint64) {
+		keys = append(keys, key)
+		values = append(values, v)
+	})
+	return keys, values
+}
+
+func sameKeys(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getStartTime returns the start time of a sample, or now if not available
+func getStartTime(doc bson.D) time.Time {
+	for _, elem := range doc {
+		if elem.Key == "start" {
+			if dt, ok := elem.Value.(primitive.DateTime); ok {
+				return dt.Time()
+			}
+		}
+	}
+	return time.Now()
+}
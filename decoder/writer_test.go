@@ -0,0 +1,135 @@
+// Copyright 2018-present Kuei-chun Chen. All rights reserved.
+// writer_test.go
+
+package decoder
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getTestSample(i int) bson.D {
+	tm := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC).Add(time.Duration(i) * time.Second)
+	return bson.D{
+		{Key: "start", Value: primitive.NewDateTimeFromTime(tm)},
+		{Key: "serverStatus", Value: bson.D{
+			{Key: "host", Value: "localhost"},
+			{Key: "localTime", Value: primitive.NewDateTimeFromTime(tm)},
+			{Key: "uptime", Value: float64(1000 + i)},
+			{Key: "opcounters", Value: bson.D{
+				{Key: "insert", Value: int64(10 * i)},
+				{Key: "query", Value: int64(i * i)},
+				{Key: "update", Value: int64(0)},
+			}},
+			{Key: "connections", Value: bson.D{{Key: "current", Value: int32(10 + i%3)}}},
+		}},
+		{Key: "end", Value: primitive.NewDateTimeFromTime(tm)},
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetMaxSamples(300)
+	if err := w.WriteMetadata(bson.D{{Key: "hostInfo", Value: bson.D{{Key: "system", Value: bson.D{{Key: "hostname", Value: "localhost"}}}}}}); err != nil {
+		t.Fatal(err)
+	}
+	numSamples := 650
+	for i := 0; i < numSamples; i++ {
+		if err := w.WriteSample(getTestSample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := buf.Bytes()
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if m.Doc == nil {
+		t.Fatal("metadata not found")
+	}
+	if len(m.Data) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(m.Data))
+	}
+	n := 0
+	for _, md := range m.Data {
+		for j := 0; j <= int(md.NumDeltas); j++ {
+			if md.DataPointsMap["serverStatus/opcounters/insert"][j] != uint64(10*n) {
+				t.Fatalf("sample %d: expected %d, got %d", n, 10*n, md.DataPointsMap["serverStatus/opcounters/insert"][j])
+			}
+			if md.DataPointsMap["serverStatus/opcounters/query"][j] != uint64(n*n) {
+				t.Fatalf("sample %d: expected %d, got %d", n, n*n, md.DataPointsMap["serverStatus/opcounters/query"][j])
+			}
+			if md.DataPointsMap["serverStatus/connections/current"][j] != uint64(10+n%3) {
+				t.Fatalf("sample %d: expected %d, got %d", n, 10+n%3, md.DataPointsMap["serverStatus/connections/current"][j])
+			}
+			n++
+		}
+	}
+	if n != numSamples {
+		t.Fatalf("expected %d samples, got %d", numSamples, n)
+	}
+}
+
+func TestWriterSchemaChange(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < 10; i++ {
+		doc := getTestSample(i)
+		if i >= 4 {
+			doc = append(doc, bson.E{Key: "extra", Value: int64(i)})
+		}
+		if err := w.WriteSample(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	blocks := 0
+	reader := NewReader(&buf)
+	if err := reader.ForEach(func(chunk *Chunk) error {
+		blocks++
+		if blocks == 1 && chunk.Data.NumDeltas != 3 {
+			t.Fatalf("expected 3 deltas, got %d", chunk.Data.NumDeltas)
+		} else if blocks == 2 && chunk.Data.DataPointsMap["extra"][5] != 9 {
+			t.Fatalf("expected 9, got %d", chunk.Data.DataPointsMap["extra"][5])
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if blocks != 2 {
+		t.Fatalf("expected 2 blocks, got %d", blocks)
+	}
+}
+
+func TestWriteMetricsData(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < 20; i++ {
+		w.WriteSample(getTestSample(i))
+	}
+	w.Close()
+	buffer := buf.Bytes()
+	m := NewMetrics()
+	if err := m.ReadAllMetrics(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	var copied bytes.Buffer
+	w = NewWriter(&copied)
+	if err := w.WriteMetricsData(m.Data[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), copied.Bytes()) {
+		t.Fatal("re-encoded chunk differs from original")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"html/template"
 	"os"
+	"path"
 	"sort"
 	"strings"
 	"time"
@@ -20,6 +21,7 @@ type DiagnosisRule struct {
 	Conditions  func(d *Diagnosis) bool
 	Symptoms    func(d *Diagnosis) []string
 	Suggestion  string
+	Metrics     []string // metrics or patterns of the score, optional
 }
 
 // DiagnosisResult holds a detected problem
@@ -33,39 +35,39 @@ type DiagnosisResult struct {
 // ActivitySummary holds key metrics that are always displayed
 type ActivitySummary struct {
 	// Operations per second
-	OpsQuery   float64
-	OpsInsert  float64
-	OpsUpdate  float64
-	OpsDelete  float64
-	OpsCommand float64
-	OpsTotal   float64
+	OpsQuery   float64 `json:"ops_query"`
+	OpsInsert  float64 `json:"ops_insert"`
+	OpsUpdate  float64 `json:"ops_update"`
+	OpsDelete  float64 `json:"ops_delete"`
+	OpsCommand float64 `json:"ops_command"`
+	OpsTotal   float64 `json:"ops_total"`
 
 	// Latencies in ms (p95)
-	LatencyRead    float64
-	LatencyWrite   float64
-	LatencyCommand float64
+	LatencyRead    float64 `json:"latency_read"`
+	LatencyWrite   float64 `json:"latency_write"`
+	LatencyCommand float64 `json:"latency_command"`
 
 	// Scan activity
-	ScanKeys     float64
-	ScanObjects  float64
-	DocsReturned float64
+	ScanKeys     float64 `json:"scan_keys"`
+	ScanObjects  float64 `json:"scan_objects"`
+	DocsReturned float64 `json:"docs_returned"`
 
 	// Resource utilization (percentages)
-	CPUUser     float64
-	CPUSystem   float64
-	CPUIdle     float64
-	MemResident float64 // percentage of total RAM
-	CacheUsed   float64 // percentage of WT cache
-	DiskUtil    float64 // max disk utilization
+	CPUUser     float64 `json:"cpu_user"`
+	CPUSystem   float64 `json:"cpu_system"`
+	CPUIdle     float64 `json:"cpu_idle"`
+	MemResident float64 `json:"mem_resident"` // percentage of total RAM
+	CacheUsed   float64 `json:"cache_used"`   // percentage of WT cache
+	DiskUtil    float64 `json:"disk_util"`    // max disk utilization
 
 	// Network
-	NetRequestsPerSec float64
-	NetInMBps         float64
-	NetOutMBps        float64
+	NetRequestsPerSec float64 `json:"net_requests_per_sec"`
+	NetInMBps         float64 `json:"net_in_mbps"`
+	NetOutMBps        float64 `json:"net_out_mbps"`
 
 	// Connections
-	ConnsActive  float64
-	ConnsCurrent float64
+	ConnsActive  float64 `json:"conns_active"`
+	ConnsCurrent float64 `json:"conns_current"`
 }
 
 // TimeRange represents a time period when an issue occurred
@@ -84,6 +86,7 @@ type AnomalyEvent struct {
 	Peak      float64
 	Threshold string
 	Severity  string // "critical", "warning", "info"
+	Kind      string // "threshold", "deviation" or "level_shift"
 }
 
 // Diagnosis analyzes FTDC data for problems
@@ -98,6 +101,11 @@ type Diagnosis struct {
 	results     []DiagnosisResult
 	summary     ActivitySummary
 	anomalies   []AnomalyEvent
+	rules       []DiagnosisRule
+	thresholds  []AnomalyThreshold
+	detector    AnomalyDetector
+	profile     *ScoringProfile
+	inputFiles  []InputFile
 }
 
 // NewDiagnosis creates a new diagnosis engine
@@ -110,6 +118,9 @@ func NewDiagnosis(stats FTDCStats, from, to time.Time) *Diagnosis {
 		metrics:     make(map[string]metricStats),
 		diskMetrics: make(map[string]map[string]metricStats),
 		replMetrics: make(map[string]metricStats),
+		rules:       DiagnosisRules,
+		thresholds:  DefaultAnomalyThresholds,
+		detector:    DefaultAnomalyDetector,
 	}
 	d.computeMetrics()
 	d.computeActivitySummary()
@@ -117,24 +128,40 @@ func NewDiagnosis(stats FTDCStats, from, to time.Time) *Diagnosis {
 	return d
 }
 
+// SetRules sets diagnosis rules, replacing DiagnosisRules
+func (d *Diagnosis) SetRules(rules []DiagnosisRule) { d.rules = rules }
+
+// SetAnomalyThresholds sets anomaly thresholds, replacing DefaultAnomalyThresholds, and
+// collects anomalies again
+func (d *Diagnosis) SetAnomalyThresholds(thresholds []AnomalyThreshold) {
+	d.thresholds = thresholds
+	d.collectAnomalies()
+}
+
+// SetAnomalyDetector sets the detector of deviations and level shifts, replacing
+// DefaultAnomalyDetector, and collects anomalies again
+func (d *Diagnosis) SetAnomalyDetector(detector AnomalyDetector) {
+	d.detector = detector.withDefaults()
+	d.collectAnomalies()
+}
+
+// SetScoringProfile sets watermarks of scores and computes metrics again
+func (d *Diagnosis) SetScoringProfile(profile *ScoringProfile) {
+	d.profile = profile
+	d.metrics = make(map[string]metricStats)
+	d.diskMetrics = make(map[string]map[string]metricStats)
+	d.replMetrics = make(map[string]metricStats)
+	d.computeMetrics()
+	d.computeActivitySummary()
+}
+
 // computeMetrics calculates p5/median/p95 for all metrics
 func (d *Diagnosis) computeMetrics() {
 	as := NewAssessment(d.stats)
+	as.SetScoringProfile(d.profile)
 
 	// Standard metrics
-	allMetrics := serverStatusChartsLegends
-	allMetrics = append(allMetrics, wiredTigerChartsLegends...)
-	allMetrics = append(allMetrics, queuesChartsLegends...)
-	allMetrics = append(allMetrics, transactionsChartsLegends...)
-	allMetrics = append(allMetrics, flowControlChartsLegends...)
-	allMetrics = append(allMetrics, replSetChartsLegends...)
-	for _, sm := range systemMetricsChartsLegends {
-		if strings.HasPrefix(sm, "cpu_") {
-			allMetrics = append(allMetrics, sm)
-		}
-	}
-
-	for _, metric := range allMetrics {
+	for _, metric := range getDiagnosisMetrics() {
 		m := as.getStatsArray(metric, d.from, d.to)
 		d.metrics[metric] = m
 	}
@@ -155,12 +182,29 @@ func (d *Diagnosis) computeMetrics() {
 	}
 
 	// tcmalloc fragmentation
-	if heap, ok := d.stats.TimeSeriesData["tcmalloc_heap"]; ok && len(heap.DataPoints) > 0 {
+	if heap, ok := d.stats.TimeSeriesData["tcmalloc_heap"]; ok && heap.Len() > 0 {
 		m := as.getTcmallocFragmentation(d.from, d.to)
 		d.metrics["tcmalloc_frag"] = m
 	}
 }
 
+// getDiagnosisMetrics returns standard metrics of diagnosis
+func getDiagnosisMetrics() []string {
+	var allMetrics []string
+	allMetrics = append(allMetrics, serverStatusChartsLegends...)
+	allMetrics = append(allMetrics, wiredTigerChartsLegends...)
+	allMetrics = append(allMetrics, queuesChartsLegends...)
+	allMetrics = append(allMetrics, transactionsChartsLegends...)
+	allMetrics = append(allMetrics, flowControlChartsLegends...)
+	allMetrics = append(allMetrics, replSetChartsLegends...)
+	for _, sm := range systemMetricsChartsLegends {
+		if strings.HasPrefix(sm, "cpu_") {
+			allMetrics = append(allMetrics, sm)
+		}
+	}
+	return allMetrics
+}
+
 // computeActivitySummary calculates the activity summary metrics
 func (d *Diagnosis) computeActivitySummary() {
 	// Operations (use median for typical activity)
@@ -225,42 +269,48 @@ func (d *Diagnosis) computeActivitySummary() {
 
 // AnomalyThreshold defines threshold for anomaly detection
 type AnomalyThreshold struct {
-	Metric    string
-	Threshold float64
-	Above     bool // true = anomaly when > threshold, false = anomaly when < threshold
-	Severity  string
-	Label     string
+	Metric    string  `json:"metric" yaml:"metric"` // name or pattern, e.g. disk_util_*
+	Threshold float64 `json:"threshold" yaml:"threshold"`
+	Above     bool    `json:"above" yaml:"above"` // true = anomaly when > threshold, false = anomaly when < threshold
+	Severity  string  `json:"severity" yaml:"severity"`
+	Label     string  `json:"label" yaml:"label"`
 }
 
-// collectAnomalies finds all anomaly events across metrics
-func (d *Diagnosis) collectAnomalies() {
-	thresholds := []AnomalyThreshold{
-		// Latency anomalies (above threshold is bad)
-		{"latency_read", 20, true, "warning", "> 20ms"},
-		{"latency_write", 20, true, "warning", "> 20ms"},
-		{"latency_command", 20, true, "warning", "> 20ms"},
+// DefaultAnomalyThresholds are thresholds of anomaly events
+var DefaultAnomalyThresholds = []AnomalyThreshold{
+	// Latency anomalies (above threshold is bad)
+	{"latency_read", 20, true, "warning", "> 20ms"},
+	{"latency_write", 20, true, "warning", "> 20ms"},
+	{"latency_command", 20, true, "warning", "> 20ms"},
 
-		// Scan anomalies (high scans indicate slow queries)
-		{"scan_keys", 100000, true, "warning", "> 100K/s"},
-		{"scan_objects", 100000, true, "warning", "> 100K/s"},
+	// Scan anomalies (high scans indicate slow queries)
+	{"scan_keys", 100000, true, "warning", "> 100K/s"},
+	{"scan_objects", 100000, true, "warning", "> 100K/s"},
 
-		// CPU anomalies
-		{"cpu_idle", 30, false, "warning", "< 30%"},  // low idle = high CPU
-		{"cpu_iowait", 15, true, "warning", "> 15%"}, // high iowait = disk bottleneck
+	// CPU anomalies
+	{"cpu_idle", 30, false, "warning", "< 30%"},  // low idle = high CPU
+	{"cpu_iowait", 15, true, "warning", "> 15%"}, // high iowait = disk bottleneck
 
-		// Memory/Cache anomalies (handled specially for percentages)
-		{"mem_page_faults", 20, true, "warning", "> 20/s"},
+	// Memory/Cache anomalies (handled specially for percentages)
+	{"mem_page_faults", 20, true, "warning", "> 20/s"},
 
-		// Queue anomalies
-		{"q_queued_read", 10, true, "warning", "> 10"},
-		{"q_queued_write", 10, true, "warning", "> 10"},
+	// Queue anomalies
+	{"q_queued_read", 10, true, "warning", "> 10"},
+	{"q_queued_write", 10, true, "warning", "> 10"},
 
-		// Replication
-		{"write_conflicts/s", 10, true, "warning", "> 10/s"},
-	}
+	// Replication
+	{"write_conflicts/s", 10, true, "warning", "> 10/s"},
+	{"repl_lag_*", 5, true, "critical", "> 5s"},
 
-	for _, t := range thresholds {
-		if data, ok := d.stats.TimeSeriesData[t.Metric]; ok {
+	// Disk utilization
+	{"disk_util_*", 70, true, "warning", "> 70%"},
+}
+
+// collectAnomalies finds all anomaly events across metrics
+func (d *Diagnosis) collectAnomalies() {
+	d.anomalies = nil
+	for _, t := range d.thresholds {
+		for metric, data := range d.getAnomalySeries(t.Metric) {
 			var ranges []TimeRange
 			if t.Above {
 				ranges = d.findExceedances(data, t.Threshold)
@@ -274,48 +324,26 @@ func (d *Diagnosis) collectAnomalies() {
 						Timestamp: r.Start,
 						EndTime:   r.End,
 						Duration:  r.End.Sub(r.Start),
-						Metric:    t.Metric,
+						Metric:    metric,
 						Peak:      r.Peak,
 						Threshold: t.Label,
 						Severity:  t.Severity,
+						Kind:      AnomalyThresholdKind,
 					})
 				}
 			}
 		}
 	}
 
-	// Disk utilization anomalies
-	for disk, stats := range d.stats.DiskStats {
-		ranges := d.findExceedances(stats.Utilization, 70) // > 70% disk util
-		for _, r := range ranges {
-			if r.End.Sub(r.Start) >= 10*time.Second {
-				d.anomalies = append(d.anomalies, AnomalyEvent{
-					Timestamp: r.Start,
-					EndTime:   r.End,
-					Duration:  r.End.Sub(r.Start),
-					Metric:    "disk_util_" + disk,
-					Peak:      r.Peak,
-					Threshold: "> 70%",
-					Severity:  "warning",
-				})
-			}
-		}
-	}
-
-	// Replication lag anomalies
-	for host, lagData := range d.stats.ReplicationLags {
-		ranges := d.findExceedances(lagData, 5) // > 5 seconds lag
-		for _, r := range ranges {
-			if r.End.Sub(r.Start) >= 10*time.Second {
-				d.anomalies = append(d.anomalies, AnomalyEvent{
-					Timestamp: r.Start,
-					EndTime:   r.End,
-					Duration:  r.End.Sub(r.Start),
-					Metric:    "repl_lag_" + host,
-					Peak:      r.Peak,
-					Threshold: "> 5s",
-					Severity:  "critical",
-				})
+	// Deviations from baselines and level shifts
+	if !d.detector.Disable {
+		detected := map[string]bool{}
+		for _, pattern := range d.detector.Metrics {
+			for metric, data := range d.getAnomalySeries(pattern) {
+				if !detected[metric] {
+					detected[metric] = true
+					d.anomalies = append(d.anomalies, d.detector.detect(metric, data)...)
+				}
 			}
 		}
 	}
@@ -326,20 +354,37 @@ func (d *Diagnosis) collectAnomalies() {
 	})
 }
 
+// getAnomalySeries returns time series matching a name or pattern, disks are disk_util_<disk>
+// and replication lags are repl_lag_<host>
+func (d *Diagnosis) getAnomalySeries(pattern string) map[string]TimeSeriesDoc {
+	series := map[string]TimeSeriesDoc{}
+	add := func(name string, data TimeSeriesDoc) {
+		if matched, _ := path.Match(pattern, name); matched {
+			series[name] = data
+		}
+	}
+	for name, data := range d.stats.TimeSeriesData {
+		add(name, data)
+	}
+	for disk, stats := range d.stats.DiskStats {
+		add("disk_util_"+disk, stats.Utilization)
+	}
+	for host, lagData := range d.stats.ReplicationLags {
+		add("repl_lag_"+host, lagData)
+	}
+	return series
+}
+
 // findBelowThreshold finds time ranges when metric was below threshold
 func (d *Diagnosis) findBelowThreshold(data TimeSeriesDoc, threshold float64) []TimeRange {
 	ranges := []TimeRange{}
-	if len(data.DataPoints) == 0 {
+	if data.Len() == 0 {
 		return ranges
 	}
 
 	var currentRange *TimeRange
-	for _, dp := range data.DataPoints {
-		if len(dp) < 2 {
-			continue
-		}
-		value := dp[0]
-		ts := time.Unix(0, int64(dp[1])*int64(time.Millisecond))
+	for i, value := range data.Values {
+		ts := time.Unix(0, int64(data.Times[i])*int64(time.Millisecond))
 
 		if value < threshold {
 			if currentRange == nil {
@@ -363,17 +408,13 @@ func (d *Diagnosis) findBelowThreshold(data TimeSeriesDoc, threshold float64) []
 // findExceedances finds time ranges when a metric exceeded a threshold
 func (d *Diagnosis) findExceedances(data TimeSeriesDoc, threshold float64) []TimeRange {
 	ranges := []TimeRange{}
-	if len(data.DataPoints) == 0 {
+	if data.Len() == 0 {
 		return ranges
 	}
 
 	var currentRange *TimeRange
-	for _, dp := range data.DataPoints {
-		if len(dp) < 2 {
-			continue
-		}
-		value := dp[0]
-		ts := time.Unix(0, int64(dp[1])*int64(time.Millisecond))
+	for i, value := range data.Values {
+		ts := time.Unix(0, int64(data.Times[i])*int64(time.Millisecond))
 
 		if value > threshold {
 			if currentRange == nil {
@@ -755,7 +796,7 @@ var DiagnosisRules = []DiagnosisRule{
 // Run executes all diagnosis rules
 func (d *Diagnosis) Run() []DiagnosisResult {
 	d.results = []DiagnosisResult{}
-	for _, rule := range DiagnosisRules {
+	for _, rule := range d.rules {
 		if rule.Conditions(d) {
 			symptoms := rule.Symptoms(d)
 			if len(symptoms) > 0 {
@@ -784,6 +825,16 @@ func (d *Diagnosis) Run() []DiagnosisResult {
 func (d *Diagnosis) calculateRuleScore(rule DiagnosisRule) int {
 	// Return worst score among related metrics
 	worst := 100
+	if len(rule.Metrics) > 0 {
+		for _, name := range rule.Metrics {
+			for _, m := range d.findMetrics(name) {
+				if m.score < worst {
+					worst = m.score
+				}
+			}
+		}
+		return worst
+	}
 	for name, m := range d.metrics {
 		if m.score < worst && m.score < 101 {
 			// Only count if metric name suggests relation to rule
@@ -1299,6 +1350,40 @@ func (d *Diagnosis) GenerateHTML(filename string) error {
         </div>
         {{end}}
 
+        {{if gt (len .MemberStates) 0}}
+        <div class="summary">
+            <h2>🗳 Member State Timeline</h2>
+            <p style="color: var(--text-secondary); margin-bottom: 1rem;">
+                Replica set member state transitions, a member becoming PRIMARY is an election.
+            </p>
+            <table class="timeline-table">
+                <thead>
+                    <tr>
+                        <th>Time</th>
+                        <th>Member</th>
+                        <th>From</th>
+                        <th>To</th>
+                        <th>Term</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .MemberStates}}
+                    <tr>
+                        <td>
+                            <span class="timeline-severity {{if .IsElection}}warning{{else}}info{{end}}"></span>
+                            {{.Date.Format "Jan 02 15:04:05"}}
+                        </td>
+                        <td class="timeline-metric">{{.Member}}</td>
+                        <td>{{.FromName}}</td>
+                        <td>{{.ToName}}</td>
+                        <td>{{.Term}}</td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+        </div>
+        {{end}}
+
         <footer>
             Generated by <a href="https://github.com/simagix/mongo-ftdc">mongo-ftdc</a> • {{.GeneratedAt}}
         </footer>
@@ -1315,6 +1400,7 @@ func (d *Diagnosis) GenerateHTML(filename string) error {
 		Results      []DiagnosisResult
 		Summary      ActivitySummary
 		Anomalies    []AnomalyEvent
+		MemberStates []MemberStateEvent
 		GeneratedAt  string
 	}{
 		FromTime:     d.from.Format("2006-01-02 15:04:05"),
@@ -1325,6 +1411,7 @@ func (d *Diagnosis) GenerateHTML(filename string) error {
 		Results:      d.results,
 		Summary:      d.summary,
 		Anomalies:    d.anomalies,
+		MemberStates: d.getMemberStates(),
 		GeneratedAt:  time.Now().Format("2006-01-02 15:04:05 MST"),
 	}
 
@@ -1368,6 +1455,22 @@ func (d *Diagnosis) GenerateHTML(filename string) error {
 	return t.Execute(f, data)
 }
 
+// getMemberStates returns member state transitions during the analysis period
+func (d *Diagnosis) getMemberStates() []MemberStateEvent {
+	events := []MemberStateEvent{}
+	for _, e := range d.stats.MemberStates {
+		if e.From >= 0 && !e.Date.Before(d.from) && !e.Date.After(d.to) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// GetAnomalies returns anomaly events sorted by time
+func (d *Diagnosis) GetAnomalies() []AnomalyEvent {
+	return d.anomalies
+}
+
 // GetResults returns the diagnosis results
 func (d *Diagnosis) GetResults() []DiagnosisResult {
 	return d.results
@@ -0,0 +1,146 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// diagnosis_report.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// DiagnosisReportVersion is the schema version of DiagnosisReport, fields may be added
+// within a major version but are never renamed or removed
+const DiagnosisReportVersion = "1.0"
+
+// Exit codes of the worst severity of results, apart from 1 of errors and 2 of flag usage
+const (
+	ExitCodeClean    = 0 // no results or info only
+	ExitCodeWarning  = 10
+	ExitCodeCritical = 11
+)
+
+// DiagnosisReport is a machine readable diagnosis
+type DiagnosisReport struct {
+	SchemaVersion string          `json:"schema_version"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+	Host          string          `json:"host"`
+	Version       string          `json:"version"` // MongoDB version
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	Severity      string          `json:"severity"` // worst severity of results, "none" if clean
+	ExitCode      int             `json:"exit_code"`
+	Inputs        []InputFile     `json:"inputs"`
+	Results       []ReportResult  `json:"results"`
+	Summary       ActivitySummary `json:"summary"`
+	Anomalies     []ReportAnomaly `json:"anomalies"`
+	Metrics       []ReportMetric  `json:"metrics"`
+}
+
+// InputFile is a FTDC file loaded
+type InputFile struct {
+	Host    string    `json:"host"`
+	Dir     string    `json:"dir"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ReportResult is a detected problem
+type ReportResult struct {
+	Rule        string   `json:"rule"`
+	Description string   `json:"description"`
+	Severity    string   `json:"severity"`
+	Score       int      `json:"score"`
+	Symptoms    []string `json:"symptoms"`
+	Suggestion  string   `json:"suggestion"`
+	Metrics     []string `json:"metrics,omitempty"`
+}
+
+// ReportAnomaly is a period of a metric beyond its threshold
+type ReportAnomaly struct {
+	Metric          string    `json:"metric"`
+	Severity        string    `json:"severity"`
+	Kind            string    `json:"kind"` // "threshold", "deviation" or "level_shift"
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Peak            float64   `json:"peak"`
+	Threshold       string    `json:"threshold"`
+}
+
+// ReportMetric is a score and stats of a metric, disks are iops_<disk> and disku_<disk>
+// and replication lags are repl_lag_<host>
+type ReportMetric struct {
+	Name   string  `json:"name"`
+	Score  int     `json:"score"` // 0-100, lower is worse
+	P5     float64 `json:"p5"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+}
+
+// SetInputFiles sets files of the report
+func (d *Diagnosis) SetInputFiles(files []InputFile) { d.inputFiles = files }
+
+// GetReport returns results of Run, anomalies and scores
+func (d *Diagnosis) GetReport() DiagnosisReport {
+	report := DiagnosisReport{SchemaVersion: DiagnosisReportVersion, GeneratedAt: time.Now().UTC(),
+		Host: d.stats.ServerInfo.HostInfo.System.Hostname, Version: d.stats.ServerInfo.BuildInfo.Version,
+		From: d.from, To: d.to, Severity: GetWorstSeverity(d.results), Inputs: d.inputFiles,
+		Results: []ReportResult{}, Summary: d.summary, Anomalies: []ReportAnomaly{}, Metrics: []ReportMetric{}}
+	report.ExitCode = GetSeverityExitCode(report.Severity)
+	if report.Inputs == nil {
+		report.Inputs = []InputFile{}
+	}
+	for _, r := range d.results {
+		report.Results = append(report.Results, ReportResult{Rule: r.Rule.Name, Description: r.Rule.Description,
+			Severity: r.Rule.Severity, Score: r.Score, Symptoms: r.Symptoms, Suggestion: r.Rule.Suggestion,
+			Metrics: r.Rule.Metrics})
+	}
+	for _, a := range d.anomalies {
+		report.Anomalies = append(report.Anomalies, ReportAnomaly{Metric: a.Metric, Severity: a.Severity, Kind: a.Kind,
+			Start: a.Timestamp, End: a.EndTime, DurationSeconds: a.Duration.Seconds(), Peak: a.Peak,
+			Threshold: a.Threshold})
+	}
+	for name, m := range d.getNamedMetrics() {
+		if m.score > 100 { // no data
+			continue
+		}
+		report.Metrics = append(report.Metrics, ReportMetric{Name: name, Score: m.score, P5: m.p5,
+			Median: m.median, P95: m.p95})
+	}
+	sort.Slice(report.Metrics, func(i, j int) bool { return report.Metrics[i].Name < report.Metrics[j].Name })
+	return report
+}
+
+// WriteJSON writes the report in JSON
+func (d *Diagnosis) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d.GetReport())
+}
+
+// GetWorstSeverity returns the worst severity of results, "none" if no results
+func GetWorstSeverity(results []DiagnosisResult) string {
+	severity := "none"
+	for _, r := range results {
+		if r.Rule.Severity == "critical" {
+			return r.Rule.Severity
+		} else if r.Rule.Severity == "warning" || (r.Rule.Severity == "info" && severity == "none") {
+			severity = r.Rule.Severity
+		}
+	}
+	return severity
+}
+
+// GetSeverityExitCode returns the exit code of a severity
+func GetSeverityExitCode(severity string) int {
+	switch severity {
+	case "critical":
+		return ExitCodeCritical
+	case "warning":
+		return ExitCodeWarning
+	}
+	return ExitCodeClean
+}
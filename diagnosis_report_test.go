@@ -0,0 +1,80 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// diagnosis_report_test.go
+
+package ftdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDiagnosisReport(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	d := getTestRulesDiagnosis()
+	d.from, d.to = start, start.Add(time.Hour)
+	d.stats.ServerInfo.HostInfo.System.Hostname = "shard01-a"
+	d.summary.LatencyWrite = 80
+	d.anomalies = []AnomalyEvent{{Timestamp: start, EndTime: start.Add(time.Minute), Duration: time.Minute,
+		Metric: "latency_write", Peak: 120, Threshold: "> 50ms", Severity: "critical"}}
+	d.SetInputFiles([]InputFile{{Host: "shard01-a", Dir: "/data/diagnostic.data", Name: "metrics.2020-05-13T14-20-00Z-00000", Size: 1024}})
+	d.SetRules([]DiagnosisRule{{Name: "Write SLO", Severity: "warning", Metrics: []string{"latency_write"},
+		Conditions: func(d *Diagnosis) bool { return true },
+		Symptoms:   func(d *Diagnosis) []string { return []string{"Write latency p95=80ms"} }}})
+	d.Run()
+
+	var buf bytes.Buffer
+	if err := d.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var report DiagnosisReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != DiagnosisReportVersion || report.Host != "shard01-a" || !report.From.Equal(start) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Severity != "warning" || report.ExitCode != ExitCodeWarning || len(report.Results) != 1 ||
+		report.Results[0].Score != 40 || report.Results[0].Symptoms[0] != "Write latency p95=80ms" {
+		t.Fatalf("unexpected results %+v", report.Results)
+	}
+	if len(report.Anomalies) != 1 || report.Anomalies[0].DurationSeconds != 60 || len(report.Inputs) != 1 {
+		t.Fatalf("unexpected anomalies %+v inputs %+v", report.Anomalies, report.Inputs)
+	}
+	// iops have no scores
+	if len(report.Metrics) != 6 || report.Metrics[0].Name != "disku_sda" || report.Metrics[5].Name != "wt_cache_dirty" {
+		t.Fatalf("unexpected metrics %+v", report.Metrics)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &doc)
+	if summary, ok := doc["summary"].(map[string]interface{}); !ok || summary["latency_write"] != 80. {
+		t.Fatalf("unexpected summary %v", doc["summary"])
+	}
+}
+
+func TestGetSeverityExitCode(t *testing.T) {
+	results := func(severities ...string) []DiagnosisResult {
+		var list []DiagnosisResult
+		for _, s := range severities {
+			list = append(list, DiagnosisResult{Rule: DiagnosisRule{Severity: s}})
+		}
+		return list
+	}
+	tests := []struct {
+		results  []DiagnosisResult
+		severity string
+		code     int
+	}{
+		{nil, "none", ExitCodeClean},
+		{results("info"), "info", ExitCodeClean},
+		{results("info", "warning", "info"), "warning", ExitCodeWarning},
+		{results("warning", "critical"), "critical", ExitCodeCritical},
+	}
+	for _, tc := range tests {
+		severity := GetWorstSeverity(tc.results)
+		if severity != tc.severity || GetSeverityExitCode(severity) != tc.code {
+			t.Fatalf("expected %v %v, got %v %v", tc.severity, tc.code, severity, GetSeverityExitCode(severity))
+		}
+	}
+}
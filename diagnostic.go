@@ -57,11 +57,19 @@ type ServerInfoDoc struct {
 
 // DiagnosticData -
 type DiagnosticData struct {
-	ServerInfo        interface{}
-	ServerStatusList  []ServerStatusDoc
-	ReplSetStatusList []ReplSetStatusDoc
-	SystemMetricsList []SystemMetricsDoc
-	endpoints         []string
+	ServerInfo          interface{}
+	ServerStatusList    []ServerStatusDoc   // of keyhole stats
+	ServerStatusColumns ServerStatusColumns // serverStatus samples of FTDC files
+	ReplSetStatusList   []ReplSetStatusDoc
+	SystemMetricsList   []SystemMetricsDoc
+	DecodeReports       []decoder.DecodeReport // files with chunks failed to decode
+	MemberStates        []MemberStateEvent     // replica set member states by sample
+	RawStore            *RawStore
+	endpoints           []string
+	from                time.Time // samples outside of from and to are skipped, zero is unbounded
+	keepRawValues       bool
+	preserveValues      bool
+	to                  time.Time
 }
 
 // DiagnosticDoc -
@@ -78,6 +86,15 @@ func NewDiagnosticData() *DiagnosticData {
 	return &DiagnosticData{ServerStatusList: []ServerStatusDoc{}, ReplSetStatusList: []ReplSetStatusDoc{}}
 }
 
+// SetPreserveValues keeps strings and float values of FTDC data
+func (d *DiagnosticData) SetPreserveValues(preserveValues bool) { d.preserveValues = preserveValues }
+
+// SetKeepRawValues keeps values of all metric paths for raw: queries
+func (d *DiagnosticData) SetKeepRawValues(keepRawValues bool) { d.keepRawValues = keepRawValues }
+
+// SetTimeRange loads samples within a time range only, zero from or to is unbounded
+func (d *DiagnosticData) SetTimeRange(from time.Time, to time.Time) { d.from, d.to = from, to }
+
 // GetEndPoints gets grafana uri
 func (d *DiagnosticData) GetEndPoints() []string {
 	return d.endpoints
@@ -90,20 +107,28 @@ func (d *DiagnosticData) DecodeDiagnosticData(filenames []string) error {
 	if err = d.readDiagnosticFiles(fnames); err != nil {
 		return err
 	}
+	d.summarize()
+	return nil
+}
+
+// summarize logs decoding errors and sets Grafana endpoints of decoded samples
+func (d *DiagnosticData) summarize() {
+	for _, report := range d.DecodeReports {
+		log.Println(report)
+		for _, e := range report.Errors {
+			log.Println(report.Filename, e)
+		}
+	}
 
-	if len(d.ServerStatusList) == 0 {
+	if from, to, ok := getServerStatusTimeRange(d.ServerStatusColumns, d.ServerStatusList); !ok {
 		log.Println("no server status found")
 		t := time.Now().Unix() * 1000
 		minute := int64(60) * 1000
 		d.endpoints = append(d.endpoints, fmt.Sprintf(analyticsEndpoint, t, t+(10*minute)))
 	} else {
-		fmt.Printf("\nStats from %v to %v\n", d.ServerStatusList[0].LocalTime.Format("2006-01-02T15:04:05Z"),
-			d.ServerStatusList[len(d.ServerStatusList)-1].LocalTime.Format("2006-01-02T15:04:05Z"))
-		d.endpoints = append(d.endpoints, fmt.Sprintf(analyticsEndpoint,
-			d.ServerStatusList[0].LocalTime.Unix()*1000,
-			d.ServerStatusList[len(d.ServerStatusList)-1].LocalTime.Unix()*1000))
+		fmt.Printf("\nStats from %v to %v\n", from.Format("2006-01-02T15:04:05Z"), to.Format("2006-01-02T15:04:05Z"))
+		d.endpoints = append(d.endpoints, fmt.Sprintf(analyticsEndpoint, from.Unix()*1000, to.Unix()*1000))
 	}
-	return nil
 }
 
 func (d *DiagnosticData) readDiagnosticDir(dirname string) error {
@@ -136,6 +161,9 @@ func (d *DiagnosticData) readDiagnosticFiles(filenames []string) error {
 		return errors.New("no valid data file found")
 	}
 	sort.Strings(filenames)
+	if !d.from.IsZero() || !d.to.IsZero() {
+		filenames = filterFilesByTime(filenames, d.from, d.to)
+	}
 	if strings.Contains(filenames[0], "keyhole_stats.") {
 		for _, filename := range filenames {
 			if err = d.analyzeServerStatusFromFile(filename); err != nil {
@@ -149,19 +177,10 @@ func (d *DiagnosticData) readDiagnosticFiles(filenames []string) error {
 	log.Printf("reading %d files with %d second(s) interval\n", len(filenames), 1)
 
 	// Use a slice instead of map to avoid race condition, protected by mutex
-	type fileResult struct {
-		filename string
-		data     DiagnosticData
-		err      error
-	}
-	results := make([]fileResult, 0, len(filenames))
+	results := make([]diagnosticResult, 0, len(filenames))
 	var mu sync.Mutex
 
-	nThreads := runtime.NumCPU() - 1
-	if nThreads < 1 {
-		nThreads = 1
-	}
-	var wg = gox.NewWaitGroup(nThreads)
+	var wg = gox.NewWaitGroup(getNumThreads())
 	for threadNum := 0; threadNum < len(filenames); threadNum++ {
 		filename := filenames[threadNum]
 		if !strings.Contains(filename, "metrics.") {
@@ -172,36 +191,57 @@ func (d *DiagnosticData) readDiagnosticFiles(filenames []string) error {
 			defer wg.Done()
 			diagData, ferr := d.readDiagnosticFile(filename)
 			mu.Lock()
-			results = append(results, fileResult{filename: filename, data: diagData, err: ferr})
+			results = append(results, diagnosticResult{filename: filename, data: diagData, err: ferr})
 			mu.Unlock()
 		}(filename)
 	}
 	wg.Wait()
+	err = d.mergeResults(results)
+	log.Println(len(filenames), "files loaded, time spent:", time.Since(btime))
+	return err
+}
+
+// diagnosticResult is decoded data of a metrics file
+type diagnosticResult struct {
+	filename string
+	data     DiagnosticData
+	err      error
+}
+
+// getNumThreads returns number of files to decode in parallel
+func getNumThreads() int {
+	nThreads := runtime.NumCPU() - 1
+	if nThreads < 1 {
+		nThreads = 1
+	}
+	return nThreads
+}
 
+// mergeResults merges decoded data of metrics files in filename order
+func (d *DiagnosticData) mergeResults(results []diagnosticResult) error {
+	var err error
 	// Sort by filename to ensure consistent ordering
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].filename < results[j].filename
 	})
 
 	// Pre-calculate total sizes for pre-allocation
-	totalServerStatus := 0
 	totalSystemMetrics := 0
 	totalReplSetStatus := 0
 	for _, r := range results {
 		if r.err != nil {
 			continue
 		}
-		totalServerStatus += len(r.data.ServerStatusList)
 		totalSystemMetrics += len(r.data.SystemMetricsList)
 		totalReplSetStatus += len(r.data.ReplSetStatusList)
 	}
 
 	// Pre-allocate slices
-	d.ServerStatusList = make([]ServerStatusDoc, 0, totalServerStatus)
 	d.SystemMetricsList = make([]SystemMetricsDoc, 0, totalSystemMetrics)
 	d.ReplSetStatusList = make([]ReplSetStatusDoc, 0, totalReplSetStatus)
 
 	// Merge results
+	d.RawStore = NewRawStore()
 	for _, r := range results {
 		if r.err != nil {
 			err = r.err
@@ -210,63 +250,144 @@ func (d *DiagnosticData) readDiagnosticFiles(filenames []string) error {
 		if r.data.ServerInfo != nil {
 			d.ServerInfo = r.data.ServerInfo
 		}
-		d.ServerStatusList = append(d.ServerStatusList, r.data.ServerStatusList...)
+		if n := d.ServerStatusColumns.Len(); n > 0 && isInterimFile(r.filename) {
+			r.data.keepAfter(d.ServerStatusColumns.GetTime(n - 1)) // merge after the last archived sample
+		}
+		d.ServerStatusColumns.appendFrom(r.data.ServerStatusColumns, 0)
 		d.SystemMetricsList = append(d.SystemMetricsList, r.data.SystemMetricsList...)
 		d.ReplSetStatusList = append(d.ReplSetStatusList, r.data.ReplSetStatusList...)
+		d.DecodeReports = append(d.DecodeReports, r.data.DecodeReports...)
+		d.MemberStates = append(d.MemberStates, r.data.MemberStates...)
+		d.RawStore.merge(r.data.RawStore)
 	}
-	log.Println(len(filenames), "files loaded, time spent:", time.Since(btime))
 	return err
 }
 
-// readDiagnosticFile reads diagnostic.data from a file
+// keepAfter removes samples at or before a time, e.g. of metrics.interim archived already
+func (d *DiagnosticData) keepAfter(t time.Time) {
+	cols := d.ServerStatusColumns
+	i := sort.Search(cols.Len(), func(i int) bool { return cols.GetTime(i).After(t) })
+	d.ServerStatusColumns = cols.slice(i)
+	if i > len(d.SystemMetricsList) { // samples of both are in the same order
+		i = len(d.SystemMetricsList)
+	}
+	d.SystemMetricsList = d.SystemMetricsList[i:]
+	var replSetStatusList []ReplSetStatusDoc
+	for _, doc := range d.ReplSetStatusList {
+		if doc.Date.After(t) {
+			replSetStatusList = append(replSetStatusList, doc)
+		}
+	}
+	d.ReplSetStatusList = replSetStatusList
+	var memberStates []MemberStateEvent
+	for _, e := range d.MemberStates {
+		if e.Date.After(t) {
+			memberStates = append(memberStates, e)
+		}
+	}
+	d.MemberStates = memberStates
+}
+
+// readDiagnosticFile reads diagnostic.data from a file, one chunk at a time
 func (d *DiagnosticData) readDiagnosticFile(filename string) (DiagnosticData, error) {
-	btm := time.Now()
-	var diagData = DiagnosticData{}
-	var buffer []byte
 	var err error
+	var file *os.File
 	var r *bufio.Reader
 
-	if r, err = gox.NewFileReader(filename); err != nil {
-		return diagData, err
-	}
-	if buffer, err = io.ReadAll(r); err != nil {
-		return diagData, err
+	if file, err = os.Open(filename); err != nil {
+		return DiagnosticData{}, err
 	}
-
-	metrics := decoder.NewMetrics()
-	metrics.ReadAllMetrics(&buffer)
-	diagData.ServerInfo = metrics.Doc
-
-	// Pre-calculate total capacity needed
-	totalDeltas := 0
-	for _, v := range metrics.Data {
-		totalDeltas += int(v.NumDeltas)
+	defer file.Close()
+	if r, err = gox.NewReader(file); err != nil {
+		return DiagnosticData{}, err
 	}
+	return d.readDiagnosticStream(filename, r), nil
+}
 
-	// Pre-allocate slices
-	diagData.ServerStatusList = make([]ServerStatusDoc, 0, totalDeltas)
-	diagData.SystemMetricsList = make([]SystemMetricsDoc, 0, totalDeltas)
-	diagData.ReplSetStatusList = make([]ReplSetStatusDoc, 0, len(metrics.Data))
-
-	for _, v := range metrics.Data {
-		var doc DiagnosticDoc
-		bson.Unmarshal(v.Block, &doc) // first document
-		diagData.ReplSetStatusList = append(diagData.ReplSetStatusList, doc.ReplSetGetStatus)
-		attrib := NewAttribs(&v.DataPointsMap)
-		for i := 0; i < int(v.NumDeltas); i++ {
-			ss := attrib.GetServerStatusDataPoints(i)
-			diagData.ServerStatusList = append(diagData.ServerStatusList, ss)
-			sm := attrib.GetSystemMetricsDataPoints(i)
-			diagData.SystemMetricsList = append(diagData.SystemMetricsList, sm)
-		}
+// readDiagnosticStream decodes metrics from a reader, e.g. an archive member
+func (d *DiagnosticData) readDiagnosticStream(filename string, r io.Reader) DiagnosticData {
+	btm := time.Now()
+	var diagData = DiagnosticData{RawStore: NewRawStore(), from: d.from, keepRawValues: d.keepRawValues, to: d.to}
+	var err error
+	reader := decoder.NewReader(r)
+	reader.SetPreserveValues(d.preserveValues)
+	reader.SetTimeRange(d.from, d.to)
+	if err = diagData.readChunks(reader, isInterimFile(filename)); err != nil {
+		log.Println(filepath.Base(filename), err)
 	}
 
 	filename = filepath.Base(filename)
+	report := reader.Report()
+	report.Filename = filename
+	if err != nil { // the stream failed, samples after the offset are missing
+		report.Errors = append(report.Errors, decoder.DecodeError{Offset: reader.Offset(), Reason: err.Error(), Err: err})
+	}
+	if len(report.Errors) > 0 {
+		diagData.DecodeReports = append(diagData.DecodeReports, report)
+	}
+	blocks := report.Decoded
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 	mem := fmt.Sprintf("Memory Alloc = %v MiB, TotalAlloc = %v MiB", m.Alloc/(1024*1024), m.TotalAlloc/(1024*1024))
-	log.Println(filename, "blocks:", len(metrics.Data), ", time:", time.Since(btm), mem)
-	return diagData, err
+	log.Println(filename, "blocks:", blocks, ", time:", time.Since(btm), mem)
+	return diagData
+}
+
+// readChunks adds metadata and metrics of all chunks from a reader, interim is true of
+// metrics.interim
+func (d *DiagnosticData) readChunks(reader *decoder.Reader, interim bool) error {
+	return reader.ForEach(func(chunk *decoder.Chunk) error {
+		if chunk.Type == 0 {
+			d.ServerInfo = chunk.Doc
+			return nil
+		}
+		d.addMetricsData(chunk.Data, interim)
+		return nil
+	})
+}
+
+// addMetricsData converts a decoded metrics chunk to stats docs. The last sample of an
+// archived chunk is skipped, but not of the interim chunk; it's the latest sample captured
+// by mongod, e.g. right before a crash.
+func (d *DiagnosticData) addMetricsData(v *decoder.MetricsData, interim bool) {
+	var doc DiagnosticDoc
+	bson.Unmarshal(v.Block, &doc) // first document
+	if doc.ReplSetGetStatus.Date.IsZero() || d.isInRange(doc.ReplSetGetStatus.Date) {
+		d.ReplSetStatusList = append(d.ReplSetStatusList, doc.ReplSetGetStatus)
+	}
+	for _, e := range getMemberStateEvents(v, doc.ReplSetGetStatus) {
+		if d.isInRange(e.Date) {
+			d.MemberStates = append(d.MemberStates, e)
+		}
+	}
+	attrib := NewAttribsFromMetricsData(v)
+	numSamples := int(v.NumDeltas)
+	if interim {
+		numSamples++
+	}
+	label := ServerStatusLabel{Host: attrib.GetString("serverStatus/host"), Process: attrib.GetString("serverStatus/process"),
+		Version: attrib.GetString("serverStatus/version")}
+	if label.Version == "" { // strings are from the reference document
+		label = ServerStatusLabel{Host: doc.ServerStatus.Host, Process: doc.ServerStatus.Process, Version: doc.ServerStatus.Version}
+	}
+	samples := make([]int, 0, numSamples)
+	for i := 0; i < numSamples; i++ {
+		if !d.isInRange(time.Unix(0, int64(time.Millisecond)*int64(attrib.get(localTimePath, i)))) { // trim samples at the edges
+			continue
+		}
+		samples = append(samples, i)
+		sm := attrib.GetSystemMetricsDataPoints(i)
+		d.SystemMetricsList = append(d.SystemMetricsList, sm)
+	}
+	d.ServerStatusColumns.add(v, samples, label) // serverStatus docs are not materialized
+	if d.RawStore != nil {
+		d.RawStore.add(v, samples, d.keepRawValues)
+	}
+}
+
+// isInRange returns true if a time is within the time range
+func (d *DiagnosticData) isInRange(t time.Time) bool {
+	return (d.from.IsZero() || !t.Before(d.from)) && (d.to.IsZero() || !t.After(d.to))
 }
 
 // analyzeServerStatus analyzes serverStatus from a file
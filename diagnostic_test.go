@@ -4,9 +4,19 @@
 package ftdc
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const DiagnosticDataDirectory = "testdata"
@@ -33,3 +43,160 @@ func TestReadDiagnosticFiles(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// getTestSample returns a serverStatus sample of i seconds after start
+func getTestSample(start time.Time, i int) bson.D {
+	tm := start.Add(time.Duration(i) * time.Second)
+	return bson.D{
+		{Key: "start", Value: primitive.NewDateTimeFromTime(tm)},
+		{Key: "serverStatus", Value: bson.D{
+			{Key: "host", Value: "localhost"},
+			{Key: "version", Value: "7.0.2"},
+			{Key: "process", Value: "mongod"},
+			{Key: "uptime", Value: float64(1000 + i)},
+			{Key: "localTime", Value: primitive.NewDateTimeFromTime(tm)},
+			{Key: "connections", Value: bson.D{{Key: "current", Value: int32(10 + i%3)}}},
+			{Key: "mem", Value: bson.D{{Key: "resident", Value: int32(1024)}, {Key: "virtual", Value: int32(2048)}}},
+			{Key: "opcounters", Value: bson.D{
+				{Key: "insert", Value: int64(10 * i)},
+				{Key: "query", Value: int64(20 * i)},
+				{Key: "update", Value: int64(0)},
+			}},
+		}},
+		{Key: "systemMetrics", Value: bson.D{
+			{Key: "cpu", Value: bson.D{{Key: "user_ms", Value: int64(100 * i)}, {Key: "idle_ms", Value: int64(900 * i)}}},
+		}},
+		{Key: "end", Value: primitive.NewDateTimeFromTime(tm)},
+	}
+}
+
+// testFileOptions are options of writeTestFile
+type testFileOptions struct {
+	maxSamples int                                 // samples of a chunk, the writer default if 0
+	sample     func(start time.Time, i int) bson.D // getTestSample if nil
+	append     bool                                // appends samples to an existing file
+}
+
+// writeTestFile writes numSamples samples to a FTDC file, hostInfo is omitted if hostname is empty
+func writeTestFile(t testing.TB, filename string, hostname string, start time.Time, numSamples int, options ...testFileOptions) {
+	var opts testFileOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.sample == nil {
+		opts.sample = getTestSample
+	}
+	var file *os.File
+	var err error
+	if opts.append {
+		file, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	} else if err = os.MkdirAll(filepath.Dir(filename), 0755); err == nil {
+		file, err = os.Create(filename)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := decoder.NewWriter(file)
+	if opts.maxSamples > 0 {
+		w.SetMaxSamples(opts.maxSamples)
+	}
+	if hostname != "" {
+		w.WriteMetadata(bson.D{{Key: "hostInfo", Value: bson.D{{Key: "system", Value: bson.D{
+			{Key: "hostname", Value: hostname}, {Key: "numCores", Value: int32(4)}, {Key: "memSizeMB", Value: int32(8192)}}}}}})
+	}
+	for i := 0; i < numSamples; i++ {
+		if err = w.WriteSample(opts.sample(start, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestStats returns stats of n samples of a mongod, one per second from start, with series
+// of values by index
+func newTestStats(start time.Time, n int, series map[string]func(i int) float64) FTDCStats {
+	cols := ServerStatusColumns{Labels: []ServerStatusLabel{{Host: "localhost", Process: "mongod", Version: "7.0.2"}},
+		Values: map[string][]uint64{localTimePath: make([]uint64, n), uptimePath: make([]uint64, n)}}
+	legends := make([]string, 0, len(series))
+	for legend := range series {
+		legends = append(legends, legend)
+	}
+	docs := initTimeSeriesMap(legends, n)
+	times := make([]float64, n)
+	for i := 0; i < n; i++ {
+		tm := start.Add(time.Duration(i) * time.Second)
+		cols.Values[localTimePath][i] = uint64(toMillis(tm))
+		cols.Values[uptimePath][i] = uint64(1000 + i)
+		times[i] = float64(toMillis(tm))
+		for legend, value := range series {
+			docs[legend].add(value(i))
+		}
+	}
+	setTimes(docs, times)
+	return FTDCStats{ServerStatusColumns: cols, TimeSeriesData: toValueMap(docs)}
+}
+
+func TestReadInterimFile(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	dir := filepath.Join(t.TempDir(), "diagnostic.data")
+	writeTestFile(t, filepath.Join(dir, "metrics.2020-05-13T14-20-00Z-00000"), "node1", start, 30)
+
+	// samples 25 to 44, 25 to 29 are archived already
+	var buf strings.Builder
+	w := decoder.NewWriter(&buf)
+	for i := 25; i < 45; i++ {
+		w.WriteSample(getTestSample(start, i))
+	}
+	w.Close()
+	interim := buf.String() + strings.Repeat("\x00", 8)
+	if err := os.WriteFile(filepath.Join(dir, "metrics.interim"), []byte(interim), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDiagnosticData()
+	d.SetKeepRawValues(true)
+	if err := d.DecodeDiagnosticData([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.DecodeReports) != 0 {
+		t.Fatalf("unexpected errors %v", d.DecodeReports)
+	}
+	cols := d.ServerStatusColumns
+	if n := cols.Len(); n != 45 || !cols.GetTime(n-1).Equal(start.Add(44*time.Second)) {
+		t.Fatalf("expected 45 samples to %v, got %v", start.Add(44*time.Second), n)
+	}
+	for i := 1; i < cols.Len(); i++ {
+		if !cols.GetTime(i).After(cols.GetTime(i - 1)) {
+			t.Fatalf("unexpected sample at %v after %v", cols.GetTime(i), cols.GetTime(i-1))
+		}
+	}
+	if len(d.SystemMetricsList) != 45 || len(d.RawStore.Chunks) != 2 ||
+		d.RawStore.Chunks[1].Times[0] != float64(start.Add(29*time.Second).UnixMilli()) {
+		t.Fatalf("unexpected raw chunks %v", len(d.RawStore.Chunks))
+	}
+}
+
+func TestReadDiagnosticStreamErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, filename, "rs-a", time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC), 100)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, r := range map[string]io.Reader{
+		"truncated":  bytes.NewReader(data[:len(data)-10]),
+		"unreadable": io.MultiReader(bytes.NewReader(data[:len(data)/2]), iotest.ErrReader(errors.New("read failed"))),
+	} {
+		diag := NewDiagnosticData().readDiagnosticStream(filename, r)
+		if len(diag.DecodeReports) != 1 || len(diag.DecodeReports[0].Errors) == 0 || diag.DecodeReports[0].Filename != filepath.Base(filename) {
+			t.Fatalf("expected a decode error of %v stream, got %v", name, diag.DecodeReports)
+		}
+	}
+	diag := NewDiagnosticData().readDiagnosticStream(filename, bytes.NewReader(data))
+	if len(diag.DecodeReports) != 0 {
+		t.Fatalf("unexpected errors %v", diag.DecodeReports)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// export_table.go
+
+package ftdc
+
+import (
+	"encoding/csv"
+	"io"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportTable is a wide table of metrics, a row per timestamp and a column per metric
+type ExportTable struct {
+	Columns []string
+	Times   []int64     // milliseconds since epoch
+	Values  [][]float64 // by column, NaN if a metric has no value at a time
+}
+
+// NewExportTable returns *ExportTable of metrics within a time range. A metric is a
+// TimeSeriesData name, a name pattern, or a raw: query; "all" selects all TimeSeriesData.
+// Columns are suffixed with @host if there are multiple hosts. Zero from or to is unbounded.
+func NewExportTable(stats map[string]FTDCStats, metrics []string, from time.Time, to time.Time) *ExportTable {
+	var hosts []string
+	for host := range stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var columns []string
+	var series []TimeSeriesDoc
+	for _, host := range hosts {
+		for _, doc := range getExportDocs(stats[host], metrics) {
+			name := doc.Target
+			if len(hosts) > 1 {
+				name += HostSeparator + host
+			}
+			columns = append(columns, name)
+			series = append(series, doc)
+		}
+	}
+
+	inRange := func(ms int64) bool {
+		return (from.IsZero() || ms >= from.UnixMilli()) && (to.IsZero() || ms <= to.UnixMilli())
+	}
+	rows := map[int64]int{}
+	table := &ExportTable{Columns: columns}
+	for _, doc := range series {
+		for _, t := range doc.Times {
+			if ms := int64(t); inRange(ms) {
+				rows[ms] = 0
+			}
+		}
+	}
+	for ms := range rows {
+		table.Times = append(table.Times, ms)
+	}
+	sort.Slice(table.Times, func(i, j int) bool { return table.Times[i] < table.Times[j] })
+	for i, ms := range table.Times {
+		rows[ms] = i
+	}
+	for _, doc := range series {
+		values := make([]float64, len(table.Times))
+		for i := range values {
+			values[i] = math.NaN()
+		}
+		for j, t := range doc.Times {
+			if i, ok := rows[int64(t)]; ok {
+				values[i] = doc.Values[j]
+			}
+		}
+		table.Values = append(table.Values, values)
+	}
+	return table
+}
+
+// getExportDocs returns time series of selected metrics in order of selection
+func getExportDocs(ftdc FTDCStats, metrics []string) []TimeSeriesDoc {
+	var names []string
+	for name := range ftdc.TimeSeriesData {
+		if name != "replication_lags" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var docs []TimeSeriesDoc
+	added := map[string]bool{}
+	for _, metric := range metrics {
+		metric = strings.TrimSpace(metric)
+		if IsRawTarget(metric) {
+			if !ftdc.RawStore.HasValues() {
+				log.Println(metric, ErrRawValuesNotKept)
+				continue
+			}
+			docs = append(docs, ftdc.RawStore.GetTimeSeriesDocs(metric)...)
+			continue
+		}
+		for _, name := range names {
+			matched, _ := path.Match(metric, name)
+			if (metric == "all" || matched) && !added[name] {
+				added[name] = true
+				docs = append(docs, ftdc.TimeSeriesData[name])
+			}
+		}
+	}
+	return docs
+}
+
+// WriteCSV writes the table with a header, timestamps are in RFC3339 and missing values are empty
+func (t *ExportTable) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"timestamp"}, t.Columns...)); err != nil {
+		return err
+	}
+	record := make([]string, len(t.Columns)+1)
+	for i, ms := range t.Times {
+		record[0] = time.UnixMilli(ms).UTC().Format("2006-01-02T15:04:05.000Z")
+		for j, values := range t.Values {
+			record[j+1] = ""
+			if !math.IsNaN(values[i]) {
+				record[j+1] = strconv.FormatFloat(values[i], 'f', -1, 64)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,172 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// export_table_test.go
+
+package ftdc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestExportTable() *ExportTable {
+	ms := 1589379619000.0
+	stats := map[string]FTDCStats{"shard01-a": {TimeSeriesData: map[string]TimeSeriesDoc{
+		"conns_created/s": NewTimeSeriesDoc("conns_created/s", [][]float64{{1.5, ms}, {2, ms + 1000}, {3, ms + 2000}}),
+		"ops_query":       NewTimeSeriesDoc("ops_query", [][]float64{{12, ms + 1000}}),
+		"ops_insert":      NewTimeSeriesDoc("ops_insert", [][]float64{{7, ms}}),
+	}}}
+	return NewExportTable(stats, []string{"ops_*", "conns_created/s"}, time.Time{}, time.UnixMilli(int64(ms)+1000))
+}
+
+func TestExportTableCSV(t *testing.T) {
+	table := getTestExportTable()
+	if strings.Join(table.Columns, ",") != "ops_insert,ops_query,conns_created/s" || len(table.Times) != 2 {
+		t.Fatalf("unexpected table %v %v", table.Columns, table.Times)
+	}
+	var buf bytes.Buffer
+	if err := table.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "timestamp,ops_insert,ops_query,conns_created/s\n" +
+		"2020-05-13T14:20:19.000Z,7,,1.5\n" +
+		"2020-05-13T14:20:20.000Z,,12,2\n"
+	if buf.String() != expected {
+		t.Fatalf("expected\n%v, got\n%v", expected, buf.String())
+	}
+}
+
+func TestExportTableParquet(t *testing.T) {
+	table := getTestExportTable()
+	var buf bytes.Buffer
+	if err := table.WriteParquet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing magic number")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := readTestThriftStruct(data[len(data)-8-size : len(data)-8])
+	if meta.bytes != size || meta.fields[3] != int64(2) {
+		t.Fatalf("unexpected file metadata %v", meta.fields)
+	}
+	schema := meta.fields[2].([]interface{})
+	if len(schema) != 5 || string(schema[4].(testThriftStruct).fields[4].([]byte)) != "conns_created/s" {
+		t.Fatalf("unexpected schema %v", schema)
+	}
+	rowGroup := meta.fields[4].([]interface{})[0].(testThriftStruct)
+	columns := rowGroup.fields[1].([]interface{})
+	var values [][]float64
+	for _, c := range columns {
+		offset := c.(testThriftStruct).fields[2].(int64)
+		header := readTestThriftStruct(data[offset:])
+		page := data[int(offset)+header.bytes:]
+		page = page[:header.fields[2].(int64)]
+		if len(values) == 0 { // timestamp
+			values = append(values, []float64{float64(binary.LittleEndian.Uint64(page)), float64(binary.LittleEndian.Uint64(page[8:]))})
+			continue
+		}
+		var list []float64
+		levels := page[4 : 4+binary.LittleEndian.Uint32(page)]
+		page = page[4+len(levels):]
+		for len(levels) > 0 {
+			n, k := binary.Uvarint(levels)
+			defined := levels[k] == 1
+			levels = levels[k+1:]
+			for i := 0; i < int(n>>1); i++ {
+				v := math.NaN()
+				if defined {
+					v = math.Float64frombits(binary.LittleEndian.Uint64(page))
+					page = page[8:]
+				}
+				list = append(list, v)
+			}
+		}
+		values = append(values, list)
+	}
+	if len(values) != 4 || values[0][1] != 1589379620000 || values[1][0] != 7 || !math.IsNaN(values[1][1]) || values[3][1] != 2 {
+		t.Fatalf("unexpected values %v", values)
+	}
+}
+
+// TestExportTableParquetGolden compares output with testdata/export_table.parquet, which was read
+// with Apache Arrow Go v18 (parquet/pqarrow) as timestamp[ms, tz=UTC] [1589379619000 1589379620000],
+// ops_insert [7 null], ops_query [null 12] and conns_created/s [1.5 2]
+func TestExportTableParquetGolden(t *testing.T) {
+	golden, err := os.ReadFile("testdata/export_table.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = getTestExportTable().WriteParquet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Fatalf("expected %d bytes of testdata/export_table.parquet, got %d bytes of a different file", len(golden), buf.Len())
+	}
+}
+
+type testThriftStruct struct {
+	bytes  int
+	fields map[int]interface{}
+}
+
+// readTestThriftStruct decodes a thrift compact struct, supporting i32, i64, binary, list and struct
+func readTestThriftStruct(data []byte) testThriftStruct {
+	ts := testThriftStruct{fields: map[int]interface{}{}}
+	pos, id := 0, 0
+	var readValue func(typ byte) interface{}
+	readValue = func(typ byte) interface{} {
+		switch typ {
+		case thriftI32, thriftI64:
+			v, n := binary.Varint(data[pos:])
+			pos += n
+			return v
+		case thriftBinary:
+			size, n := binary.Uvarint(data[pos:])
+			pos += n + int(size)
+			return data[pos-int(size) : pos]
+		case thriftList:
+			header := data[pos]
+			pos++
+			size := int(header >> 4)
+			if size == 15 {
+				s, n := binary.Uvarint(data[pos:])
+				pos += n
+				size = int(s)
+			}
+			var list []interface{}
+			for i := 0; i < size; i++ {
+				list = append(list, readValue(header&0x0f))
+			}
+			return list
+		case thriftStruct:
+			s := readTestThriftStruct(data[pos:])
+			pos += s.bytes
+			return s
+		}
+		panic("unsupported type")
+	}
+	for {
+		b := data[pos]
+		pos++
+		if b == 0 {
+			break
+		}
+		if b>>4 == 0 {
+			v, n := binary.Varint(data[pos:])
+			pos += n
+			id = int(v)
+		} else {
+			id += int(b >> 4)
+		}
+		ts.fields[id] = readValue(b & 0x0f)
+	}
+	ts.bytes = pos
+	return ts
+}
@@ -0,0 +1,224 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// follower.go
+
+package ftdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+)
+
+// Follower watches a loaded diagnostic.data directory and merges new samples
+type Follower struct {
+	dir      string
+	host     string
+	interval time.Duration
+	metrics  *Metrics
+	modTimes map[string]time.Time // of metrics.interim, rewritten by mongod
+	offsets  map[string]int64     // bytes decoded of archived metrics files
+}
+
+// NewFollower returns *Follower of a directory loaded by ProcessFiles, files are
+// followed from their current ends
+func NewFollower(m *Metrics, dir string) (*Follower, error) {
+	host, ok := m.getDirHost(dir)
+	if !ok {
+		return nil, errors.New(dir + " is not loaded")
+	}
+	f := &Follower{dir: dir, host: host, interval: 5 * time.Second, metrics: m,
+		modTimes: map[string]time.Time{}, offsets: map[string]int64{}}
+	for _, filename := range f.getFilenames() {
+		if isInterimFile(filename) {
+			if fi, err := os.Stat(filename); err == nil {
+				f.modTimes[filename] = fi.ModTime()
+			}
+		} else if f.offsets[filename], ok = getCompleteSize(filename); !ok {
+			log.Println("failed to scan", filename)
+		}
+	}
+	return f, nil
+}
+
+// SetInterval sets polling interval
+func (f *Follower) SetInterval(interval time.Duration) { f.interval = interval }
+
+// Run polls until stop is closed
+func (f *Follower) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n, err := f.Poll()
+			if err != nil {
+				log.Println("follow", f.dir, err)
+			} else if n > 0 && f.metrics.verbose {
+				log.Println("follow", f.host, n, "new sample(s)")
+			}
+		}
+	}
+}
+
+// Poll decodes new chunks of grown or new files and merges them, series are appended with
+// new samples only. It returns number of new samples.
+func (f *Follower) Poll() (int, error) {
+	diag := NewDiagnosticData()
+	diag.SetPreserveValues(f.metrics.preserveValues)
+	diag.SetKeepRawValues(f.metrics.keepRawValues)
+	diag.SetTimeRange(f.metrics.from, f.metrics.to)
+	diag.RawStore = NewRawStore()
+	for _, filename := range f.getFilenames() {
+		fi, err := os.Stat(filename)
+		if err != nil { // rotated
+			continue
+		}
+		if isInterimFile(filename) {
+			if fi.ModTime().Equal(f.modTimes[filename]) {
+				continue
+			}
+			f.modTimes[filename] = fi.ModTime()
+			if _, err = diag.readFileFrom(filename, 0); err != nil {
+				return 0, err
+			}
+		} else if offset := f.offsets[filename]; fi.Size() > offset {
+			n, err := diag.readFileFrom(filename, offset)
+			if err != nil {
+				return 0, err
+			}
+			f.offsets[filename] = offset + n
+		}
+	}
+	if diag.ServerStatusColumns.Len() == 0 && diag.ServerInfo == nil {
+		return 0, nil
+	}
+	m := f.metrics
+	m.Lock()
+	ftdc := m.getHostStats(f.host)
+	before := ftdc.ServerStatusColumns.Len()
+	m.appendFTDCDetailStats(ftdc, diag)
+	n := ftdc.ServerStatusColumns.Len() - before
+	m.Unlock()
+	return n, nil
+}
+
+// appendFTDCDetailStats merges diagnostic data into stats and computes series of new samples
+// only, from the last sample before them for deltas, the caller holds the lock
+func (m *Metrics) appendFTDCDetailStats(ftdc *FTDCStats, diag *DiagnosticData) {
+	if ftdc.TimeSeriesData == nil {
+		m.mergeFTDCDetailStats(ftdc, diag)
+		return
+	}
+	previous := func(n int) int {
+		if n > 0 {
+			return n - 1
+		}
+		return 0
+	}
+	nreplset, nsystem, nstatus := len(ftdc.ReplSetStatusList), len(ftdc.SystemMetricsList), ftdc.ServerStatusColumns.Len()
+	m.mergeDiagnosticData(ftdc, diag)
+	tail := FTDCStats{ReplSetLegends: ftdc.ReplSetLegends,
+		ReplSetStatusList:   ftdc.ReplSetStatusList[previous(nreplset):],
+		ServerStatusColumns: ftdc.ServerStatusColumns.slice(previous(nstatus)),
+		SystemMetricsList:   ftdc.SystemMetricsList[previous(nsystem):]}
+	m.setTimeSeriesData(&tail)
+	appendTimeSeriesData(ftdc.TimeSeriesData, tail.TimeSeriesData)
+	if ftdc.ReplicationLags == nil {
+		ftdc.ReplicationLags = map[string]TimeSeriesDoc{}
+	}
+	appendTimeSeriesData(ftdc.ReplicationLags, tail.ReplicationLags)
+	if ftdc.DiskStats == nil {
+		ftdc.DiskStats = map[string]DiskStats{}
+	}
+	for disk, ts := range tail.DiskStats {
+		ds := ftdc.DiskStats[disk]
+		data := map[string]TimeSeriesDoc{"iops": ds.IOPS, "io_in_progress": ds.IOInProgress, "io_queued_ms": ds.IOQueuedMS,
+			"read_time_ms": ds.ReadTimeMS, "write_time_ms": ds.WriteTimeMS, "util": ds.Utilization}
+		appendTimeSeriesData(data, map[string]TimeSeriesDoc{"iops": ts.IOPS, "io_in_progress": ts.IOInProgress,
+			"io_queued_ms": ts.IOQueuedMS, "read_time_ms": ts.ReadTimeMS, "write_time_ms": ts.WriteTimeMS, "util": ts.Utilization})
+		ftdc.DiskStats[disk] = DiskStats{IOPS: data["iops"], IOInProgress: data["io_in_progress"], IOQueuedMS: data["io_queued_ms"],
+			ReadTimeMS: data["read_time_ms"], WriteTimeMS: data["write_time_ms"], Utilization: data["util"]}
+	}
+	ftdc.ReplSetLegends = tail.ReplSetLegends
+	if ftdc.MaxWTCache == 0 {
+		ftdc.MaxWTCache = tail.MaxWTCache
+	}
+}
+
+// getFilenames returns FTDC metrics files of the directory
+func (f *Follower) getFilenames() []string {
+	var filenames []string
+	for _, filename := range GetMetricsFilenames([]string{f.dir}) {
+		if strings.HasPrefix(filepath.Base(filename), "metrics.") {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
+
+// readFileFrom decodes complete chunks of a file from an offset, it returns bytes decoded
+func (d *DiagnosticData) readFileFrom(filename string, offset int64) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := decoder.NewReader(file)
+	reader.SetPreserveValues(d.preserveValues)
+	reader.SetTimeRange(d.from, d.to)
+	err = d.readChunks(reader, isInterimFile(filename))
+	return reader.Offset(), err
+}
+
+// getCompleteSize returns size of complete BSON documents of a file, a partially
+// written chunk at the end is excluded
+func getCompleteSize(filename string) (int64, bool) {
+	_, size, ok := scanDocuments(filename)
+	return size, ok
+}
+
+// getLastDocumentOffset returns offset of the last complete BSON document of a file
+func getLastDocumentOffset(filename string) (int64, bool) {
+	last, size, ok := scanDocuments(filename)
+	return last, ok && size > 0
+}
+
+// scanDocuments reads lengths of BSON documents, it returns offset of the last complete
+// document and size of all complete documents
+func scanDocuments(filename string) (int64, int64, bool) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, 0, false
+	}
+	var last, offset int64
+	header := make([]byte, 4)
+	for offset+4 <= fi.Size() {
+		if _, err = file.ReadAt(header, offset); err != nil {
+			return last, offset, false
+		}
+		length := int64(binary.LittleEndian.Uint32(header))
+		if length < 5 || offset+length > fi.Size() {
+			break
+		}
+		last = offset
+		offset += length
+	}
+	return last, offset, true
+}
@@ -0,0 +1,71 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// follower_test.go
+
+package ftdc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFollower(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "diagnostic.data")
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	filename := filepath.Join(dir, "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, filename, "shard01-a", start, 100)
+	m := &Metrics{}
+	if err := m.ProcessFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFollower(m, filepath.Dir(dir)); err == nil {
+		t.Fatal("expected error of a directory not loaded")
+	}
+	f, err := NewFollower(m, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Poll(); err != nil || n != 0 {
+		t.Fatalf("expected no new samples, got %d %v", n, err)
+	}
+
+	// a partially written chunk is decoded once completed
+	writeTestFile(t, filename, "", start.Add(100*time.Second), 30, testFileOptions{append: true})
+	fi, _ := os.Stat(filename)
+	os.Truncate(filename, fi.Size()-10)
+	if n, err := f.Poll(); err != nil || n != 0 {
+		t.Fatalf("expected no new samples, got %d %v", n, err)
+	}
+	os.Truncate(filename, f.offsets[filename])
+	writeTestFile(t, filename, "", start.Add(100*time.Second), 30, testFileOptions{append: true})
+	if n, err := f.Poll(); err != nil || n != 29 {
+		t.Fatalf("expected 29 new samples, got %d %v", n, err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "metrics.2020-05-13T14-22-19Z-00000"), "shard01-a", start.Add(130*time.Second), 20)
+	if n, err := f.Poll(); err != nil || n != 19 {
+		t.Fatalf("expected 19 new samples, got %d %v", n, err)
+	}
+	stats := m.GetFTDCStats()
+	if stats.ServerStatusColumns.Len() != 99+29+19 || stats.TimeSeriesData["ops_query"].Len() == 0 {
+		t.Fatalf("unexpected stats, %d samples", stats.ServerStatusColumns.Len())
+	}
+
+	// appended series are those of all samples, and series of a source share times
+	all := stats
+	all.TimeSeriesData = nil
+	m.setTimeSeriesData(&all)
+	for name, doc := range all.TimeSeriesData {
+		if !reflect.DeepEqual(doc.DataPoints(), stats.TimeSeriesData[name].DataPoints()) {
+			t.Fatalf("%v: expected %v, got %v", name, doc.DataPoints(), stats.TimeSeriesData[name].DataPoints())
+		}
+	}
+	for _, pair := range [][]string{{"mem_resident", "ops_query"}, {"cpu_user", "cpu_idle"}} {
+		x, y := stats.TimeSeriesData[pair[0]], stats.TimeSeriesData[pair[1]]
+		if &x.Times[x.Len()-1] != &y.Times[y.Len()-1] {
+			t.Fatalf("expected shared times of %v", pair)
+		}
+	}
+}
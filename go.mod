@@ -3,9 +3,9 @@ module github.com/simagix/mongo-ftdc
 go 1.25
 
 require (
+	github.com/golang/snappy v1.0.0
 	github.com/simagix/gox v0.3.0
 	go.mongodb.org/mongo-driver v1.17.6
 	golang.org/x/text v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require github.com/golang/snappy v1.0.0 // indirect
@@ -4,14 +4,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/simagix/gox"
 	ftdc "github.com/simagix/mongo-ftdc"
@@ -29,6 +33,20 @@ func main() {
 	outputDir := flag.String("output", "obfuscated", "output directory for obfuscated files")
 	showMappings := flag.Bool("show-mappings", false, "show obfuscation mappings (with -obfuscate)")
 	server := flag.Bool("server", false, "start API server for Grafana (default: diagnosis only)")
+	follow := flag.Bool("follow", false, "watch directories of the arguments for new samples (with -server), a switch without a value")
+	preserve := flag.Bool("preserve", false, "preserve string and float values of FTDC data")
+	raw := flag.Bool("raw", false, "keep all metric paths for raw: Grafana queries")
+	cacheFile := flag.String("cache", "", "cache file of processed stats, only new files are decoded on reruns")
+	export := flag.String("export", "", "export format, csv, openmetrics or parquet")
+	exportFile := flag.String("export-file", "", "export output file (default: ftdc_export.<format>)")
+	metricNames := flag.String("metrics", "all", "comma separated metrics or raw: paths to export (csv and parquet)")
+	from := flag.String("from", "", "load samples from time in RFC3339 or before the end of data, e.g. 2025-12-10T11:00:00Z or -6h")
+	to := flag.String("to", "", "load samples to time in RFC3339 or before the end of data")
+	rulesFile := flag.String("rules", "", "YAML or JSON file of diagnosis rules and anomaly thresholds")
+	profileName := flag.String("profile", ftdc.DefaultScoringProfile, "scoring watermarks, "+strings.Join(ftdc.GetScoringProfileNames(), ", ")+" or a YAML/JSON file")
+	compare := flag.String("compare", "", "compare a baseline with a target, <baseline>[,<target>] of from/to time ranges or directories, the target defaults to loaded data")
+	format := flag.String("format", "text", "diagnosis output format, text or json; json sets exit code 10 of warnings and 11 of critical problems")
+	remoteWrite := flag.String("remote-write", "", "Prometheus remote write URL, e.g. http://localhost:9090/api/v1/write")
 	flag.Parse()
 
 	if *ver {
@@ -45,21 +63,103 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *format != "text" && *format != "json" {
+		log.Fatalf("invalid format %v, expected text or json", *format)
+	}
+	stdout := os.Stdout
+	if *format == "json" { // stdout is the report only, progress goes to stderr
+		os.Stdout = os.Stderr
+	}
+
+	var rules *ftdc.RulesConfig
+	if *rulesFile != "" {
+		var err error
+		if rules, err = ftdc.LoadRulesConfig(*rulesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	profile, err := ftdc.LoadScoringProfile(*profileName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	metrics := ftdc.NewMetrics()
 	metrics.SetLatest(*latest)
+	latestSet := false
+	flag.Visit(func(f *flag.Flag) { latestSet = latestSet || f.Name == "latest" })
+	for _, spec := range strings.Split(*compare, ",") {
+		if _, _, err := ftdc.ParseTimeRange(spec, time.Now()); err == nil && *from == "" && *to == "" && !latestSet {
+			metrics.SetLatest(0) // time ranges to compare may be older than the latest files, unless -latest is given
+		}
+	}
 	metrics.SetVerbose(*verbose)
+	metrics.SetPreserveValues(*preserve)
+	metrics.SetKeepRawValues(*raw)
+	metrics.SetCacheFile(*cacheFile)
+	metrics.SetScoringProfile(profile)
+	if rules != nil {
+		metrics.SetAnomalyThresholds(rules.GetAnomalyThresholds())
+		metrics.SetAnomalyDetector(rules.GetAnomalyDetector())
+	}
+	if err := metrics.SetTimeRange(*from, *to); err != nil {
+		log.Fatal(err)
+	}
 	if err := metrics.ProcessFiles(flag.Args()); err != nil {
 		log.Fatal(err)
 	}
 
+	// Export mode
+	if *export != "" || *remoteWrite != "" {
+		opts := exportOptions{file: *exportFile, format: *export, metrics: strings.Split(*metricNames, ","),
+			url: *remoteWrite, verbose: *verbose}
+		if err := runExport(metrics, opts); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// Comparison mode
+	if *compare != "" {
+		if err := runComparison(metrics, *compare, *latest, *verbose); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	// Run diagnosis (always)
-	runDiagnosis(metrics, flag.Args())
+	if *format == "json" {
+		code := runJSONDiagnosis(metrics, flag.Args(), rules, profile, stdout)
+		if !*server && !*follow {
+			os.Exit(code)
+		}
+	} else {
+		runDiagnosis(metrics, flag.Args(), rules, profile)
+	}
 
 	// Default: diagnosis only, exit
-	if !*server {
+	if !*server && !*follow {
 		os.Exit(0)
 	}
 
+	// Follow mode, merge new samples as mongod writes them
+	if *follow {
+		dirs := map[string]bool{}
+		for _, filename := range ftdc.GetMetricsFilenames(flag.Args()) {
+			dir := filepath.Dir(filename)
+			if dirs[dir] {
+				continue
+			}
+			dirs[dir] = true
+			follower, err := ftdc.NewFollower(metrics, dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Println("following", dir)
+			go follower.Run(nil)
+		}
+	}
+
 	// Server mode (with -server flag)
 	addr := fmt.Sprintf(":%d", *port)
 	http.HandleFunc("/", gox.Cors(handler))
@@ -89,7 +189,7 @@ func handler(w http.ResponseWriter, r *http.Request) {
 
 func runObfuscate(args []string, outputDir string, showMappings bool) error {
 	if len(args) == 0 {
-		fmt.Println("Usage: mftdc -obfuscate [-output <dir>] <file_or_directory>...")
+		fmt.Println("Usage: mftdc -obfuscate [-output <dir>] <file_directory_or_archive>...")
 		fmt.Println()
 		fmt.Println("Obfuscates PII (hostnames, IPs, replica set names) in FTDC files.")
 		fmt.Println("Output files are saved to 'obfuscated/' directory by default.")
@@ -114,6 +214,10 @@ func runObfuscate(args []string, outputDir string, showMappings bool) error {
 			if err := processDirectory(obfuscator, inputPath, outputDir); err != nil {
 				log.Printf("Warning: failed to process directory %s: %v", inputPath, err)
 			}
+		} else if ftdc.IsArchiveFile(inputPath) {
+			if err := processArchive(obfuscator, inputPath, outputDir); err != nil {
+				log.Printf("Warning: failed to process archive %s: %v", inputPath, err)
+			}
 		} else {
 			outputPath := filepath.Join(outputDir, filepath.Base(inputPath))
 			if err := obfuscator.ObfuscateFile(inputPath, outputPath); err != nil {
@@ -170,6 +274,29 @@ func processDirectory(obfuscator *ftdc.Obfuscator, inputDir, outputDir string) e
 	})
 }
 
+// processArchive obfuscates metrics members of an archive to the same paths under the
+// output directory
+func processArchive(obfuscator *ftdc.Obfuscator, archive, outputDir string) error {
+	return ftdc.WalkArchive(archive, func(member ftdc.ArchiveMember, r io.Reader) error {
+		outputPath := filepath.Join(outputDir, filepath.FromSlash(member.Name))
+		outputFileDir := filepath.Dir(outputPath)
+		if err := os.MkdirAll(outputFileDir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", outputFileDir, err)
+		}
+
+		var buf bytes.Buffer
+		if err := obfuscator.ObfuscateReader(r, &buf); err != nil {
+			log.Printf("Warning: failed to obfuscate %s: %v", member.Name, err)
+			return nil
+		}
+		if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", outputPath, err)
+		}
+		fmt.Printf("Obfuscated: %s:%s -> %s\n", archive, member.Name, outputPath)
+		return nil
+	})
+}
+
 func isMetricsFile(name string) bool {
 	if len(name) >= 8 && name[:8] == "metrics." {
 		return true
@@ -180,26 +307,129 @@ func isMetricsFile(name string) bool {
 	return false
 }
 
-func runDiagnosis(metrics *ftdc.Metrics, args []string) {
-	if len(args) == 0 {
-		return
+// exportOptions are options of export mode
+type exportOptions struct {
+	file    string
+	format  string
+	metrics []string
+	url     string
+	verbose bool
+}
+
+var exportExtensions = map[string]string{"csv": "csv", "openmetrics": "om", "parquet": "parquet"}
+
+func runExport(metrics *ftdc.Metrics, opts exportOptions) error {
+	stats := metrics.GetHostFTDCStats()
+	if opts.format != "" {
+		ext, ok := exportExtensions[opts.format]
+		if !ok {
+			return fmt.Errorf("unsupported export format %v", opts.format)
+		}
+		filename := opts.file
+		if filename == "" {
+			filename = "ftdc_export." + ext
+		}
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if opts.format == "openmetrics" {
+			err = ftdc.WriteOpenMetrics(file, stats)
+		} else {
+			table := ftdc.NewExportTable(stats, opts.metrics, time.Time{}, time.Time{})
+			if opts.format == "csv" {
+				err = table.WriteCSV(file)
+			} else {
+				err = table.WriteParquet(file)
+			}
+			fmt.Printf("%d rows, %d columns\n", len(table.Times), len(table.Columns)+1)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📄 %v export saved to: %s\n", opts.format, filename)
 	}
+	if opts.url != "" {
+		rw := ftdc.NewRemoteWriter(opts.url)
+		rw.SetVerbose(opts.verbose)
+		n, err := rw.Write(stats)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📤 %d samples sent to %s\n", n, opts.url)
+	}
+	return nil
+}
 
-	// Get time range and stats
-	from, to := metrics.GetTimeRange()
-	if from.IsZero() || to.IsZero() {
-		return
+// runComparison compares a baseline with a target, each is a from/to time range of loaded
+// data or a directory. The target defaults to all loaded data.
+func runComparison(metrics *ftdc.Metrics, spec string, latest int, verbose bool) error {
+	specs := strings.Split(spec, ",")
+	if len(specs) > 2 {
+		return fmt.Errorf("invalid comparison %v, expected <baseline>[,<target>]", spec)
 	}
+	baseline, baseFrom, baseTo, err := getComparisonPeriod(metrics, specs[0], latest, verbose)
+	if err != nil {
+		return err
+	}
+	target, targetFrom, targetTo := metrics.GetFTDCStats(), time.Time{}, time.Time{}
+	if len(specs) == 2 {
+		if target, targetFrom, targetTo, err = getComparisonPeriod(metrics, specs[1], latest, verbose); err != nil {
+			return err
+		}
+	}
+	comparison := ftdc.NewComparison(baseline, baseFrom, baseTo, target, targetFrom, targetTo)
+	comparison.Run()
+	comparison.PrintReport()
+
+	os.MkdirAll("html", 0755)
+	htmlOutput := filepath.Join("html", "ftdc_comparison.html")
+	if err = comparison.GenerateHTML(htmlOutput); err != nil {
+		return err
+	}
+	fmt.Printf("📄 HTML report saved to: %s\n", htmlOutput)
+	return nil
+}
 
-	stats := metrics.GetFTDCStats()
+// getComparisonPeriod returns stats and time range of a from/to time range of loaded data, or
+// stats of a directory
+func getComparisonPeriod(metrics *ftdc.Metrics, spec string, latest int, verbose bool) (ftdc.FTDCStats, time.Time, time.Time, error) {
+	_, end := metrics.GetTimeRange()
+	from, to, err := ftdc.ParseTimeRange(spec, end)
+	if err == nil {
+		return metrics.GetFTDCStats(), from, to, nil
+	} else if _, serr := os.Stat(spec); serr != nil {
+		return ftdc.FTDCStats{}, from, to, err
+	}
+	m := &ftdc.Metrics{}
+	m.SetLatest(latest)
+	m.SetVerbose(verbose)
+	if err = m.ProcessFiles([]string{spec}); err != nil {
+		return ftdc.FTDCStats{}, from, to, err
+	}
+	return m.GetFTDCStats(), time.Time{}, time.Time{}, nil
+}
 
-	// Run diagnosis
-	diagnosis := ftdc.NewDiagnosis(stats, from, to)
-	diagnosis.Run()
+func runDiagnosis(metrics *ftdc.Metrics, args []string, rules *ftdc.RulesConfig, profile *ftdc.ScoringProfile) {
+	if len(args) == 0 {
+		return
+	}
+	diagnosis := newDiagnosis(metrics, rules, profile)
+	if diagnosis == nil {
+		return
+	}
 
 	// Print to stdout
 	diagnosis.PrintReport()
 
+	// Correlate members when several hosts are loaded
+	if len(metrics.GetHosts()) > 1 {
+		cluster := ftdc.NewClusterDiagnosis(metrics.GetHostFTDCStats())
+		cluster.Run()
+		cluster.PrintReport()
+	}
+
 	// Generate HTML report
 	htmlOutput := determineHTMLPath(args[0])
 	if err := diagnosis.GenerateHTML(htmlOutput); err != nil {
@@ -209,6 +439,39 @@ func runDiagnosis(metrics *ftdc.Metrics, args []string) {
 	fmt.Printf("📄 HTML report saved to: %s\n", htmlOutput)
 }
 
+// runJSONDiagnosis writes the diagnosis report in JSON and returns the exit code of the worst severity
+func runJSONDiagnosis(metrics *ftdc.Metrics, args []string, rules *ftdc.RulesConfig, profile *ftdc.ScoringProfile, w *os.File) int {
+	if len(args) == 0 {
+		return ftdc.ExitCodeClean
+	}
+	diagnosis := newDiagnosis(metrics, rules, profile)
+	if diagnosis == nil {
+		log.Fatal("no data to diagnose")
+	}
+	diagnosis.SetInputFiles(metrics.GetInputFiles())
+	if err := diagnosis.WriteJSON(w); err != nil {
+		log.Fatal(err)
+	}
+	return ftdc.GetSeverityExitCode(ftdc.GetWorstSeverity(diagnosis.GetResults()))
+}
+
+// newDiagnosis runs diagnosis of the default host, nil if no data
+func newDiagnosis(metrics *ftdc.Metrics, rules *ftdc.RulesConfig, profile *ftdc.ScoringProfile) *ftdc.Diagnosis {
+	from, to := metrics.GetTimeRange()
+	if from.IsZero() || to.IsZero() {
+		return nil
+	}
+	diagnosis := ftdc.NewDiagnosis(metrics.GetFTDCStats(), from, to)
+	diagnosis.SetScoringProfile(profile)
+	if rules != nil {
+		diagnosis.SetRules(rules.GetRules())
+		diagnosis.SetAnomalyThresholds(rules.GetAnomalyThresholds())
+		diagnosis.SetAnomalyDetector(rules.GetAnomalyDetector())
+	}
+	diagnosis.Run()
+	return diagnosis
+}
+
 func determineHTMLPath(inputPath string) string {
 	// Always output to ./html directory
 	htmlDir := "html"
@@ -0,0 +1,100 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// member_states.go
+
+package ftdc
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemberStateEvent is a state transition of a replica set member
+type MemberStateEvent struct {
+	Date   time.Time
+	Member string
+	From   int // -1 if unknown, e.g. first sample
+	To     int
+	Term   int64
+}
+
+// FromName returns name of the previous state
+func (e MemberStateEvent) FromName() string {
+	if e.From < 0 {
+		return ""
+	}
+	return GetMemberStateName(e.From)
+}
+
+// ToName returns name of the new state
+func (e MemberStateEvent) ToName() string { return GetMemberStateName(e.To) }
+
+// IsElection returns true if a member became primary
+func (e MemberStateEvent) IsElection() bool { return e.From >= 0 && e.To == 1 }
+
+// getMemberStateEvents returns member states of a chunk at its first sample and on changes
+func getMemberStateEvents(v *decoder.MetricsData, doc ReplSetStatusDoc) []MemberStateEvent {
+	var events []MemberStateEvent
+	dates := v.DataPointsMap["replSetGetStatus/date"]
+	if len(dates) == 0 {
+		dates = v.DataPointsMap["serverStatus/localTime"]
+	}
+	for i, mb := range doc.Members {
+		prefix := fmt.Sprintf("replSetGetStatus/members/%d/", i)
+		states := v.DataPointsMap[prefix+"state"]
+		terms := v.DataPointsMap[prefix+"optime/t"]
+		if len(terms) == 0 {
+			terms = v.DataPointsMap["replSetGetStatus/term"]
+		}
+		for j, state := range states {
+			if j >= len(dates) || (j > 0 && state == states[j-1]) {
+				continue
+			}
+			event := MemberStateEvent{Date: time.Unix(0, int64(dates[j])*int64(time.Millisecond)),
+				Member: mb.Name, From: -1, To: int(state)}
+			if j < len(terms) {
+				event.Term = int64(terms[j])
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// GetMemberStateTimeline returns state transitions by time, repeated states are removed
+func GetMemberStateTimeline(events []MemberStateEvent) []MemberStateEvent {
+	sorted := append([]MemberStateEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	timeline := []MemberStateEvent{}
+	states := map[string]int{}
+	for _, e := range sorted {
+		if state, ok := states[e.Member]; ok {
+			if state == e.To {
+				continue
+			}
+			e.From = state
+		}
+		states[e.Member] = e.To
+		timeline = append(timeline, e)
+	}
+	return timeline
+}
+
+// getMemberStatesTable returns a Grafana table of state transitions
+func getMemberStatesTable(events []MemberStateEvent, from time.Time, to time.Time) bson.M {
+	columns := []bson.M{
+		{"text": "Time", "type": "time"}, {"text": "Member", "type": "string"},
+		{"text": "From", "type": "string"}, {"text": "To", "type": "string"}, {"text": "Term", "type": "number"},
+	}
+	rows := [][]interface{}{}
+	for _, e := range events {
+		if e.From < 0 || e.Date.Before(from) || e.Date.After(to) {
+			continue
+		}
+		rows = append(rows, []interface{}{e.Date.UnixNano() / int64(time.Millisecond), e.Member, e.FromName(), e.ToName(), e.Term})
+	}
+	return bson.M{"columns": columns, "type": "table", "rows": rows}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// member_states_test.go
+
+package ftdc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getTestElectionSample returns a sample of replSetGetStatus of i seconds after start,
+// rs-b:27017 is elected at 10s
+func getTestElectionSample(start time.Time, i int) bson.D {
+	tm := start.Add(time.Duration(i) * time.Second)
+	states, term := []int32{1, 2}, int64(1)
+	if i >= 10 {
+		states, term = []int32{2, 1}, 2
+	}
+	members := bson.A{}
+	for n, name := range []string{"rs-a:27017", "rs-b:27017"} {
+		members = append(members, bson.D{{Key: "name", Value: name}, {Key: "state", Value: states[n]},
+			{Key: "optime", Value: bson.D{{Key: "ts", Value: primitive.Timestamp{T: uint32(tm.Unix())}}, {Key: "t", Value: term}}}})
+	}
+	return append(getTestSample(start, i), bson.E{Key: "replSetGetStatus", Value: bson.D{
+		{Key: "set", Value: "rs"}, {Key: "date", Value: primitive.NewDateTimeFromTime(tm)}, {Key: "members", Value: members}}})
+}
+
+func TestMemberStateTimeline(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	filename := filepath.Join(t.TempDir(), "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, filename, "", start, 20, testFileOptions{sample: getTestElectionSample})
+	diag := NewDiagnosticData()
+	if err := diag.readDiagnosticFiles([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	timeline := GetMemberStateTimeline(diag.MemberStates)
+	if len(timeline) != 4 {
+		t.Fatalf("expected 4 events, got %v", timeline)
+	}
+	e := timeline[3]
+	if !e.IsElection() || e.Member != "rs-b:27017" || e.FromName() != SECONDARY || e.Term != 2 || !e.Date.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("unexpected election %v", e)
+	}
+
+	m := &Metrics{ftdcStats: FTDCStats{MemberStates: timeline}}
+	body := `{"range": {"from": "2020-05-13T14:00:00Z", "to": "2020-05-13T15:00:00Z"}, "annotation": {"name": "elections", "query": "elections"}}`
+	w := httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/annotations", strings.NewReader(body)))
+	if !strings.Contains(w.Body.String(), "rs-b:27017 became PRIMARY (term 2)") || strings.Contains(w.Body.String(), "member_state") {
+		t.Fatalf("unexpected annotations %v", w.Body.String())
+	}
+	table := getMemberStatesTable(timeline, start, start.Add(time.Minute))
+	if len(table["rows"].([][]interface{})) != 2 {
+		t.Fatalf("unexpected table %v", table)
+	}
+}
@@ -4,17 +4,15 @@
 package ftdc
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -22,29 +20,50 @@ import (
 
 	"github.com/simagix/gox"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Metrics stores metrics from FTDC data
 type Metrics struct {
 	sync.RWMutex
 	endpoints []string
-	ftdcStats FTDCStats
-	latest    int // latest n files
+	ftdcStats FTDCStats             // stats of the default (first) host
+	hosts     []string              // host labels in the order loaded
+	hostStats map[string]*FTDCStats // stats by host label
+	inputs    []InputFile           // files loaded by ProcessFiles
+	cacheFile string                // processed stats are cached if set
+	dirHosts  map[string]string     // host labels by absolute directory path
+	from      time.Time             // resolved time range of samples loaded
+	fromSpec  string                // RFC3339 or relative to the end of data, e.g. -6h
+	latest    int                   // latest n files
+	to        time.Time
+	toSpec    string
 	verbose   bool
+
+	profile    *ScoringProfile    // of the assessment target, FormulaMap if nil
+	thresholds []AnomalyThreshold // of anomalies annotations, DefaultAnomalyThresholds if nil
+	detector   *AnomalyDetector   // of anomalies annotations, DefaultAnomalyDetector if nil
+
+	anomalies   map[*FTDCStats][]Annotation // anomalies annotations by stats, reset on merge
+	anomaliesMu sync.Mutex                  // of anomalies, computed under the read lock
+
+	keepRawValues  bool
+	preserveValues bool
 }
 
 // FTDCStats FTDC stats
 type FTDCStats struct {
-	DiskStats         map[string]DiskStats
-	MaxWTCache        float64
-	ReplicationLags   map[string]TimeSeriesDoc
-	ReplSetLegends    []string
-	ReplSetStatusList []ReplSetStatusDoc
-	ServerInfo        ServerInfoDoc
-	ServerStatusList  []ServerStatusDoc
-	SystemMetricsList []SystemMetricsDoc
-	TimeSeriesData    map[string]TimeSeriesDoc
+	DiskStats           map[string]DiskStats
+	MaxWTCache          float64
+	MemberStates        []MemberStateEvent // replica set member state transitions
+	RawStore            *RawStore          // raw metric paths, for raw: queries
+	ReplicationLags     map[string]TimeSeriesDoc
+	ReplSetLegends      []string
+	ReplSetStatusList   []ReplSetStatusDoc
+	ServerInfo          ServerInfoDoc
+	ServerStatusList    []ServerStatusDoc   // of keyhole stats
+	ServerStatusColumns ServerStatusColumns // serverStatus samples of FTDC files
+	SystemMetricsList   []SystemMetricsDoc
+	TimeSeriesData      map[string]TimeSeriesDoc
 }
 
 // DiskStats -
@@ -58,16 +77,21 @@ type DiskStats struct {
 }
 
 type directoryReq struct {
-	Dir  string `json:"dir"`
-	Span int    `json:"span"`
+	Append bool     `json:"append"` // add to loaded hosts instead of replacing them
+	Dir    string   `json:"dir"`
+	Dirs   []string `json:"dirs"`
+	Span   int      `json:"span"`
 }
 
+// assessmentPrefix selects a scoring profile of the assessment target, e.g. assessment:oltp
+const assessmentPrefix = "assessment:"
+
+// HostSeparator separates a target and a host selector, e.g. ops_query@shard01-a or ops_query@*
+const HostSeparator = "@"
+
 // NewMetrics returns &Metrics
 func NewMetrics() *Metrics {
-	gob.Register(primitive.DateTime(1))
-	gob.Register(primitive.A{})
-	gob.Register(primitive.D{})
-	gob.Register(primitive.M{})
+	registerCacheTypes()
 	m := Metrics{}
 	http.HandleFunc("/grafana", gox.Cors(m.Handler))
 	http.HandleFunc("/grafana/", gox.Cors(m.Handler))
@@ -82,6 +106,42 @@ const disksEndpoint = `/d/simagix-grafana-disks/mongodb-disks-stats?from=%v&to=%
 // SetVerbose sets verbose mode
 func (m *Metrics) SetVerbose(verbose bool) { m.verbose = verbose }
 
+// SetPreserveValues keeps strings and float values of FTDC data
+func (m *Metrics) SetPreserveValues(preserveValues bool) { m.preserveValues = preserveValues }
+
+// SetKeepRawValues keeps values of all metric paths for raw: queries
+func (m *Metrics) SetKeepRawValues(keepRawValues bool) { m.keepRawValues = keepRawValues }
+
+// SetCacheFile sets the file caching processed stats, only new files are decoded if cached
+func (m *Metrics) SetCacheFile(cacheFile string) { m.cacheFile = cacheFile }
+
+// SetTimeRange loads samples within a time range only, replacing latest. A time is
+// RFC3339 or a duration before the end of data, e.g. -6h, and empty is unbounded.
+func (m *Metrics) SetTimeRange(from string, to string) error {
+	for _, spec := range []string{from, to} {
+		if _, _, err := ParseTimeSpec(spec); err != nil {
+			return err
+		}
+	}
+	m.fromSpec, m.toSpec = from, to
+	return nil
+}
+
+// SetAnomalyThresholds sets thresholds of anomalies annotations
+func (m *Metrics) SetAnomalyThresholds(thresholds []AnomalyThreshold) {
+	m.thresholds = thresholds
+	m.resetAnomalyAnnotations(nil)
+}
+
+// SetAnomalyDetector sets the detector of deviations and level shifts of anomalies annotations
+func (m *Metrics) SetAnomalyDetector(detector AnomalyDetector) {
+	m.detector = &detector
+	m.resetAnomalyAnnotations(nil)
+}
+
+// SetScoringProfile sets watermarks of the assessment target, assessment:<profile> selects a preset
+func (m *Metrics) SetScoringProfile(profile *ScoringProfile) { m.profile = profile }
+
 // SetLatest sets latest
 func (m *Metrics) SetLatest(latest int) { m.latest = latest }
 
@@ -91,64 +151,327 @@ func (m *Metrics) GetEndPoints() []string { return m.endpoints }
 // GetFTDCStats returns the FTDC stats for analysis
 func (m *Metrics) GetFTDCStats() FTDCStats { return m.ftdcStats }
 
+// GetInputFiles returns files loaded by ProcessFiles
+func (m *Metrics) GetInputFiles() []InputFile { return m.inputs }
+
+// GetHosts returns host labels in the order loaded
+func (m *Metrics) GetHosts() []string { return m.hosts }
+
+// GetHostFTDCStats returns FTDC stats by host label
+func (m *Metrics) GetHostFTDCStats() map[string]FTDCStats {
+	stats := map[string]FTDCStats{}
+	for host, ftdc := range m.hostStats {
+		stats[host] = *ftdc
+	}
+	return stats
+}
+
 // GetTimeRange returns the time range of the FTDC data
 func (m *Metrics) GetTimeRange() (time.Time, time.Time) {
-	var from, to time.Time
-	if len(m.ftdcStats.ServerStatusList) > 0 {
-		from = m.ftdcStats.ServerStatusList[0].LocalTime
-		to = m.ftdcStats.ServerStatusList[len(m.ftdcStats.ServerStatusList)-1].LocalTime
-	}
+	from, to, _ := getServerStatusTimeRange(m.ftdcStats.ServerStatusColumns, m.ftdcStats.ServerStatusList)
 	return from, to
 }
 
-// ProcessFiles reads metrics files/data
+// ProcessFiles reads metrics files/data. Files are grouped by directory, each directory is
+// loaded as a host labeled by hostInfo hostname and port or by directory name. Hosts are
+// loaded in the order of arguments, the first one is the default host.
 func (m *Metrics) ProcessFiles(filenames []string) error {
-	filenames = GetMetricsFilenames(filenames)
-	if len(filenames) == 0 {
+	archives, args := splitArchiveFiles(filenames)
+	filenames = nil
+	seen := map[string]bool{}
+	for _, arg := range args { // hosts are in the order of arguments
+		for _, filename := range GetMetricsFilenames([]string{arg}) {
+			if !seen[filename] {
+				seen[filename] = true
+				filenames = append(filenames, filename)
+			}
+		}
+	}
+	if len(filenames) == 0 && len(archives) == 0 {
 		return errors.New("no valid data file found")
 	}
-	if m.latest > 0 && m.latest < len(filenames) {
-		filenames = filenames[len(filenames)-m.latest:]
+	members := map[string][]ArchiveMember{}
+	for _, archive := range archives {
+		list, err := GetArchiveMembers(archive)
+		if err != nil {
+			return fmt.Errorf("failed to read archive %v: %w", archive, err)
+		} else if len(list) == 0 {
+			return errors.New("no metrics file found in " + archive)
+		}
+		members[archive] = list
 	}
 
-	diag := NewDiagnosticData()
-	if err := diag.DecodeDiagnosticData(filenames); err != nil { // get summary
+	var dirs []string
+	groups := map[string][]string{}
+	for _, filename := range filenames {
+		dir := filepath.Dir(filename)
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], filename)
+	}
+
+	if err := m.resolveTimeRange(filenames, getArchiveEndTime(members)); err != nil {
 		return err
 	}
-	m.endpoints = diag.endpoints
-	m.AddFTDCDetailStats(diag)
+	var cache *FTDCCache
+	if m.cacheFile != "" {
+		var err error
+		if cache, err = ReadCache(m.cacheFile); err != nil && !os.IsNotExist(err) {
+			log.Println("ignored cache", m.cacheFile, err)
+		}
+	}
+	newCache := NewFTDCCache(m.preserveValues, m.keepRawValues)
+	newCache.From, newCache.To = m.from, m.to
+	if m.from.IsZero() && m.to.IsZero() {
+		newCache.Latest = m.latest
+	}
+	m.endpoints = nil
+	for _, dir := range dirs {
+		fnames := groups[dir]
+		absdir, _ := filepath.Abs(dir)
+		if newCache.Latest > 0 && newCache.Latest < len(fnames) {
+			fnames = fnames[len(fnames)-newCache.Latest:]
+		}
+		if ch, err := m.processCachedFiles(cache.getHost(absdir, newCache), dir, fnames); err != nil {
+			log.Println("cache not used for", dir, err)
+		} else if ch != nil {
+			m.setDirHost(absdir, ch.Host)
+			newCache.Hosts = append(newCache.Hosts, *ch)
+			continue
+		}
+		diag := NewDiagnosticData()
+		diag.SetPreserveValues(m.preserveValues)
+		diag.SetKeepRawValues(m.keepRawValues)
+		diag.SetTimeRange(m.from, m.to)
+		if err := diag.DecodeDiagnosticData(fnames); err != nil { // get summary
+			return err
+		}
+		host := m.getUniqueHostLabel(diag, dir, absdir)
+		if len(dirs) > 1 {
+			log.Println("loaded", host, "from", dir)
+		}
+		m.AddHostFTDCDetailStats(host, diag)
+		m.setDirHost(absdir, host)
+		files, _ := getCacheFiles(fnames)
+		newCache.Hosts = append(newCache.Hosts, CacheHost{Dir: absdir, Files: files, Host: host})
+	}
+	m.inputs = nil
+	for _, ch := range newCache.Hosts {
+		for _, f := range ch.Files {
+			m.inputs = append(m.inputs, InputFile{Host: ch.Host, Dir: ch.Dir, Name: f.Name, Size: f.Size, ModTime: f.ModTime})
+		}
+	}
+	for _, archive := range archives { // archives are neither cached nor followed
+		inputs, err := m.processArchive(archive, members[archive])
+		if err != nil {
+			return err
+		}
+		m.inputs = append(m.inputs, inputs...)
+	}
+	if m.cacheFile != "" {
+		m.RLock()
+		for i, ch := range newCache.Hosts {
+			stats := *m.hostStats[ch.Host] // series are computed on loading to share time columns
+			stats.DiskStats, stats.ReplicationLags, stats.TimeSeriesData = nil, nil, nil
+			newCache.Hosts[i].Stats = stats
+		}
+		err := newCache.Write(m.cacheFile)
+		m.RUnlock()
+		if err != nil {
+			log.Println("failed to write cache", m.cacheFile, err)
+		}
+	}
+	if len(m.hosts) > 1 {
+		m.endpoints = getEndpoints(m.getClusterTimeRange())
+	} else {
+		m.endpoints = getEndpoints(m.GetTimeRange())
+	}
 	return nil
 }
 
-func (m *Metrics) readProcessedFTDC(infile string) error {
-	log.Println("Reading from processed FTDC data", infile)
+// resolveTimeRange resolves relative times against the last sample of all files, or the
+// last modified time of archive members if later
+func (m *Metrics) resolveTimeRange(filenames []string, archiveEnd time.Time) error {
+	var end time.Time
+	getEnd := func() time.Time {
+		if end.IsZero() {
+			end = getDataEndTime(filenames)
+			if archiveEnd.After(end) {
+				end = archiveEnd
+			}
+		}
+		return end
+	}
 	var err error
-	var data []byte
-	var file *os.File
-	var reader *bufio.Reader
-
-	if file, err = os.Open(infile); err != nil {
+	if m.from, err = resolveTimeSpec(m.fromSpec, getEnd); err != nil {
 		return err
 	}
-	if reader, err = gox.NewReader(file); err != nil {
+	if m.to, err = resolveTimeSpec(m.toSpec, getEnd); err != nil {
 		return err
 	}
-	if data, err = io.ReadAll(reader); err != nil {
-		return err
+	if !m.from.IsZero() || !m.to.IsZero() {
+		log.Println("time range", m.from.Format(time.RFC3339), "to", m.to.Format(time.RFC3339))
 	}
-	buffer := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buffer)
-	if err = dec.Decode(&m.ftdcStats); err != nil {
-		return err
+	return nil
+}
+
+// processCachedFiles loads cached stats of a directory and decodes new files, it returns
+// nil if not cached
+func (m *Metrics) processCachedFiles(ch *CacheHost, dir string, fnames []string) (*CacheHost, error) {
+	if ch == nil {
+		return nil, nil
+	}
+	files, err := getCacheFiles(fnames)
+	if err != nil {
+		return nil, err
+	}
+	files, err = ch.getFilesToDecode(files)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("loaded", ch.Host, "from cache", m.cacheFile, ",", len(files), "file(s) to decode")
+	m.setHostFTDCStats(ch.Host, ch.Stats)
+	if len(files) > 0 {
+		var filenames []string
+		for _, f := range files {
+			filenames = append(filenames, filepath.Join(dir, f.Name))
+		}
+		diag := NewDiagnosticData()
+		diag.SetPreserveValues(m.preserveValues)
+		diag.SetKeepRawValues(m.keepRawValues)
+		diag.SetTimeRange(m.from, m.to)
+		if err = diag.DecodeDiagnosticData(filenames); err != nil {
+			return nil, err
+		}
+		m.AddHostFTDCDetailStats(ch.Host, diag)
+		ch.addFiles(files)
+	}
+	return ch, nil
+}
+
+// setDirHost maps a directory to its host label
+func (m *Metrics) setDirHost(dir string, host string) {
+	m.Lock()
+	defer m.Unlock()
+	if m.dirHosts == nil {
+		m.dirHosts = map[string]string{}
+	}
+	m.dirHosts[dir] = host
+}
+
+// getDirHost returns host label of a loaded directory
+func (m *Metrics) getDirHost(dir string) (string, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	absdir, _ := filepath.Abs(dir)
+	host, ok := m.dirHosts[absdir]
+	return host, ok
+}
+
+// getHostLabel returns hostInfo hostname with the port, or directory name if not available.
+// The port is of cmdLine net.port or of serverStatus host, e.g. mongod-1:27018.
+func getHostLabel(diag *DiagnosticData, dir string) string {
+	var info struct {
+		ServerInfoDoc
+		CmdLineOpts struct {
+			Parsed struct {
+				Net struct {
+					Port int `json:"port"`
+				} `json:"net"`
+			} `json:"parsed"`
+		} `json:"getCmdLineOpts"`
+	}
+	b, _ := json.Marshal(diag.ServerInfo)
+	json.Unmarshal(b, &info)
+	hostname := info.HostInfo.System.Hostname
+	if hostname == "" {
+		return getDirLabel(dir)
+	} else if strings.Contains(hostname, ":") {
+		return hostname
+	}
+	if port := info.CmdLineOpts.Parsed.Net.Port; port > 0 {
+		return fmt.Sprintf("%v:%d", hostname, port)
+	}
+	host := diag.ServerStatusColumns.getLabel(0).Host
+	if len(diag.ServerStatusList) > 0 {
+		host = diag.ServerStatusList[0].Host
+	}
+	if n := strings.LastIndex(host, ":"); n >= 0 {
+		return hostname + host[n:]
+	}
+	return hostname
+}
+
+// getDirLabel returns directory name, or name of the parent of diagnostic.data
+func getDirLabel(dir string) string {
+	if filepath.Base(dir) == "diagnostic.data" {
+		dir = filepath.Dir(dir)
 	}
-	points := m.ftdcStats.TimeSeriesData["wt_cache_used"].DataPoints
-	tm1 := time.Unix(0, int64(points[0][1])*int64(time.Millisecond)).Unix() * 1000
-	tm2 := time.Unix(0, int64(points[len(points)-1][1])*int64(time.Millisecond)).Unix() * 1000
-	log.Println(tm1, tm2)
-	endpoint := fmt.Sprintf(analyticsEndpoint, tm1, tm2)
-	log.Printf("http://localhost:3000%v\n", endpoint)
-	log.Printf("http://localhost:3030%v\n", endpoint)
-	return err
+	return filepath.Base(dir)
+}
+
+// getUniqueHostLabel returns host label of a directory. The directory name is used if
+// another directory has the same label, e.g. members of a replica set without ports, and
+// the path if the name is taken too.
+func (m *Metrics) getUniqueHostLabel(diag *DiagnosticData, dir string, absdir string) string {
+	m.RLock()
+	defer m.RUnlock()
+	isTaken := func(host string) bool {
+		for d, h := range m.dirHosts {
+			if h == host && d != absdir {
+				return true
+			}
+		}
+		return false
+	}
+	host := getHostLabel(diag, dir)
+	if !isTaken(host) {
+		return host
+	} else if host = getDirLabel(dir); !isTaken(host) {
+		return host
+	}
+	return filepath.ToSlash(dir)
+}
+
+// getEndpoints returns Grafana endpoints of a time range
+func getEndpoints(from time.Time, to time.Time) []string {
+	if from.IsZero() {
+		t := time.Now().Unix() * 1000
+		minute := int64(60) * 1000
+		return []string{fmt.Sprintf(analyticsEndpoint, t, t+(10*minute))}
+	}
+	return []string{fmt.Sprintf(analyticsEndpoint, from.Unix()*1000, to.Unix()*1000)}
+}
+
+// getClusterTimeRange returns the time range of all hosts
+func (m *Metrics) getClusterTimeRange() (time.Time, time.Time) {
+	var from, to time.Time
+	for _, ftdc := range m.hostStats {
+		first, last, ok := getServerStatusTimeRange(ftdc.ServerStatusColumns, ftdc.ServerStatusList)
+		if !ok {
+			continue
+		}
+		if from.IsZero() || first.Before(from) {
+			from = first
+		}
+		if last.After(to) {
+			to = last
+		}
+	}
+	return from, to
+}
+
+// Reset removes all loaded hosts
+func (m *Metrics) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.ftdcStats = FTDCStats{}
+	m.hosts = nil
+	m.hostStats = nil
+	m.dirHosts = nil
+	m.endpoints = nil
+	m.resetAnomalyAnnotations(nil)
 }
 
 // Handler handle HTTP requests
@@ -157,6 +480,8 @@ func (m *Metrics) Handler(w http.ResponseWriter, r *http.Request) {
 		m.query(w, r)
 	} else if r.URL.Path == "/grafana/search" {
 		m.search(w, r)
+	} else if r.URL.Path == "/grafana/annotations" {
+		m.annotations(w, r)
 	} else if r.URL.Path == "/grafana/dir" {
 		m.readDirectory(w, r)
 	} else if strings.HasPrefix(r.URL.Path, "/scores/") {
@@ -176,7 +501,14 @@ func (m *Metrics) readDirectory(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(bson.M{"ok": 0, "err": err.Error()})
 			return
 		}
-		filenames := getFilenames([]string{dr.Dir})
+		dirs := dr.Dirs
+		if dr.Dir != "" {
+			dirs = append([]string{dr.Dir}, dirs...)
+		}
+		if !dr.Append {
+			m.Reset()
+		}
+		filenames := getFilenames(dirs)
 		if err := m.ProcessFiles(filenames); err != nil {
 			json.NewEncoder(w).Encode(bson.M{"ok": 0, "err": err.Error()})
 		} else {
@@ -188,13 +520,68 @@ func (m *Metrics) readDirectory(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type searchReq struct {
+	Target string `json:"target"`
+}
+
+// maxSearchResults limits number of metric names returned to Grafana
+const maxSearchResults = 500
+
 func (m *Metrics) search(w http.ResponseWriter, r *http.Request) {
-	var list []string
-	for _, doc := range m.ftdcStats.TimeSeriesData {
-		list = append(list, doc.Target)
+	var sr searchReq
+	json.NewDecoder(r.Body).Decode(&sr) // an empty body returns all metric names
+	target := strings.TrimSpace(sr.Target)
+	list := []string{}
+	m.RLock()
+	defer m.RUnlock()
+
+	// host selectors, e.g. ops_query@shard01 returns ops_query@* and ops_query@shard01-a
+	if name, host := splitHostTarget(target); name != target {
+		list = append(list, name+HostSeparator+"*")
+		for _, label := range m.hosts {
+			if strings.HasPrefix(label, host) {
+				list = append(list, name+HostSeparator+label)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+		return
 	}
 
-	list = append(list, "host_info")
+	// raw paths, optionally wrapped by a modifier, e.g. rate(raw:serverStatus/op
+	modifier := ""
+	for _, mod := range rawModifiers {
+		if strings.HasPrefix(target, mod+"(") {
+			modifier = mod
+			target = strings.TrimSuffix(target[len(mod)+1:], ")")
+			break
+		}
+	}
+	if strings.HasPrefix(target, RawPrefix) {
+		if m.ftdcStats.RawStore != nil {
+			for _, node := range m.ftdcStats.RawStore.Search(strings.TrimPrefix(target, RawPrefix)) {
+				name := RawPrefix + node
+				if modifier != "" {
+					name = modifier + "(" + name + ")"
+				}
+				list = append(list, name)
+			}
+		}
+	} else if modifier == "" {
+		for _, doc := range m.ftdcStats.TimeSeriesData {
+			if strings.HasPrefix(doc.Target, target) {
+				list = append(list, doc.Target)
+			}
+		}
+		sort.Strings(list)
+		for _, name := range []string{"host_info", "member_states", RawPrefix} {
+			if strings.HasPrefix(name, target) {
+				list = append(list, name)
+			}
+		}
+	}
+	if len(list) > maxSearchResults {
+		list = list[:maxSearchResults]
+	}
 	json.NewEncoder(w).Encode(list)
 }
 
@@ -206,89 +593,225 @@ func (m *Metrics) query(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(tsData)
 		return
 	}
-	ftdc := m.ftdcStats
+	m.RLock()
+	defer m.RUnlock()
+	if err := m.checkRawTargets(qr.Targets); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	for _, target := range qr.Targets {
-		if target.Type == "timeserie" {
-			if target.Target == "replication_lags" && len(ftdc.ReplicationLags) > 0 { // replaced with actual hostname
-				for k, v := range ftdc.ReplicationLags {
-					data := v
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
-				}
-			} else if target.Target == "disks_utils" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.Utilization
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
-				}
-			} else if target.Target == "disks_iops" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.IOPS
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
-				}
-			} else if target.Target == "disks_queue_length" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.IOInProgress
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
-				}
-			} else if target.Target == "read_time_ms" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.ReadTimeMS
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
-				}
-			} else if target.Target == "write_time_ms" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.WriteTimeMS
-					data.Target = k
-					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+		var host string
+		target.Target, host = splitHostTarget(target.Target)
+		if host == "" {
+			tsData = append(tsData, m.getTargetData(&m.ftdcStats, target, qr)...)
+			continue
+		}
+		for _, label := range m.selectHosts(host) {
+			for _, data := range m.getTargetData(m.hostStats[label], target, qr) {
+				if doc, ok := data.(TimeSeriesDoc); ok {
+					doc.Target += HostSeparator + label
+					data = doc
 				}
-			} else if target.Target == "io_queued_ms" && len(ftdc.DiskStats) > 0 {
-				for k, v := range ftdc.DiskStats {
-					data := v.IOQueuedMS
-					data.Target = k
+				tsData = append(tsData, data)
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(tsData)
+}
+
+// checkRawTargets returns ErrRawValuesNotKept if raw: targets query stats without values
+func (m *Metrics) checkRawTargets(targets []TargetDoc) error {
+	for _, target := range targets {
+		name, host := splitHostTarget(target.Target)
+		if !IsRawTarget(name) {
+			continue
+		}
+		if host == "" && !m.ftdcStats.RawStore.HasValues() {
+			return ErrRawValuesNotKept
+		}
+		for _, label := range m.selectHosts(host) {
+			if !m.hostStats[label].RawStore.HasValues() {
+				return ErrRawValuesNotKept
+			}
+		}
+	}
+	return nil
+}
+
+// splitHostTarget returns target and host selector, e.g. ops_query@* returns ops_query and *
+func splitHostTarget(target string) (string, string) {
+	if n := strings.LastIndex(target, HostSeparator); n >= 0 {
+		return target[:n], target[n+1:]
+	}
+	return target, ""
+}
+
+// selectHosts returns hosts matching a selector, * selects all hosts
+func (m *Metrics) selectHosts(selector string) []string {
+	var hosts []string
+	for _, host := range m.hosts {
+		if host == selector {
+			return []string{host}
+		} else if matched, _ := path.Match(selector, host); matched {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// getTargetData returns data of a target from stats
+func (m *Metrics) getTargetData(ftdc *FTDCStats, target TargetDoc, qr QueryRequest) []interface{} {
+	var tsData []interface{}
+	if target.Type == "timeserie" {
+		if target.Target == "replication_lags" && len(ftdc.ReplicationLags) > 0 { // replaced with actual hostname
+			for k, v := range ftdc.ReplicationLags {
+				data := v
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "disks_utils" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.Utilization
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "disks_iops" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.IOPS
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "disks_queue_length" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.IOInProgress
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "read_time_ms" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.ReadTimeMS
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "write_time_ms" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.WriteTimeMS
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if target.Target == "io_queued_ms" && len(ftdc.DiskStats) > 0 {
+			for k, v := range ftdc.DiskStats {
+				data := v.IOQueuedMS
+				data.Target = k
+				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+			}
+		} else if IsRawTarget(target.Target) {
+			if ftdc.RawStore != nil {
+				for _, data := range ftdc.RawStore.GetTimeSeriesDocs(target.Target) {
 					tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
 				}
-			} else {
-				data := ftdc.TimeSeriesData[target.Target]
-				data.Target = GetShortLabel(target.Target)
-				tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
 			}
-		} else if target.Type == "table" {
-			if target.Target == "host_info" {
-				headerList := []bson.M{}
-				rowList := [][]string{}
-				headerList = append(headerList, bson.M{"text": "Configurations", "type": "String"})
-				rowList = append(rowList, []string{fmt.Sprintf(`MongoDB v%v`, m.ftdcStats.ServerInfo.BuildInfo.Version)})
-				rowList = append(rowList, []string{fmt.Sprintf(`CPU: %v cores (%v)`,
-					m.ftdcStats.ServerInfo.HostInfo.System.NumCores,
-					m.ftdcStats.ServerInfo.HostInfo.System.CPUArch)})
-				if m.verbose {
-					rowList = append(rowList, []string{fmt.Sprintf(`Host: %v`, m.ftdcStats.ServerInfo.HostInfo.System.Hostname)})
+		} else {
+			data := ftdc.TimeSeriesData[target.Target]
+			data.Target = GetShortLabel(target.Target)
+			tsData = append(tsData, FilterTimeSeriesData(data, qr.Range.From, qr.Range.To))
+		}
+	} else if target.Type == "table" {
+		if target.Target == "host_info" {
+			headerList := []bson.M{}
+			rowList := [][]string{}
+			headerList = append(headerList, bson.M{"text": "Configurations", "type": "String"})
+			rowList = append(rowList, []string{fmt.Sprintf(`MongoDB v%v`, ftdc.ServerInfo.BuildInfo.Version)})
+			rowList = append(rowList, []string{fmt.Sprintf(`CPU: %v cores (%v)`,
+				ftdc.ServerInfo.HostInfo.System.NumCores,
+				ftdc.ServerInfo.HostInfo.System.CPUArch)})
+			if m.verbose {
+				rowList = append(rowList, []string{fmt.Sprintf(`Host: %v`, ftdc.ServerInfo.HostInfo.System.Hostname)})
+			}
+			rowList = append(rowList, []string{fmt.Sprintf(`Memory: %v`,
+				gox.GetStorageSize(1024*1024*ftdc.ServerInfo.HostInfo.System.MemSizeMB))})
+			rowList = append(rowList, []string{ftdc.ServerInfo.HostInfo.OS.Type + " (" + ftdc.ServerInfo.HostInfo.OS.Version + ")"})
+			rowList = append(rowList, []string{ftdc.ServerInfo.HostInfo.OS.Name})
+			doc := bson.M{"columns": headerList, "type": "table", "rows": rowList}
+			tsData = append(tsData, doc)
+		} else if target.Target == "member_states" {
+			tsData = append(tsData, getMemberStatesTable(ftdc.MemberStates, qr.Range.From, qr.Range.To))
+		} else if target.Target == "assessment" || strings.HasPrefix(target.Target, assessmentPrefix) {
+			as := NewAssessment(*ftdc)
+			as.SetVerbose(m.verbose)
+			as.SetScoringProfile(m.profile)
+			if name := strings.TrimPrefix(target.Target, assessmentPrefix); name != target.Target {
+				profile, err := GetScoringProfile(name)
+				if err != nil {
+					log.Println(err)
+					return tsData
 				}
-				rowList = append(rowList, []string{fmt.Sprintf(`Memory: %v`,
-					gox.GetStorageSize(1024*1024*m.ftdcStats.ServerInfo.HostInfo.System.MemSizeMB))})
-				rowList = append(rowList, []string{m.ftdcStats.ServerInfo.HostInfo.OS.Type + " (" + m.ftdcStats.ServerInfo.HostInfo.OS.Version + ")"})
-				rowList = append(rowList, []string{m.ftdcStats.ServerInfo.HostInfo.OS.Name})
-				doc := bson.M{"columns": headerList, "type": "table", "rows": rowList}
-				tsData = append(tsData, doc)
-			} else if target.Target == "assessment" {
-				as := NewAssessment(ftdc)
-				as.SetVerbose(m.verbose)
-				tsData = append(tsData, as.GetAssessment(qr.Range.From, qr.Range.To))
+				as.SetScoringProfile(profile)
 			}
+			tsData = append(tsData, as.GetAssessment(qr.Range.From, qr.Range.To))
 		}
 	}
-	json.NewEncoder(w).Encode(tsData)
+	return tsData
 }
 
-// AddFTDCDetailStats assign FTDC values
+// AddFTDCDetailStats assign FTDC values to the default host
 func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
-	m.RLock()
-	defer m.RUnlock()
-	ftdc := &m.ftdcStats
+	m.Lock()
+	defer m.Unlock()
+	m.mergeFTDCDetailStats(&m.ftdcStats, diag)
+}
+
+// AddHostFTDCDetailStats assign FTDC values to a host, the first host becomes the default host
+func (m *Metrics) AddHostFTDCDetailStats(host string, diag *DiagnosticData) {
+	m.Lock()
+	defer m.Unlock()
+	m.mergeFTDCDetailStats(m.getHostStats(host), diag)
+}
+
+// setHostFTDCStats assigns processed stats to a host, series not cached are computed
+func (m *Metrics) setHostFTDCStats(host string, stats FTDCStats) {
+	m.Lock()
+	defer m.Unlock()
+	ftdc := m.getHostStats(host)
+	*ftdc = stats
+	if ftdc.TimeSeriesData == nil {
+		m.setTimeSeriesData(ftdc)
+	}
+	m.resetAnomalyAnnotations(ftdc)
+}
+
+// getHostStats returns stats of a host and adds the host if not found, the caller holds the lock
+func (m *Metrics) getHostStats(host string) *FTDCStats {
+	if m.hostStats == nil {
+		m.hostStats = map[string]*FTDCStats{}
+	}
+	ftdc, ok := m.hostStats[host]
+	if !ok {
+		ftdc = &FTDCStats{}
+		if len(m.hosts) == 0 {
+			ftdc = &m.ftdcStats
+		}
+		m.hosts = append(m.hosts, host)
+		m.hostStats[host] = ftdc
+	}
+	return ftdc
+}
+
+// mergeFTDCDetailStats merges diagnostic data into stats, the caller holds the lock
+func (m *Metrics) mergeFTDCDetailStats(ftdc *FTDCStats, diag *DiagnosticData) {
+	m.mergeDiagnosticData(ftdc, diag)
+	btm := time.Now()
+	m.setTimeSeriesData(ftdc)
+	etm := time.Now()
+	if m.verbose {
+		log.Println("data points added for", ftdc.ServerInfo.HostInfo.System.Hostname, ", time spent:", etm.Sub(btm).String())
+	}
+}
+
+// mergeDiagnosticData merges samples of diagnostic data after the last ones of stats, series
+// are not computed, the caller holds the lock
+func (m *Metrics) mergeDiagnosticData(ftdc *FTDCStats, diag *DiagnosticData) {
+	m.resetAnomalyAnnotations(ftdc)
 
 	sort.Slice(diag.ReplSetStatusList, func(i int, j int) bool {
 		return diag.ReplSetStatusList[i].Date.Before(diag.ReplSetStatusList[j].Date)
@@ -319,6 +842,7 @@ func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
 			}
 		}
 	}
+	ftdc.ServerStatusColumns.merge(diag.ServerStatusColumns)
 
 	sort.Slice(diag.SystemMetricsList, func(i int, j int) bool {
 		return diag.SystemMetricsList[i].Start.Before(diag.SystemMetricsList[j].Start)
@@ -335,8 +859,18 @@ func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
 		}
 	}
 
+	ftdc.MemberStates = GetMemberStateTimeline(append(ftdc.MemberStates, diag.MemberStates...))
+	if ftdc.RawStore == nil {
+		ftdc.RawStore = NewRawStore()
+	}
+	ftdc.RawStore.merge(diag.RawStore)
+
 	b, _ := json.Marshal(diag.ServerInfo)
-	btm := time.Now()
+	json.Unmarshal(b, &ftdc.ServerInfo)
+}
+
+// setTimeSeriesData computes series of samples of stats, the caller holds the lock
+func (m *Metrics) setTimeSeriesData(ftdc *FTDCStats) {
 	var replicationTSD map[string]TimeSeriesDoc
 	var systemMetricsTSD map[string]TimeSeriesDoc
 
@@ -354,8 +888,12 @@ func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		// Single pass for all ServerStatus-based metrics (ServerStatus, WiredTiger, Queues, Transactions, tcmalloc, FlowControl)
-		ftdc.TimeSeriesData = getAllServerStatusTimeSeriesDoc(ftdc.ServerStatusList)
+		// All ServerStatus-based metrics (ServerStatus, WiredTiger, Queues, Transactions, tcmalloc, FlowControl)
+		if ftdc.ServerStatusColumns.Len() > 0 {
+			ftdc.TimeSeriesData = getColumnsTimeSeriesDoc(ftdc.ServerStatusColumns) // of FTDC files
+		} else {
+			ftdc.TimeSeriesData = getAllServerStatusTimeSeriesDoc(ftdc.ServerStatusList) // of keyhole stats
+		}
 	}()
 	wg.Wait()
 
@@ -366,13 +904,8 @@ func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
 	for k, v := range systemMetricsTSD {
 		ftdc.TimeSeriesData[k] = v
 	}
-	json.Unmarshal(b, &ftdc.ServerInfo)
-	if len(m.ftdcStats.TimeSeriesData["wt_cache_max"].DataPoints) > 0 && len(m.ftdcStats.TimeSeriesData["wt_cache_max"].DataPoints[0]) > 0 {
-		m.ftdcStats.MaxWTCache = m.ftdcStats.TimeSeriesData["wt_cache_max"].DataPoints[0][0]
-	}
-	etm := time.Now()
-	if m.verbose {
-		log.Println("data points added for", m.ftdcStats.ServerInfo.HostInfo.System.Hostname, ", time spent:", etm.Sub(btm).String())
+	if ftdc.TimeSeriesData["wt_cache_max"].Len() > 0 {
+		ftdc.MaxWTCache = ftdc.TimeSeriesData["wt_cache_max"].Values[0]
 	}
 }
 
@@ -380,57 +913,56 @@ func (m *Metrics) AddFTDCDetailStats(diag *DiagnosticData) {
 // Uses bucket aggregation with avg to downsample while preserving data integrity
 func FilterTimeSeriesData(tsData TimeSeriesDoc, from time.Time, to time.Time) TimeSeriesDoc {
 	maxPoints := 1800 // max data points to return to Grafana
-	if len(tsData.DataPoints) == 0 {
+	if tsData.Len() == 0 {
 		return tsData
 	}
-	var data = TimeSeriesDoc{Target: tsData.Target, DataPoints: [][]float64{}}
-	fidx := findClosestDataPointIndex(tsData.DataPoints, float64(from.UnixNano()/1000000))
-	eidx := findClosestDataPointIndex(tsData.DataPoints, float64(to.UnixNano()/1000000))
-	points := tsData.DataPoints[fidx:eidx]
-	if len(points) == 0 || math.IsNaN(points[0][0]) {
+	var data = TimeSeriesDoc{Target: tsData.Target}
+	fidx := findClosestDataPointIndex(tsData.Times, float64(from.UnixNano()/1000000))
+	eidx := findClosestDataPointIndex(tsData.Times, float64(to.UnixNano()/1000000))
+	points := tsData.Slice(fidx, eidx)
+	if points.Len() == 0 || math.IsNaN(points.Values[0]) {
 		return data
 	}
 
-	if len(points) > maxPoints {
+	if points.Len() > maxPoints {
 		// Bucket aggregation using avg
-		bucketSize := len(points) / maxPoints
+		bucketSize := points.Len() / maxPoints
 		if bucketSize < 1 {
 			bucketSize = 1
 		}
-		samples := make([][]float64, 0, maxPoints)
-		for i := 0; i < len(points); i += bucketSize {
+		data.Times = make([]float64, 0, maxPoints+1)
+		data.Values = make([]float64, 0, maxPoints+1)
+		for i := 0; i < points.Len(); i += bucketSize {
 			end := i + bucketSize
-			if end > len(points) {
-				end = len(points)
+			if end > points.Len() {
+				end = points.Len()
 			}
-			bucket := points[i:end]
+			bucket := points.Values[i:end]
 			if len(bucket) == 0 {
 				continue
 			}
 			// Calculate average value for this bucket
 			sum := 0.0
-			for _, dp := range bucket {
-				sum += dp[0]
+			for _, v := range bucket {
+				sum += v
 			}
 			avg := sum / float64(len(bucket))
 			// Use the last timestamp in the bucket
-			timestamp := bucket[len(bucket)-1][1]
-			samples = append(samples, []float64{avg, timestamp})
+			data.Times = append(data.Times, points.Times[end-1])
+			data.Values = append(data.Values, avg)
 		}
-		data.DataPoints = samples
-	} else {
-		data.DataPoints = points
+		return data
 	}
-	return data
+	return points
 }
 
 // perform binary search
-func findClosestDataPointIndex(arr [][]float64, target float64) int {
+func findClosestDataPointIndex(arr []float64, target float64) int {
 	n := len(arr)
-	if target <= arr[0][1] {
+	if target <= arr[0] {
 		return 0
 	}
-	if target >= arr[n-1][1] {
+	if target >= arr[n-1] {
 		return n - 1
 	}
 	i := 0
@@ -438,20 +970,20 @@ func findClosestDataPointIndex(arr [][]float64, target float64) int {
 	mid := 0
 	for i < j {
 		mid = (i + j) / 2
-		if arr[mid][1] == target {
+		if arr[mid] == target {
 			return mid
 		}
-		if target < arr[mid][1] {
-			if mid > 0 && target > arr[mid-1][1] {
-				if target-arr[mid-1][1] >= arr[mid][1] {
+		if target < arr[mid] {
+			if mid > 0 && target > arr[mid-1] {
+				if target-arr[mid-1] >= arr[mid] {
 					return mid
 				}
 				return mid - 1
 			}
 			j = mid
 		} else {
-			if mid < n-1 && target < arr[mid+1][1] {
-				if target-arr[mid-1][1] >= arr[mid][1] {
+			if mid < n-1 && target < arr[mid+1] {
+				if target-arr[mid-1] >= arr[mid] {
 					return mid
 				}
 				return mid - 1
@@ -0,0 +1,208 @@
+// Copyright 2019-present Kuei-chun Chen. All rights reserved.
+// metrics_test.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProcessFilesMultiHosts(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	writeTestFile(t, filepath.Join(dir, "shard01-a/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000"), "shard01-a", start, 100)
+	writeTestFile(t, filepath.Join(dir, "node2/diagnostic.data/metrics.2020-05-13T14-20-19Z-00000"), "", start, 50)
+
+	m := &Metrics{}
+	if err := m.ProcessFiles([]string{filepath.Join(dir, "shard01-a/diagnostic.data"), filepath.Join(dir, "node2/diagnostic.data")}); err != nil {
+		t.Fatal(err)
+	}
+	hosts := m.GetHosts()
+	if len(hosts) != 2 || hosts[0] != "shard01-a" || hosts[1] != "node2" {
+		t.Fatalf("expected hosts in the order of arguments, got %v", hosts)
+	}
+	if m.GetFTDCStats().ServerStatusColumns.Len() != 99 {
+		t.Fatalf("expected default host shard01-a, got %d samples", m.GetFTDCStats().ServerStatusColumns.Len())
+	}
+
+	body := `{"range": {"from": "2020-05-13T14:00:00Z", "to": "2020-05-13T15:00:00Z"},
+		"targets": [{"target": "ops_query@*", "type": "timeserie"}, {"target": "ops_query@shard01-a", "type": "timeserie"}]}`
+	w := httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/query", strings.NewReader(body)))
+	var docs []TimeSeriesDoc
+	if err := json.Unmarshal(w.Body.Bytes(), &docs); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 || docs[0].Target != "query@shard01-a" || docs[1].Target != "query@node2" || docs[2].Target != "query@shard01-a" {
+		t.Fatalf("unexpected targets %v", docs)
+	}
+
+	w = httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/search", strings.NewReader(`{"target": "ops_query@sh"}`)))
+	if strings.TrimSpace(w.Body.String()) != `["ops_query@*","ops_query@shard01-a"]` {
+		t.Fatalf("unexpected search result %v", w.Body.String())
+	}
+}
+
+func TestGetHostLabel(t *testing.T) {
+	hostInfo := bson.M{"system": bson.M{"hostname": "mongod-1"}}
+	diag := &DiagnosticData{ServerInfo: bson.M{"hostInfo": hostInfo, "getCmdLineOpts": bson.M{"parsed": bson.M{"net": bson.M{"port": 27018}}}}}
+	if host := getHostLabel(diag, "a/diagnostic.data"); host != "mongod-1:27018" {
+		t.Fatalf("expected port of cmdLine, got %v", host)
+	}
+	diag = &DiagnosticData{ServerInfo: bson.M{"hostInfo": hostInfo}, ServerStatusList: []ServerStatusDoc{{Host: "mongod-1.local:27019"}}}
+	if host := getHostLabel(diag, "a/diagnostic.data"); host != "mongod-1:27019" {
+		t.Fatalf("expected port of serverStatus host, got %v", host)
+	}
+	if host := getHostLabel(&DiagnosticData{}, "a/diagnostic.data"); host != "a" {
+		t.Fatalf("expected directory name, got %v", host)
+	}
+
+	// members on the same machine without ports are labeled by directory names
+	dir := t.TempDir()
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	for _, name := range []string{"rs1", "rs2", "cfg"} {
+		writeTestFile(t, filepath.Join(dir, name, "diagnostic.data/metrics.2020-05-13T14-20-19Z-00000"), "localhost", start, 30)
+	}
+	m := &Metrics{}
+	err := m.ProcessFiles([]string{filepath.Join(dir, "rs2/diagnostic.data"), filepath.Join(dir, "rs1/diagnostic.data"),
+		filepath.Join(dir, "cfg/diagnostic.data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := m.GetHosts(); len(hosts) != 3 || hosts[0] != "localhost" || hosts[1] != "rs1" || hosts[2] != "cfg" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestProcessFilesCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "ftdc.cache")
+	ddir := filepath.Join(dir, "diagnostic.data")
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	first := filepath.Join(ddir, "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, first, "shard01-a", start, 100)
+
+	m := &Metrics{}
+	m.SetCacheFile(cacheFile)
+	if err := m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := ReadCache(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Hosts) != 1 || cache.Hosts[0].Host != "shard01-a" || len(cache.Hosts[0].Files) != 1 {
+		t.Fatalf("unexpected cache %v", cache.Hosts)
+	}
+
+	// the first file is loaded from cache, and the new file is decoded
+	writeTestFile(t, filepath.Join(ddir, "metrics.2020-05-13T14-22-19Z-00000"), "shard01-a", start.Add(2*time.Minute), 60)
+	m = &Metrics{}
+	m.SetCacheFile(cacheFile)
+	if err = m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 99+59 {
+		t.Fatalf("expected %d samples, got %d", 99+59, n)
+	}
+	if m.GetFTDCStats().TimeSeriesData["ops_query"].Len() == 0 {
+		t.Fatal("expected time series data")
+	}
+	if cache, err = ReadCache(cacheFile); err != nil || len(cache.Hosts[0].Files) != 2 {
+		t.Fatalf("unexpected cache %v %v", cache, err)
+	}
+
+	// series of cached stats share time columns
+	m = &Metrics{}
+	m.SetCacheFile(cacheFile)
+	if err = m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	gauge, rate := m.GetFTDCStats().TimeSeriesData["mem_resident"], m.GetFTDCStats().TimeSeriesData["ops_query"]
+	if n := gauge.Len(); n == 0 || rate.Len() == 0 || &gauge.Times[n-1] != &rate.Times[rate.Len()-1] {
+		t.Fatal("expected shared times")
+	}
+
+	// the cache is not used once a cached file is removed, e.g. rotated by mongod
+	os.Remove(first)
+	m = &Metrics{}
+	m.SetCacheFile(cacheFile)
+	if err = m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 59 {
+		t.Fatalf("expected %d samples, got %d", 59, n)
+	}
+	if cache, err = ReadCache(cacheFile); err != nil || len(cache.Hosts[0].Files) != 1 {
+		t.Fatalf("unexpected cache %v %v", cache, err)
+	}
+
+	// options must match
+	m = &Metrics{}
+	m.SetCacheFile(cacheFile)
+	m.SetPreserveValues(true)
+	if err = m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 59 {
+		t.Fatalf("expected %d samples, got %d", 59, n)
+	}
+}
+
+func TestProcessFilesCacheLatest(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "ftdc.cache")
+	ddir := filepath.Join(dir, "diagnostic.data")
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	writeTestFile(t, filepath.Join(ddir, "metrics.2020-05-13T14-20-19Z-00000"), "shard01-a", start, 100)
+	writeTestFile(t, filepath.Join(ddir, "metrics.2020-05-13T14-22-19Z-00000"), "shard01-a", start.Add(2*time.Minute), 60)
+
+	m := &Metrics{}
+	m.SetCacheFile(cacheFile)
+	m.SetLatest(1)
+	if err := m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 59 {
+		t.Fatalf("expected %d samples, got %d", 59, n)
+	}
+
+	// files excluded by latest are decoded without it
+	m = &Metrics{}
+	m.SetCacheFile(cacheFile)
+	if err := m.ProcessFiles([]string{ddir}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.GetFTDCStats().ServerStatusColumns.Len(); n != 99+59 {
+		t.Fatalf("expected %d samples, got %d", 99+59, n)
+	}
+}
+
+func TestGetFilesToDecode(t *testing.T) {
+	tm := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	ch := &CacheHost{Files: []CacheFile{{"metrics.1", tm, 100}, {"metrics.2", tm, 100}, {"metrics.interim", tm, 10}}}
+	files, err := ch.getFilesToDecode([]CacheFile{{"metrics.1", tm, 100}, {"metrics.2", tm.Add(time.Second), 200},
+		{"metrics.3", tm, 100}, {"metrics.interim", tm.Add(time.Second), 10}})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v %v", files, err)
+	}
+	if _, err = ch.getFilesToDecode([]CacheFile{{"metrics.1", tm, 50}, {"metrics.2", tm, 100}}); err == nil {
+		t.Fatal("expected error of a changed file")
+	}
+	if _, err = ch.getFilesToDecode([]CacheFile{{"metrics.0", tm, 50}, {"metrics.1", tm, 100}, {"metrics.2", tm, 100}}); err == nil {
+		t.Fatal("expected error of an older file not cached")
+	}
+	if _, err = ch.getFilesToDecode([]CacheFile{{"metrics.2", tm, 100}, {"metrics.3", tm, 100}}); err == nil {
+		t.Fatal("expected error of a removed file")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/simagix/gox"
+	"github.com/simagix/mongo-ftdc/decoder"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -60,6 +61,26 @@ func (o *Obfuscator) ObfuscateFile(inputPath, outputPath string) error {
 	return nil
 }
 
+// ObfuscateReader reads FTDC data from a reader, e.g. an archive member, obfuscates PII,
+// and writes to a writer
+func (o *Obfuscator) ObfuscateReader(r io.Reader, w io.Writer) error {
+	buffer, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	obfuscated, err := o.obfuscateBuffer(buffer)
+	if err != nil {
+		return fmt.Errorf("failed to obfuscate: %w", err)
+	}
+
+	if _, err = w.Write(obfuscated); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
 // obfuscateBuffer processes the entire FTDC buffer
 func (o *Obfuscator) obfuscateBuffer(buffer []byte) ([]byte, error) {
 	var result bytes.Buffer
@@ -163,27 +184,8 @@ func (o *Obfuscator) obfuscateCompressedData(data []byte) ([]byte, error) {
 	newDecompressed.Write(newDocBytes)
 	newDecompressed.Write(decompressed[docSize:]) // keep the delta data as-is
 
-	// Recompress
-	var compressed bytes.Buffer
-	w := zlib.NewWriter(&compressed)
-	w.Write(newDecompressed.Bytes())
-	w.Close()
-
-	// Rebuild with size prefix
-	// Update the uncompressed size
-	newSize := uint32(newDecompressed.Len())
-	newSizeBytes := []byte{
-		byte(newSize),
-		byte(newSize >> 8),
-		byte(newSize >> 16),
-		byte(newSize >> 24),
-	}
-
-	var result bytes.Buffer
-	result.Write(newSizeBytes)
-	result.Write(compressed.Bytes())
-
-	return result.Bytes(), nil
+	// Recompress with the updated uncompressed size prefix
+	return decoder.CompressBlock(newDecompressed.Bytes())
 }
 
 // obfuscateBsonD recursively obfuscates a bson.D document
@@ -4,6 +4,8 @@
 package ftdc
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -245,3 +247,26 @@ func TestObfuscator_ObfuscateFile(t *testing.T) {
 	mappings := o.GetMappings()
 	t.Logf("Obfuscation mappings: %+v", mappings)
 }
+
+func TestObfuscator_ObfuscateReader(t *testing.T) {
+	o := NewObfuscator()
+	var hosts []string
+	err := WalkArchive(getTestBundle(t, ".tar.gz"), func(member ArchiveMember, r io.Reader) error {
+		var buf bytes.Buffer
+		if err := o.ObfuscateReader(r, &buf); err != nil {
+			return err
+		}
+		diag := NewDiagnosticData().readDiagnosticStream(member.Name, &buf)
+		if diag.ServerStatusColumns.Len() == 0 {
+			t.Fatalf("expected samples of %v", member.Name)
+		}
+		hosts = append(hosts, getHostLabel(&diag, "node2/diagnostic.data"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 || hosts[2] == "shard01-a" || hosts[2] == "node2" {
+		t.Fatalf("expected obfuscated hostname, got %v", hosts)
+	}
+}
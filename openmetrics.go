@@ -0,0 +1,143 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// openmetrics.go
+
+package ftdc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricPrefix is the prefix of exported metric names
+const MetricPrefix = "mongodb_ftdc_"
+
+// ExportSeries is a labeled time series for exporting
+type ExportSeries struct {
+	Name   string
+	Labels [][2]string // sorted by name, excluding __name__
+	Times  []float64   // milliseconds
+	Values []float64
+}
+
+var diskExportNames = []string{"disk_iops", "disk_io_in_progress", "disk_io_queued_ms", "disk_read_time_ms", "disk_utilization", "disk_write_time_ms"}
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// SanitizeMetricName returns a valid Prometheus metric name, e.g. conns_created/s to mongodb_ftdc_conns_created_per_second
+func SanitizeMetricName(name string) string {
+	if strings.HasSuffix(name, "/s") {
+		name = strings.TrimSuffix(name, "/s") + "_per_second"
+	}
+	name = invalidMetricChars.ReplaceAllString(name, "_")
+	return MetricPrefix + strings.Trim(name, "_")
+}
+
+// GetExportSeries returns time series, disk stats and replication lags of a host
+func GetExportSeries(host string, ftdc FTDCStats) []ExportSeries {
+	var list []ExportSeries
+	var replset string
+	if n := len(ftdc.ReplSetStatusList); n > 0 {
+		replset = ftdc.ReplSetStatusList[n-1].Set
+	}
+	labels := func(kv ...string) [][2]string {
+		pairs := [][2]string{{"host", host}}
+		if replset != "" {
+			pairs = append(pairs, [2]string{"replset", replset})
+		}
+		for i := 0; i+1 < len(kv); i += 2 {
+			pairs = append(pairs, [2]string{kv[i], kv[i+1]})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+		return pairs
+	}
+
+	var names []string
+	for name := range ftdc.TimeSeriesData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "replication_lags" || ftdc.TimeSeriesData[name].Len() == 0 {
+			continue
+		}
+		list = append(list, ExportSeries{Name: SanitizeMetricName(name), Labels: labels(),
+			Times: ftdc.TimeSeriesData[name].Times, Values: ftdc.TimeSeriesData[name].Values})
+	}
+
+	var disks []string
+	for disk := range ftdc.DiskStats {
+		disks = append(disks, disk)
+	}
+	sort.Strings(disks)
+	for _, disk := range disks {
+		ds := ftdc.DiskStats[disk]
+		for i, tsd := range []TimeSeriesDoc{ds.IOPS, ds.IOInProgress, ds.IOQueuedMS, ds.ReadTimeMS, ds.Utilization, ds.WriteTimeMS} {
+			list = append(list, ExportSeries{Name: SanitizeMetricName(diskExportNames[i]), Labels: labels("disk", disk),
+				Times: tsd.Times, Values: tsd.Values})
+		}
+	}
+
+	var members []string
+	for member := range ftdc.ReplicationLags {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		list = append(list, ExportSeries{Name: SanitizeMetricName("replication_lag_seconds"), Labels: labels("member", member),
+			Times: ftdc.ReplicationLags[member].Times, Values: ftdc.ReplicationLags[member].Values})
+	}
+	return list
+}
+
+// WriteOpenMetrics writes FTDC stats by host in OpenMetrics text format
+func WriteOpenMetrics(w io.Writer, stats map[string]FTDCStats) error {
+	var hosts []string
+	for host := range stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	families := map[string][]ExportSeries{}
+	var names []string
+	for _, host := range hosts {
+		for _, series := range GetExportSeries(host, stats[host]) {
+			if _, ok := families[series.Name]; !ok {
+				names = append(names, series.Name)
+			}
+			families[series.Name] = append(families[series.Name], series)
+		}
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names { // samples of a metric family must be together
+		fmt.Fprintf(bw, "# TYPE %v gauge\n", name)
+		for _, series := range families[name] {
+			labels := formatLabels(series.Labels)
+			for i, v := range series.Values {
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					continue
+				}
+				fmt.Fprintf(bw, "%v%v %v %v\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64),
+					strconv.FormatFloat(series.Times[i]/1000, 'f', 3, 64))
+			}
+		}
+	}
+	fmt.Fprintln(bw, "# EOF")
+	return bw.Flush()
+}
+
+func formatLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var pairs []string
+	for _, l := range labels {
+		pairs = append(pairs, l[0]+"="+strconv.Quote(l[1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,135 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// openmetrics_test.go
+
+package ftdc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func getTestExportStats() map[string]FTDCStats {
+	ms := 1589379619000.0
+	return map[string]FTDCStats{
+		"shard01-a": {
+			ReplSetStatusList: []ReplSetStatusDoc{{Set: "shard01"}},
+			TimeSeriesData: map[string]TimeSeriesDoc{
+				"conns_created/s": NewTimeSeriesDoc("conns_created/s", [][]float64{{1.5, ms}, {2, ms + 1000}}),
+				"ops_query":       NewTimeSeriesDoc("ops_query", [][]float64{{12, ms}}),
+			},
+			DiskStats: map[string]DiskStats{"nvme0n1": {IOPS: NewTimeSeriesDoc("iops", [][]float64{{300, ms}})}},
+			ReplicationLags: map[string]TimeSeriesDoc{
+				"shard01-b:27017": NewTimeSeriesDoc("shard01-b:27017", [][]float64{{3, ms}}),
+			},
+		},
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, getTestExportStats()); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, line := range []string{
+		"# TYPE mongodb_ftdc_conns_created_per_second gauge\n",
+		`mongodb_ftdc_conns_created_per_second{host="shard01-a",replset="shard01"} 1.5 1589379619.000` + "\n",
+		`mongodb_ftdc_conns_created_per_second{host="shard01-a",replset="shard01"} 2 1589379620.000` + "\n",
+		`mongodb_ftdc_disk_iops{disk="nvme0n1",host="shard01-a",replset="shard01"} 300 1589379619.000` + "\n",
+		`mongodb_ftdc_replication_lag_seconds{host="shard01-a",member="shard01-b:27017",replset="shard01"} 3 1589379619.000` + "\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("expected %q in\n%v", line, text)
+		}
+	}
+	if !strings.HasSuffix(text, "# EOF\n") {
+		t.Fatal("expected # EOF")
+	}
+	if strings.Count(text, "# TYPE mongodb_ftdc_disk_iops gauge") != 1 {
+		t.Fatal("expected one TYPE line per metric family")
+	}
+}
+
+func TestRemoteWriter(t *testing.T) {
+	var requests, samples int
+	var names []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests++
+		for _, ts := range getTestFields(data, 1) {
+			labels := getTestFields(ts, 1)
+			names = append(names, string(getTestFields(labels[0], 2)[0]))
+			samples += len(getTestFields(ts, 2))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	rw := NewRemoteWriter(server.URL)
+	rw.SetBatchSize(2)
+	n, err := rw.Write(getTestExportStats())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || samples != 5 || requests != 3 {
+		t.Fatalf("expected 5 samples in 3 requests, got %d, %d in %d", n, samples, requests)
+	}
+	if names[0] != "mongodb_ftdc_conns_created_per_second" {
+		t.Fatalf("unexpected metric name %v", names[0])
+	}
+	if _, err = NewRemoteWriter(server.URL + "/404").Write(map[string]FTDCStats{}); err != nil {
+		t.Fatal("expected no requests without data")
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	data := encodeWriteRequest([]ExportSeries{{Name: "m", Labels: [][2]string{{"host", "h"}}, Times: []float64{1000}, Values: []float64{2.5}}})
+	ts := getTestFields(data, 1)[0]
+	sample := getTestFields(ts, 2)[0]
+	if sample[0] != 1<<3|1 || math.Float64frombits(binary.LittleEndian.Uint64(sample[1:9])) != 2.5 {
+		t.Fatalf("unexpected value in %v", sample)
+	}
+	if sample[9] != 2<<3 || sample[10] != 0xe8 || sample[11] != 0x07 { // varint 1000
+		t.Fatalf("unexpected timestamp in %v", sample)
+	}
+}
+
+// getTestFields returns length-delimited fields of a protobuf message
+func getTestFields(data []byte, field int) [][]byte {
+	var fields [][]byte
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(data)
+			data = data[n:]
+		case 1:
+			data = data[8:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			if int(key>>3) == field {
+				fields = append(fields, data[n:n+int(size)])
+			}
+			data = data[n+int(size):]
+		}
+	}
+	return fields
+}
@@ -0,0 +1,253 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// parquet.go
+
+package ftdc
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// ParquetRowGroupSize is the max number of rows per row group
+const ParquetRowGroupSize = 100000
+
+// parquet format constants, see parquet.thrift
+const (
+	parquetInt64           = 2
+	parquetDouble          = 5
+	parquetRequired        = 0
+	parquetOptional        = 1
+	parquetTimestampMillis = 9
+	parquetPlain           = 0
+	parquetRLE             = 3
+	parquetDataPage        = 0
+	parquetUncompressed    = 0
+)
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// WriteParquet writes the table in Parquet, uncompressed and PLAIN encoded.
+// timestamp is a required TIMESTAMP_MILLIS column, and metrics are optional doubles.
+func (t *ExportTable) WriteParquet(w io.Writer) error {
+	pw := &parquetWriter{w: w}
+	pw.write([]byte("PAR1"))
+	var rowGroups []parquetRowGroup
+	for begin := 0; begin < len(t.Times) && pw.err == nil; begin += ParquetRowGroupSize {
+		end := begin + ParquetRowGroupSize
+		if end > len(t.Times) {
+			end = len(t.Times)
+		}
+		rg := parquetRowGroup{numRows: end - begin}
+		var page []byte
+		for _, ms := range t.Times[begin:end] {
+			page = binary.LittleEndian.AppendUint64(page, uint64(ms))
+		}
+		rg.columns = append(rg.columns, pw.writeColumn("timestamp", parquetInt64, page, rg.numRows))
+		for j, name := range t.Columns {
+			rg.columns = append(rg.columns, pw.writeColumn(name, parquetDouble, encodeOptionalDoubles(t.Values[j][begin:end]), rg.numRows))
+		}
+		rowGroups = append(rowGroups, rg)
+	}
+	footer := t.encodeFileMetaData(rowGroups)
+	pw.write(footer)
+	pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	pw.write([]byte("PAR1"))
+	return pw.err
+}
+
+type parquetWriter struct {
+	err    error
+	offset int64
+	w      io.Writer
+}
+
+type parquetRowGroup struct {
+	columns []parquetColumn
+	numRows int
+}
+
+type parquetColumn struct {
+	name     string
+	offset   int64
+	size     int64
+	typ      int
+	numRows  int
+	encoding []int
+}
+
+func (pw *parquetWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+// writeColumn writes a column chunk of a single data page
+func (pw *parquetWriter) writeColumn(name string, typ int, page []byte, numRows int) parquetColumn {
+	tw := newThriftWriter()
+	tw.i32(1, parquetDataPage)
+	tw.i32(2, int32(len(page)))
+	tw.i32(3, int32(len(page)))
+	tw.beginStruct(5) // DataPageHeader
+	tw.i32(1, int32(numRows))
+	tw.i32(2, parquetPlain)
+	tw.i32(3, parquetRLE)
+	tw.i32(4, parquetRLE)
+	tw.endStruct()
+	tw.endStruct()
+	col := parquetColumn{name: name, offset: pw.offset, typ: typ, numRows: numRows,
+		size: int64(len(tw.buf) + len(page)), encoding: []int{parquetPlain, parquetRLE}}
+	pw.write(tw.buf)
+	pw.write(page)
+	return col
+}
+
+// encodeOptionalDoubles returns definition levels and non-null values, NaN is null
+func encodeOptionalDoubles(values []float64) []byte {
+	var levels, data []byte
+	for i := 0; i < len(values); { // RLE runs of bit width 1
+		defined := !math.IsNaN(values[i])
+		n := 0
+		for ; i < len(values) && !math.IsNaN(values[i]) == defined; i++ {
+			if defined {
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(values[i]))
+			}
+			n++
+		}
+		levels = binary.AppendUvarint(levels, uint64(n)<<1)
+		if defined {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+	}
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	return append(page, data...)
+}
+
+// encodeFileMetaData returns the footer of the file
+func (t *ExportTable) encodeFileMetaData(rowGroups []parquetRowGroup) []byte {
+	tw := newThriftWriter()
+	tw.i32(1, 1) // version
+	tw.list(2, thriftStruct, len(t.Columns)+2)
+	tw.beginElem() // root
+	tw.str(4, "schema")
+	tw.i32(5, int32(len(t.Columns)+1))
+	tw.endStruct()
+	tw.beginElem()
+	tw.i32(1, parquetInt64)
+	tw.i32(3, parquetRequired)
+	tw.str(4, "timestamp")
+	tw.i32(6, parquetTimestampMillis)
+	tw.endStruct()
+	for _, name := range t.Columns {
+		tw.beginElem()
+		tw.i32(1, parquetDouble)
+		tw.i32(3, parquetOptional)
+		tw.str(4, name)
+		tw.endStruct()
+	}
+	tw.i64(3, int64(len(t.Times)))
+	tw.list(4, thriftStruct, len(rowGroups))
+	for _, rg := range rowGroups {
+		tw.beginElem()
+		tw.list(1, thriftStruct, len(rg.columns))
+		var total int64
+		for _, col := range rg.columns {
+			total += col.size
+			tw.beginElem() // ColumnChunk
+			tw.i64(2, col.offset)
+			tw.beginStruct(3) // ColumnMetaData
+			tw.i32(1, int32(col.typ))
+			tw.list(2, thriftI32, len(col.encoding))
+			for _, e := range col.encoding {
+				tw.buf = binary.AppendVarint(tw.buf, int64(e))
+			}
+			tw.list(3, thriftBinary, 1)
+			tw.buf = binary.AppendUvarint(tw.buf, uint64(len(col.name)))
+			tw.buf = append(tw.buf, col.name...)
+			tw.i32(4, parquetUncompressed)
+			tw.i64(5, int64(col.numRows))
+			tw.i64(6, col.size)
+			tw.i64(7, col.size)
+			tw.i64(9, col.offset)
+			tw.endStruct()
+			tw.endStruct()
+		}
+		tw.i64(2, total)
+		tw.i64(3, int64(rg.numRows))
+		tw.endStruct()
+	}
+	tw.str(6, "mongo-ftdc")
+	tw.endStruct()
+	return tw.buf
+}
+
+// thriftWriter encodes structs in thrift compact protocol
+type thriftWriter struct {
+	buf    []byte
+	lastID []int // last field id by nested struct
+}
+
+func newThriftWriter() *thriftWriter { return &thriftWriter{lastID: []int{0}} }
+
+func (tw *thriftWriter) field(id int, typ byte) {
+	n := len(tw.lastID) - 1
+	if delta := id - tw.lastID[n]; delta > 0 && delta <= 15 {
+		tw.buf = append(tw.buf, byte(delta<<4)|typ)
+	} else {
+		tw.buf = append(tw.buf, typ)
+		tw.buf = binary.AppendVarint(tw.buf, int64(id))
+	}
+	tw.lastID[n] = id
+}
+
+func (tw *thriftWriter) i32(id int, v int32) {
+	tw.field(id, thriftI32)
+	tw.buf = binary.AppendVarint(tw.buf, int64(v))
+}
+
+func (tw *thriftWriter) i64(id int, v int64) {
+	tw.field(id, thriftI64)
+	tw.buf = binary.AppendVarint(tw.buf, v)
+}
+
+func (tw *thriftWriter) str(id int, s string) {
+	tw.field(id, thriftBinary)
+	tw.buf = binary.AppendUvarint(tw.buf, uint64(len(s)))
+	tw.buf = append(tw.buf, s...)
+}
+
+func (tw *thriftWriter) list(id int, elemType byte, size int) {
+	tw.field(id, thriftList)
+	if size < 15 {
+		tw.buf = append(tw.buf, byte(size<<4)|elemType)
+	} else {
+		tw.buf = append(tw.buf, 0xf0|elemType)
+		tw.buf = binary.AppendUvarint(tw.buf, uint64(size))
+	}
+}
+
+func (tw *thriftWriter) beginStruct(id int) {
+	tw.field(id, thriftStruct)
+	tw.lastID = append(tw.lastID, 0)
+}
+
+// beginElem begins a struct element of a list
+func (tw *thriftWriter) beginElem() { tw.lastID = append(tw.lastID, 0) }
+
+func (tw *thriftWriter) endStruct() {
+	tw.buf = append(tw.buf, 0)
+	tw.lastID = tw.lastID[:len(tw.lastID)-1]
+}
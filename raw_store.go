@@ -0,0 +1,265 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// raw_store.go
+
+package ftdc
+
+import (
+	"errors"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+)
+
+// RawPrefix is the Grafana target prefix of raw FTDC metric paths
+const RawPrefix = "raw:"
+
+var rawModifiers = []string{"rate", "delta", "gauge"}
+
+// ErrRawValuesNotKept is returned by raw: queries of stats loaded without -raw
+var ErrRawValuesNotKept = errors.New("raw: queries require -raw, values of metric paths are not kept")
+
+// RawStore keeps raw FTDC metric paths, values are kept only if enabled
+type RawStore struct {
+	Chunks []RawChunk
+	Paths  map[string]bool
+}
+
+// RawChunk stores values of a decoded chunk
+type RawChunk struct {
+	Floats map[string][]float64 // preserved float values
+	Times  []float64            // milliseconds since epoch
+	Values map[string][]uint64
+}
+
+// NewRawStore returns *RawStore
+func NewRawStore() *RawStore {
+	return &RawStore{Paths: map[string]bool{}}
+}
+
+// add adds metric paths of a chunk, and values of samples if keepValues is true
+func (rs *RawStore) add(v *decoder.MetricsData, samples []int, keepValues bool) {
+	for key := range v.DataPointsMap {
+		rs.Paths[key] = true
+	}
+	if !keepValues || len(samples) == 0 {
+		return
+	}
+	localTimes := v.DataPointsMap["serverStatus/localTime"]
+	if len(localTimes) == 0 {
+		localTimes = v.DataPointsMap["start"]
+	}
+	if len(localTimes) <= samples[len(samples)-1] {
+		return
+	}
+	chunk := RawChunk{Times: make([]float64, len(samples)), Values: make(map[string][]uint64, len(v.DataPointsMap))}
+	for n, i := range samples {
+		chunk.Times[n] = float64(localTimes[i])
+	}
+	for key, values := range v.DataPointsMap {
+		chunk.Values[key] = getSampleValues(values, samples)
+	}
+	if v.FloatPointsMap != nil {
+		chunk.Floats = make(map[string][]float64, len(v.FloatPointsMap))
+		for key, values := range v.FloatPointsMap {
+			chunk.Floats[key] = getSampleValues(values, samples)
+		}
+	}
+	rs.Chunks = append(rs.Chunks, chunk)
+}
+
+// getSampleValues returns values of samples in ascending order, a subslice if samples are
+// consecutive, e.g. trimmed at the edges of a time range
+func getSampleValues[T uint64 | float64](values []T, samples []int) []T {
+	first, last := samples[0], samples[len(samples)-1]
+	if last >= len(values) {
+		return nil
+	}
+	if last-first == len(samples)-1 {
+		return values[first : last+1 : last+1]
+	}
+	picked := make([]T, len(samples))
+	for n, i := range samples {
+		picked[n] = values[i]
+	}
+	return picked
+}
+
+// merge appends chunks after the last one of the store, samples of a chunk overlapping the
+// last one are trimmed, e.g. of metrics.interim
+func (rs *RawStore) merge(other *RawStore) {
+	if other == nil {
+		return
+	}
+	for key := range other.Paths {
+		rs.Paths[key] = true
+	}
+	sort.Slice(other.Chunks, func(i int, j int) bool {
+		return other.Chunks[i].Times[0] < other.Chunks[j].Times[0]
+	})
+	for _, chunk := range other.Chunks {
+		if len(rs.Chunks) > 0 {
+			last := rs.Chunks[len(rs.Chunks)-1]
+			if chunk = chunk.after(last.Times[len(last.Times)-1]); len(chunk.Times) == 0 {
+				continue
+			}
+		}
+		rs.Chunks = append(rs.Chunks, chunk)
+	}
+}
+
+// after returns samples of a chunk after a time in milliseconds
+func (c RawChunk) after(t float64) RawChunk {
+	i := sort.SearchFloat64s(c.Times, math.Nextafter(t, math.Inf(1)))
+	if i == 0 {
+		return c
+	}
+	trimmed := RawChunk{Times: c.Times[i:], Values: map[string][]uint64{}}
+	for key, values := range c.Values {
+		if i < len(values) {
+			trimmed.Values[key] = values[i:]
+		}
+	}
+	if c.Floats != nil {
+		trimmed.Floats = map[string][]float64{}
+		for key, values := range c.Floats {
+			if i < len(values) {
+				trimmed.Floats[key] = values[i:]
+			}
+		}
+	}
+	return trimmed
+}
+
+// GetPaths returns sorted metric paths matching a pattern, * matches within a path segment
+func (rs *RawStore) GetPaths(pattern string) []string {
+	var paths []string
+	if !strings.ContainsAny(pattern, "*?[") {
+		if rs.Paths[pattern] {
+			paths = append(paths, pattern)
+		}
+		return paths
+	}
+	for key := range rs.Paths {
+		if matched, _ := path.Match(pattern, key); matched {
+			paths = append(paths, key)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// HasValues returns true if values of metric paths are kept
+func (rs *RawStore) HasValues() bool { return rs != nil && len(rs.Chunks) > 0 }
+
+// IsRawTarget returns true if a target is a raw path query, e.g. rate(raw:serverStatus/opcounters/insert)
+func IsRawTarget(target string) bool {
+	_, pattern := parseRawTarget(target)
+	return pattern != ""
+}
+
+// GetTimeSeriesDocs returns time series of a raw path query, e.g. raw:path, rate(raw:path),
+// delta(raw:path) or gauge(raw:path). Wildcards expand to a series per matched path.
+func (rs *RawStore) GetTimeSeriesDocs(target string) []TimeSeriesDoc {
+	var docs []TimeSeriesDoc
+	modifier, pattern := parseRawTarget(target)
+	if pattern == "" {
+		return docs
+	}
+	for _, key := range rs.GetPaths(pattern) {
+		label := RawPrefix + key
+		if modifier != "gauge" {
+			label = modifier + "(" + label + ")"
+		}
+		doc := rs.getDataPoints(key, modifier)
+		doc.Target = label
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// getDataPoints returns values and times of a path, rate is per second
+func (rs *RawStore) getDataPoints(key string, modifier string) TimeSeriesDoc {
+	var points TimeSeriesDoc
+	var hasPrev bool
+	var prevValue, prevTime float64
+	for _, chunk := range rs.Chunks {
+		values, ok := chunk.Values[key]
+		if !ok {
+			hasPrev = false
+			continue
+		}
+		floats := chunk.Floats[key]
+		for i, t := range chunk.Times {
+			if i >= len(values) {
+				break
+			}
+			v := float64(int64(values[i]))
+			if i < len(floats) {
+				v = floats[i]
+			}
+			if modifier == "gauge" {
+				points.Append(v, t)
+				continue
+			}
+			if hasPrev && t > prevTime {
+				if modifier == "delta" {
+					points.Append(v-prevValue, t)
+				} else if v >= prevValue { // skip counter resets
+					points.Append(1000*(v-prevValue)/(t-prevTime), t)
+				}
+			}
+			hasPrev, prevValue, prevTime = true, v, t
+		}
+	}
+	return points
+}
+
+// parseRawTarget returns modifier and path pattern of a raw target
+func parseRawTarget(target string) (string, string) {
+	target = strings.TrimSpace(target)
+	modifier := "gauge"
+	for _, m := range rawModifiers {
+		if strings.HasPrefix(target, m+"(") && strings.HasSuffix(target, ")") {
+			modifier = m
+			target = strings.TrimSpace(target[len(m)+1 : len(target)-1])
+			break
+		}
+	}
+	if !strings.HasPrefix(target, RawPrefix) {
+		return modifier, ""
+	}
+	return modifier, strings.TrimPrefix(target, RawPrefix)
+}
+
+// Search returns the next level of metric paths under a prefix, e.g. serverStatus/op returns
+// serverStatus/opLatencies/ and serverStatus/opcounters/. A prefix with wildcards returns
+// the pattern and the matched paths.
+func (rs *RawStore) Search(prefix string) []string {
+	if strings.ContainsAny(prefix, "*?[") {
+		return append([]string{prefix}, rs.GetPaths(prefix)...)
+	}
+	dir := prefix[:strings.LastIndex(prefix, decoder.PathSeparator)+1]
+	nodes := map[string]bool{}
+	for key := range rs.Paths {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		node := key
+		if n := strings.Index(key[len(dir):], decoder.PathSeparator); n >= 0 {
+			node = key[:len(dir)+n+1]
+		}
+		nodes[node] = true
+	}
+	var list []string
+	for node := range nodes {
+		list = append(list, node)
+	}
+	sort.Strings(list)
+	if dir != "" && len(list) > 1 {
+		list = append([]string{dir + "*"}, list...)
+	}
+	return list
+}
@@ -0,0 +1,121 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// raw_store_test.go
+
+package ftdc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.2020-05-13T14-20-19Z-00000")
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	writeTestFile(t, filename, "localhost", start, 650)
+	diag := NewDiagnosticData()
+	diag.SetKeepRawValues(true)
+	if err := diag.readDiagnosticFiles([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	rs := diag.RawStore
+	if len(rs.Chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(rs.Chunks))
+	}
+
+	docs := rs.GetTimeSeriesDocs("rate(raw:serverStatus/opcounters/insert)")
+	if len(docs) != 1 || docs[0].Len() != 646 { // samples of columns, the last ones of chunks are skipped
+		t.Fatalf("expected 646 data points, got %d", docs[0].Len())
+	}
+	for _, v := range docs[0].Values {
+		if v != 10 {
+			t.Fatalf("expected 10/s, got %v", v)
+		}
+	}
+	if docs = rs.GetTimeSeriesDocs("raw:serverStatus/opcounters/query"); docs[0].Values[5] != 100 {
+		t.Fatalf("expected 100, got %v", docs[0].Values[5])
+	}
+	if docs = rs.GetTimeSeriesDocs("delta(raw:serverStatus/opcounters/*)"); len(docs) != 3 {
+		t.Fatalf("expected 3 series, got %d", len(docs))
+	}
+	if docs[0].Target != "delta(raw:serverStatus/opcounters/insert)" {
+		t.Fatalf("unexpected target %v", docs[0].Target)
+	}
+	if IsRawTarget("ops_query") || !IsRawTarget("gauge(raw:serverStatus/uptime)") {
+		t.Fatal("unexpected raw target")
+	}
+
+	// values are of samples within the time range
+	diag = NewDiagnosticData()
+	diag.SetKeepRawValues(true)
+	diag.SetTimeRange(start.Add(100*time.Second), start.Add(400*time.Second))
+	if err := diag.readDiagnosticFiles([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	docs = diag.RawStore.GetTimeSeriesDocs("raw:serverStatus/uptime")
+	if n := docs[0].Len(); n != diag.ServerStatusColumns.Len() || docs[0].Times[0] != float64(start.Add(100*time.Second).UnixMilli()) ||
+		docs[0].Times[n-1] != float64(start.Add(400*time.Second).UnixMilli()) {
+		t.Fatalf("expected %d data points in range, got %d", diag.ServerStatusColumns.Len(), n)
+	}
+
+	diag = NewDiagnosticData()
+	if err := diag.readDiagnosticFiles([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	if len(diag.RawStore.Chunks) != 0 || !diag.RawStore.Paths["serverStatus/opcounters/insert"] {
+		t.Fatal("expected paths only")
+	}
+
+	// raw: queries of paths only fail instead of returning empty series
+	m := &Metrics{ftdcStats: FTDCStats{RawStore: diag.RawStore, TimeSeriesData: map[string]TimeSeriesDoc{}}}
+	body := `{"range": {"from": "2020-05-13T14:00:00Z", "to": "2020-05-13T15:00:00Z"}, "targets": [{"target": "rate(raw:serverStatus/uptime)", "type": "timeserie"}]}`
+	w := httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/query", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "require -raw") {
+		t.Fatalf("expected an error, got %v %v", w.Code, w.Body.String())
+	}
+	m.ftdcStats.RawStore = rs
+	w = httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/query", strings.NewReader(body)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "rate(raw:serverStatus/uptime)") {
+		t.Fatalf("unexpected response %v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestRawStoreSearch(t *testing.T) {
+	rs := NewRawStore()
+	for _, key := range []string{"serverStatus/opcounters/insert", "serverStatus/opcounters/query",
+		"serverStatus/opLatencies/reads/ops", "serverStatus/uptime", "systemMetrics/cpu/user_ms"} {
+		rs.Paths[key] = true
+	}
+	list := rs.Search("")
+	if len(list) != 2 || list[0] != "serverStatus/" || list[1] != "systemMetrics/" {
+		t.Fatalf("unexpected %v", list)
+	}
+	list = rs.Search("serverStatus/op")
+	if len(list) != 3 || list[0] != "serverStatus/*" || list[1] != "serverStatus/opLatencies/" {
+		t.Fatalf("unexpected %v", list)
+	}
+	list = rs.Search("serverStatus/opcounters/*")
+	if len(list) != 3 || list[2] != "serverStatus/opcounters/query" {
+		t.Fatalf("unexpected %v", list)
+	}
+
+	m := &Metrics{ftdcStats: FTDCStats{RawStore: rs, TimeSeriesData: map[string]TimeSeriesDoc{
+		"ops_query": {Target: "ops_query"}, "ops_insert": {Target: "ops_insert"}, "mem_resident": {Target: "mem_resident"}}}}
+	for target, expected := range map[string]string{
+		``:                        `["mem_resident","ops_insert","ops_query","host_info","member_states","raw:"]`,
+		`ops_`:                    `["ops_insert","ops_query"]`,
+		`rate(raw:serverStatus/u`: `["rate(raw:serverStatus/uptime)"]`,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/grafana/search", strings.NewReader(`{"target": "`+target+`"}`))
+		m.Handler(w, r)
+		if strings.TrimSpace(w.Body.String()) != expected {
+			t.Fatalf("%v: expected %v, got %v", target, expected, w.Body.String())
+		}
+	}
+}
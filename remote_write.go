@@ -0,0 +1,147 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// remote_write.go
+
+package ftdc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// RemoteWriteBatchSize is the max number of samples per remote write request
+const RemoteWriteBatchSize = 5000
+
+// RemoteWriter pushes FTDC stats to a Prometheus remote write endpoint
+type RemoteWriter struct {
+	batchSize int
+	client    *http.Client
+	url       string
+	verbose   bool
+}
+
+// NewRemoteWriter returns *RemoteWriter
+func NewRemoteWriter(url string) *RemoteWriter {
+	return &RemoteWriter{batchSize: RemoteWriteBatchSize, client: &http.Client{Timeout: 30 * time.Second}, url: url}
+}
+
+// SetBatchSize sets max number of samples per request
+func (rw *RemoteWriter) SetBatchSize(batchSize int) {
+	if batchSize > 0 {
+		rw.batchSize = batchSize
+	}
+}
+
+// SetVerbose sets verbose mode
+func (rw *RemoteWriter) SetVerbose(verbose bool) { rw.verbose = verbose }
+
+// Write pushes FTDC stats by host and returns number of samples sent
+func (rw *RemoteWriter) Write(stats map[string]FTDCStats) (int, error) {
+	var hosts []string
+	for host := range stats {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var batch []ExportSeries
+	count, total := 0, 0
+	for _, host := range hosts {
+		for _, series := range GetExportSeries(host, stats[host]) {
+			for len(series.Values) > 0 { // split a long series across requests
+				n := rw.batchSize - count
+				if n > len(series.Values) {
+					n = len(series.Values)
+				}
+				batch = append(batch, ExportSeries{Name: series.Name, Labels: series.Labels,
+					Times: series.Times[:n], Values: series.Values[:n]})
+				series.Times, series.Values = series.Times[n:], series.Values[n:]
+				if count += n; count >= rw.batchSize {
+					if err := rw.send(batch); err != nil {
+						return total, err
+					}
+					total += count
+					batch, count = nil, 0
+				}
+			}
+		}
+	}
+	if count > 0 {
+		if err := rw.send(batch); err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// send posts a snappy compressed WriteRequest
+func (rw *RemoteWriter) send(batch []ExportSeries) error {
+	req, err := http.NewRequest(http.MethodPost, rw.url, bytes.NewReader(snappy.Encode(nil, encodeWriteRequest(batch))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "mongo-ftdc")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write %v: %v %s", rw.url, resp.Status, bytes.TrimSpace(body))
+	}
+	if rw.verbose {
+		fmt.Println("remote write", len(batch), "series to", rw.url)
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes prometheus.WriteRequest in protobuf, i.e.
+// WriteRequest{timeseries=1}, TimeSeries{labels=1, samples=2}, Label{name=1, value=2},
+// and Sample{value=1 (double), timestamp=2 (int64 ms)}
+func encodeWriteRequest(list []ExportSeries) []byte {
+	var req []byte
+	for _, series := range list {
+		var ts []byte
+		ts = appendLabel(ts, "__name__", series.Name)
+		for _, l := range series.Labels {
+			ts = appendLabel(ts, l[0], l[1])
+		}
+		for i, v := range series.Values {
+			if math.IsNaN(v) {
+				continue
+			}
+			var sample []byte
+			sample = binary.AppendUvarint(sample, 1<<3|1) // fixed64
+			sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(v))
+			sample = binary.AppendUvarint(sample, 2<<3|0) // varint
+			sample = binary.AppendUvarint(sample, uint64(int64(series.Times[i])))
+			ts = appendBytesField(ts, 2, sample)
+		}
+		req = appendBytesField(req, 1, ts)
+	}
+	return req
+}
+
+func appendLabel(b []byte, name string, value string) []byte {
+	var label []byte
+	label = appendBytesField(label, 1, []byte(name))
+	label = appendBytesField(label, 2, []byte(value))
+	return appendBytesField(b, 1, label)
+}
+
+// appendBytesField appends a length-delimited field
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
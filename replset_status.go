@@ -4,6 +4,7 @@
 package ftdc
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -24,4 +25,19 @@ type MemberDoc struct {
 type ReplSetStatusDoc struct {
 	Date    time.Time   `json:"date" bson:"date"`
 	Members []MemberDoc `json:"members" bson:"members"`
+	Set     string      `json:"set" bson:"set"`
+}
+
+// memberStateNames maps replica set member states to names
+var memberStateNames = map[int]string{
+	0: "STARTUP", 1: PRIMARY, 2: SECONDARY, 3: "RECOVERING", 5: "STARTUP2",
+	6: "UNKNOWN", 7: "ARBITER", 8: "DOWN", 9: "ROLLBACK", 10: "REMOVED",
+}
+
+// GetMemberStateName returns name of a replica set member state
+func GetMemberStateName(state int) string {
+	if name, ok := memberStateNames[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("STATE_%d", state)
 }
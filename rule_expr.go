@@ -0,0 +1,326 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rule_expr.go
+
+package ftdc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ruleExpr is a compiled expression over metric stats, true is 1 and false is 0
+type ruleExpr interface {
+	eval(d *Diagnosis) float64
+}
+
+// numberExpr is a constant
+type numberExpr float64
+
+// statExpr is a stat of a metric, e.g. p95(latency_write). A metric pattern, e.g.
+// disku_*, returns the max of p5/median/p95 or the min (worst) score of all matches.
+type statExpr struct {
+	fn     string
+	metric string
+}
+
+// unaryExpr is -x or !x
+type unaryExpr struct {
+	op string
+	x  ruleExpr
+}
+
+// binaryExpr is an arithmetic, comparison or logical operation
+type binaryExpr struct {
+	op string
+	x  ruleExpr
+	y  ruleExpr
+}
+
+// ruleFunctions are stats of metrics available to expressions
+var ruleFunctions = map[string]bool{"p5": true, "median": true, "p95": true, "score": true}
+
+func (e numberExpr) eval(d *Diagnosis) float64 { return float64(e) }
+
+func (e statExpr) eval(d *Diagnosis) float64 {
+	matches := d.findMetrics(e.metric)
+	if len(matches) == 0 {
+		return getStatValue(metricStats{score: 101}, e.fn)
+	}
+	value := getStatValue(matches[0], e.fn)
+	for _, m := range matches[1:] {
+		if v := getStatValue(m, e.fn); e.fn == "score" {
+			value = math.Min(value, v)
+		} else {
+			value = math.Max(value, v)
+		}
+	}
+	return value
+}
+
+func (e unaryExpr) eval(d *Diagnosis) float64 {
+	x := e.x.eval(d)
+	if e.op == "!" {
+		return getBoolValue(x == 0)
+	}
+	return -x
+}
+
+func (e binaryExpr) eval(d *Diagnosis) float64 {
+	x := e.x.eval(d)
+	switch e.op { // short circuits
+	case "&&":
+		return getBoolValue(x != 0 && e.y.eval(d) != 0)
+	case "||":
+		return getBoolValue(x != 0 || e.y.eval(d) != 0)
+	}
+	y := e.y.eval(d)
+	switch e.op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/":
+		if y == 0 {
+			return 0
+		}
+		return x / y
+	case ">":
+		return getBoolValue(x > y)
+	case ">=":
+		return getBoolValue(x >= y)
+	case "<":
+		return getBoolValue(x < y)
+	case "<=":
+		return getBoolValue(x <= y)
+	case "==":
+		return getBoolValue(x == y)
+	case "!=":
+		return getBoolValue(x != y)
+	}
+	return 0
+}
+
+func getBoolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// getStatValue returns a stat of a metric by function name
+func getStatValue(m metricStats, fn string) float64 {
+	switch fn {
+	case "p5":
+		return m.p5
+	case "median":
+		return m.median
+	case "p95":
+		return m.p95
+	}
+	return float64(m.score)
+}
+
+// findMetrics returns stats of metrics matching a name or pattern, disks are iops_<disk> and
+// disku_<disk>, and replication lags are repl_lag_<host>
+func (d *Diagnosis) findMetrics(pattern string) []metricStats {
+	all := d.getNamedMetrics()
+	if !strings.ContainsAny(pattern, "*?[") {
+		if m, ok := all[pattern]; ok {
+			return []metricStats{m}
+		}
+		return nil
+	}
+	var list []metricStats
+	for name, m := range all {
+		if matched, _ := path.Match(pattern, name); matched {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// getNamedMetrics returns stats of metrics, disks and replication lags by name
+func (d *Diagnosis) getNamedMetrics() map[string]metricStats {
+	all := map[string]metricStats{}
+	for name, m := range d.metrics {
+		all[name] = m
+	}
+	for disk, metrics := range d.diskMetrics {
+		all["iops_"+disk] = metrics["iops"]
+		all["disku_"+disk] = metrics["util"]
+	}
+	for host, m := range d.replMetrics {
+		all["repl_lag_"+host] = m
+	}
+	return all
+}
+
+// ruleParser parses expressions, e.g. p95(latency_write) > 50 && median(wt_cache_dirty) > 10
+//
+//	or      = and { "||" and }
+//	and     = not { "&&" not }
+//	not     = "!" not | compare
+//	compare = sum [ (">" | ">=" | "<" | "<=" | "==" | "!=") sum ]
+//	sum     = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | number | function "(" metric ")" | "(" or ")"
+type ruleParser struct {
+	pos int
+	src string
+}
+
+// parseRuleExpr compiles an expression
+func parseRuleExpr(src string) (ruleExpr, error) {
+	p := &ruleParser{src: src}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("%v in %q", err, src)
+	}
+	if p.skipSpaces(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at %d in %q", p.src[p.pos:], p.pos, src)
+	}
+	return expr, nil
+}
+
+func (p *ruleParser) parseOr() (ruleExpr, error) {
+	return p.parseBinary([]string{"||"}, p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (ruleExpr, error) {
+	return p.parseBinary([]string{"&&"}, p.parseNot)
+}
+
+func (p *ruleParser) parseNot() (ruleExpr, error) {
+	if p.accept("!") {
+		x, err := p.parseNot()
+		return unaryExpr{"!", x}, err
+	}
+	return p.parseCompare()
+}
+
+func (p *ruleParser) parseCompare() (ruleExpr, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} { // longer operators first
+		if p.accept(op) {
+			y, err := p.parseSum()
+			return binaryExpr{op, x, y}, err
+		}
+	}
+	return x, nil
+}
+
+func (p *ruleParser) parseSum() (ruleExpr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseTerm)
+}
+
+func (p *ruleParser) parseTerm() (ruleExpr, error) {
+	return p.parseBinary([]string{"*", "/"}, p.parseUnary)
+}
+
+// parseBinary parses left associative operations of the same precedence
+func (p *ruleParser) parseBinary(ops []string, next func() (ruleExpr, error)) (ruleExpr, error) {
+	x, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		for _, o := range ops {
+			if p.accept(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return x, nil
+		}
+		y, err := next()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op, x, y}
+	}
+}
+
+func (p *ruleParser) parseUnary() (ruleExpr, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.src) {
+		return nil, errors.New("unexpected end")
+	}
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		return unaryExpr{"-", x}, err
+	}
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		return x, nil
+	}
+	start := p.pos
+	if c := rune(p.src[p.pos]); unicode.IsDigit(c) || c == '.' {
+		for p.pos < len(p.src) && (strings.ContainsRune("0123456789.eE", rune(p.src[p.pos])) ||
+			strings.ContainsRune("+-", rune(p.src[p.pos])) && strings.ContainsRune("eE", rune(p.src[p.pos-1]))) {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return numberExpr(v), nil
+	}
+	for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+		p.pos++
+	}
+	fn := p.src[start:p.pos]
+	if !ruleFunctions[fn] {
+		return nil, fmt.Errorf("unknown function %q at %d, expected p5, median, p95 or score", fn, start)
+	}
+	if !p.accept("(") {
+		return nil, fmt.Errorf("missing ( after %v", fn)
+	}
+	// metric names may have /, e.g. write_conflicts/s, so they end at )
+	end := strings.IndexByte(p.src[p.pos:], ')')
+	if end < 0 {
+		return nil, fmt.Errorf("missing ) after %v", fn)
+	}
+	metric := strings.Trim(strings.TrimSpace(p.src[p.pos:p.pos+end]), `"'`)
+	p.pos += end + 1
+	if metric == "" {
+		return nil, fmt.Errorf("missing metric of %v", fn)
+	}
+	if _, err := path.Match(metric, ""); err != nil {
+		return nil, fmt.Errorf("invalid metric pattern %q", metric)
+	}
+	return statExpr{fn, metric}, nil
+}
+
+// accept consumes a token if it's next
+func (p *ruleParser) accept(token string) bool {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.src[p.pos:], token) {
+		return false
+	}
+	p.pos += len(token)
+	return true
+}
+
+func (p *ruleParser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
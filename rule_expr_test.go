@@ -0,0 +1,57 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rule_expr_test.go
+
+package ftdc
+
+import (
+	"testing"
+)
+
+func getTestRulesDiagnosis() *Diagnosis {
+	return &Diagnosis{
+		metrics: map[string]metricStats{
+			"latency_write":     {p5: 10, median: 30, p95: 80, score: 40},
+			"wt_cache_dirty":    {p5: 5, median: 12, p95: 20, score: 60},
+			"write_conflicts/s": {p5: 0, median: 2, p95: 4, score: 90},
+		},
+		diskMetrics: map[string]map[string]metricStats{
+			"sda": {"util": {p95: 40, score: 80}, "iops": {p95: 500, score: 101}},
+			"sdb": {"util": {p95: 90, score: 20}, "iops": {p95: 800, score: 101}},
+		},
+		replMetrics: map[string]metricStats{"shard01-b": {p95: 12, score: 30}},
+	}
+}
+
+func TestParseRuleExpr(t *testing.T) {
+	d := getTestRulesDiagnosis()
+	tests := map[string]float64{
+		"p95(latency_write) > 50 && median(wt_cache_dirty) > 10":     1,
+		"p95(latency_write) > 50 && median(wt_cache_dirty) > 20":     0,
+		"p95(latency_write) > 100 || !(score(wt_cache_dirty) >= 70)": 1,
+		"p95(write_conflicts/s) * 2 - 1":                             7,
+		"p95(\"write_conflicts/s\") / (1 + 1)":                       2,
+		"-p5(latency_write) + 2 * 3":                                 -4,
+		"p95(disku_*)":                                               90,
+		"score(disku_*)":                                             20,
+		"p95(repl_lag_*) >= 12":                                      1,
+		"score(missing) == 101 && p95(missing) == 0":                 1,
+		"median(latency_write) != 30":                                0,
+		"1.5e1 <= 15":                                                1,
+		"1e-3 * 1E+3 - 1":                                            0,
+	}
+	for src, expected := range tests {
+		expr, err := parseRuleExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := expr.eval(d); v != expected {
+			t.Fatalf("%v: expected %v, got %v", src, expected, v)
+		}
+	}
+	for _, src := range []string{"", "p99(latency_write) > 1", "p95(latency_write > 1", "p95() > 1",
+		"(p95(a) > 1", "p95(a) > 1 extra", "p95(a) >", "p95([) > 1"} {
+		if _, err := parseRuleExpr(src); err == nil {
+			t.Fatalf("expected error of %q", src)
+		}
+	}
+}
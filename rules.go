@@ -0,0 +1,321 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rules.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RulesConfig defines diagnosis rules and anomaly thresholds in a YAML or JSON file. Rules
+// replace built-in rules of the same names and thresholds replace defaults of the same
+// metrics, others are added.
+type RulesConfig struct {
+	Replace    bool               `json:"replace" yaml:"replace"` // drop built-in rules and thresholds
+	Rules      []RuleDefinition   `json:"rules" yaml:"rules"`
+	Thresholds []AnomalyThreshold `json:"thresholds" yaml:"thresholds"`
+	Detector   *AnomalyDetector   `json:"detector" yaml:"detector"` // unset values are defaults
+
+	rules []DiagnosisRule // compiled
+}
+
+// RuleDefinition defines a rule of expressions over metric stats, e.g.
+// p95(latency_write) > 50 && median(wt_cache_dirty) > 10
+type RuleDefinition struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	Severity    string              `json:"severity" yaml:"severity"` // "critical", "warning", "info"
+	Condition   string              `json:"condition" yaml:"condition"`
+	Symptoms    []SymptomDefinition `json:"symptoms" yaml:"symptoms"`
+	Suggestion  string              `json:"suggestion" yaml:"suggestion"`
+}
+
+// SymptomDefinition is a symptom template, {expr} or {expr:format} are replaced by values,
+// e.g. "Write latency p95={p95(latency_write):%.0f}ms". It's a string or {text, when}.
+type SymptomDefinition struct {
+	Text string `json:"text" yaml:"text"`
+	When string `json:"when" yaml:"when"` // optional condition
+}
+
+// symptomTemplate is a compiled symptom
+type symptomTemplate struct {
+	parts []symptomPart
+	when  ruleExpr
+}
+
+// symptomPart is literal text or a formatted expression
+type symptomPart struct {
+	expr   ruleExpr
+	format string
+	text   string
+}
+
+// UnmarshalYAML accepts a string or a mapping
+func (s *SymptomDefinition) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Text)
+	}
+	type symptom SymptomDefinition
+	return value.Decode((*symptom)(s))
+}
+
+// UnmarshalJSON accepts a string or an object
+func (s *SymptomDefinition) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Text); err == nil {
+		return nil
+	}
+	type symptom SymptomDefinition
+	return json.Unmarshal(data, (*symptom)(s))
+}
+
+// LoadRulesConfig reads and compiles rules of a YAML or JSON (.json) file
+func LoadRulesConfig(filename string) (*RulesConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var rc RulesConfig
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		err = json.Unmarshal(data, &rc)
+	} else {
+		err = yaml.Unmarshal(data, &rc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	if err = rc.compile(); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return &rc, nil
+}
+
+// GetRules returns built-in rules merged with rules of the config
+func (rc *RulesConfig) GetRules() []DiagnosisRule {
+	var rules []DiagnosisRule
+	if !rc.Replace {
+		rules = append(rules, DiagnosisRules...)
+	}
+	for _, rule := range rc.rules {
+		replaced := false
+		for i := range rules {
+			if rules[i].Name == rule.Name {
+				rules[i], replaced = rule, true
+			}
+		}
+		if !replaced {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// GetAnomalyThresholds returns default thresholds merged with thresholds of the config
+func (rc *RulesConfig) GetAnomalyThresholds() []AnomalyThreshold {
+	var thresholds []AnomalyThreshold
+	if !rc.Replace {
+		thresholds = append(thresholds, DefaultAnomalyThresholds...)
+	}
+	for _, t := range rc.Thresholds {
+		replaced := false
+		for i := range thresholds {
+			if thresholds[i].Metric == t.Metric {
+				thresholds[i], replaced = t, true
+			}
+		}
+		if !replaced {
+			thresholds = append(thresholds, t)
+		}
+	}
+	return thresholds
+}
+
+// GetAnomalyDetector returns the detector of the config, DefaultAnomalyDetector if not set
+func (rc *RulesConfig) GetAnomalyDetector() AnomalyDetector {
+	if rc.Detector == nil {
+		return DefaultAnomalyDetector
+	}
+	return rc.Detector.withDefaults()
+}
+
+// compile validates thresholds and compiles rules
+func (rc *RulesConfig) compile() error {
+	rc.rules = nil
+	for i, rd := range rc.Rules {
+		rule, err := rd.compile()
+		if err != nil {
+			return fmt.Errorf("rule %v: %v", i+1, err)
+		}
+		rc.rules = append(rc.rules, rule)
+	}
+	for i, t := range rc.Thresholds {
+		if t.Metric == "" {
+			return fmt.Errorf("threshold %v: missing metric", i+1)
+		} else if !isValidSeverity(t.Severity) {
+			return fmt.Errorf("threshold %v: invalid severity %q", i+1, t.Severity)
+		}
+		if t.Label == "" {
+			op := "<"
+			if t.Above {
+				op = ">"
+			}
+			rc.Thresholds[i].Label = op + " " + strconv.FormatFloat(t.Threshold, 'f', -1, 64)
+		}
+	}
+	if rc.Detector != nil && rc.Detector.Severity != "" && !isValidSeverity(rc.Detector.Severity) {
+		return fmt.Errorf("detector: invalid severity %q", rc.Detector.Severity)
+	}
+	return nil
+}
+
+// compile returns a DiagnosisRule evaluating expressions
+func (rd RuleDefinition) compile() (DiagnosisRule, error) {
+	if rd.Name == "" {
+		return DiagnosisRule{}, errors.New("missing name")
+	} else if !isValidSeverity(rd.Severity) {
+		return DiagnosisRule{}, fmt.Errorf("%v: invalid severity %q", rd.Name, rd.Severity)
+	}
+	condition, err := parseRuleExpr(rd.Condition)
+	if err != nil {
+		return DiagnosisRule{}, fmt.Errorf("%v: %v", rd.Name, err)
+	}
+	var templates []symptomTemplate
+	for _, s := range rd.Symptoms {
+		tmpl, err := parseSymptomTemplate(s)
+		if err != nil {
+			return DiagnosisRule{}, fmt.Errorf("%v: %v", rd.Name, err)
+		}
+		templates = append(templates, tmpl)
+	}
+	metrics := getExprMetrics(condition)
+	for _, tmpl := range templates {
+		if err = checkRuleMetrics(tmpl.getMetrics()); err != nil {
+			return DiagnosisRule{}, fmt.Errorf("%v: %v", rd.Name, err)
+		}
+	}
+	if err = checkRuleMetrics(metrics); err != nil {
+		return DiagnosisRule{}, fmt.Errorf("%v: %v", rd.Name, err)
+	}
+	rule := DiagnosisRule{Name: rd.Name, Description: rd.Description, Severity: rd.Severity,
+		Suggestion: rd.Suggestion, Metrics: metrics}
+	rule.Conditions = func(d *Diagnosis) bool { return condition.eval(d) != 0 }
+	rule.Symptoms = func(d *Diagnosis) []string {
+		symptoms := []string{}
+		for _, tmpl := range templates {
+			if tmpl.when == nil || tmpl.when.eval(d) != 0 {
+				symptoms = append(symptoms, tmpl.render(d))
+			}
+		}
+		if len(symptoms) == 0 { // results require symptoms
+			symptoms = append(symptoms, "Condition met: "+rd.Condition)
+		}
+		return symptoms
+	}
+	return rule, nil
+}
+
+// parseSymptomTemplate compiles {expr} and {expr:format} of a symptom
+func parseSymptomTemplate(s SymptomDefinition) (symptomTemplate, error) {
+	var tmpl symptomTemplate
+	if s.When != "" {
+		expr, err := parseRuleExpr(s.When)
+		if err != nil {
+			return tmpl, err
+		}
+		tmpl.when = expr
+	}
+	text := s.Text
+	for text != "" {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			tmpl.parts = append(tmpl.parts, symptomPart{text: text})
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			return tmpl, fmt.Errorf("missing } in %q", s.Text)
+		}
+		tmpl.parts = append(tmpl.parts, symptomPart{text: text[:start]})
+		src, format := text[start+1:start+end], ""
+		if n := strings.LastIndex(src, ":%"); n >= 0 {
+			src, format = src[:n], src[n+1:]
+		}
+		expr, err := parseRuleExpr(src)
+		if err != nil {
+			return tmpl, err
+		}
+		tmpl.parts = append(tmpl.parts, symptomPart{expr: expr, format: format})
+		text = text[start+end+1:]
+	}
+	return tmpl, nil
+}
+
+// render returns text of a symptom, values are rounded to 2 decimals without a format
+func (tmpl symptomTemplate) render(d *Diagnosis) string {
+	var sb strings.Builder
+	for _, part := range tmpl.parts {
+		if part.expr == nil {
+			sb.WriteString(part.text)
+		} else if v := part.expr.eval(d); part.format != "" {
+			sb.WriteString(fmt.Sprintf(part.format, v))
+		} else {
+			sb.WriteString(strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64))
+		}
+	}
+	return sb.String()
+}
+
+// getExprMetrics returns metrics of an expression
+func getExprMetrics(expr ruleExpr) []string {
+	switch e := expr.(type) {
+	case statExpr:
+		return []string{e.metric}
+	case unaryExpr:
+		return getExprMetrics(e.x)
+	case binaryExpr:
+		return append(getExprMetrics(e.x), getExprMetrics(e.y)...)
+	}
+	return nil
+}
+
+// getMetrics returns metrics of expressions of a symptom
+func (tmpl symptomTemplate) getMetrics() []string {
+	var metrics []string
+	if tmpl.when != nil {
+		metrics = getExprMetrics(tmpl.when)
+	}
+	for _, part := range tmpl.parts {
+		if part.expr != nil {
+			metrics = append(metrics, getExprMetrics(part.expr)...)
+		}
+	}
+	return metrics
+}
+
+// checkRuleMetrics returns an error of an unknown metric, patterns aren't checked
+func checkRuleMetrics(metrics []string) error {
+	known := map[string]bool{"tcmalloc_frag": true}
+	for _, name := range getDiagnosisMetrics() {
+		known[name] = true
+	}
+	for _, metric := range metrics {
+		if known[metric] || strings.ContainsAny(metric, "*?[") || strings.HasPrefix(metric, "iops_") ||
+			strings.HasPrefix(metric, "disku_") || strings.HasPrefix(metric, "repl_lag_") {
+			continue
+		}
+		return fmt.Errorf("unknown metric %q", metric)
+	}
+	return nil
+}
+
+func isValidSeverity(severity string) bool {
+	return severity == "critical" || severity == "warning" || severity == "info"
+}
@@ -0,0 +1,139 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// rules_test.go
+
+package ftdc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRulesConfig(t *testing.T) {
+	yml := `
+rules:
+  - name: Write SLO
+    description: Write latency and dirty cache above SLO
+    severity: critical
+    condition: p95(latency_write) > 50 && median(wt_cache_dirty) > 10
+    symptoms:
+      - "Write latency p95={p95(latency_write):%.0f}ms, dirty cache median={median(wt_cache_dirty)}%"
+      - text: "Disk saturated: {p95(disku_*)}%"
+        when: p95(disku_*) > 95
+    suggestion: Page the storage team.
+  - name: CPU Saturation
+    severity: info
+    condition: p95(latency_write) > 1000
+detector:
+  metrics: [ops_*]
+  deviation: 4
+thresholds:
+  - metric: latency_write
+    threshold: 50
+    above: true
+    severity: critical
+  - metric: wt_cache_dirty
+    threshold: 10
+    above: true
+    severity: warning
+`
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rules.yaml")
+	if err := os.WriteFile(filename, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := LoadRulesConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := rc.GetRules()
+	if len(rules) != len(DiagnosisRules)+1 {
+		t.Fatalf("expected %v rules, got %v", len(DiagnosisRules)+1, len(rules))
+	}
+	d := getTestRulesDiagnosis()
+	d.SetRules(rules)
+	byName := map[string]DiagnosisResult{}
+	for _, result := range d.Run() {
+		byName[result.Rule.Name] = result
+	}
+	result, ok := byName["Write SLO"]
+	if !ok || result.Score != 40 || byName["CPU Saturation"].Rule.Name != "" {
+		t.Fatalf("unexpected results %v", byName)
+	}
+	if symptoms := result.Symptoms; len(symptoms) != 1 || symptoms[0] != "Write latency p95=80ms, dirty cache median=12%" {
+		t.Fatalf("unexpected symptoms %v", symptoms)
+	}
+
+	thresholds := rc.GetAnomalyThresholds()
+	if len(thresholds) != len(DefaultAnomalyThresholds)+1 {
+		t.Fatalf("expected %v thresholds, got %v", len(DefaultAnomalyThresholds)+1, len(thresholds))
+	}
+	for _, th := range thresholds {
+		if th.Metric == "latency_write" && (th.Severity != "critical" || th.Label != "> 50") {
+			t.Fatalf("unexpected threshold %+v", th)
+		}
+	}
+
+	if det := rc.GetAnomalyDetector(); det.Deviation != 4 || det.Shift != DefaultAnomalyDetector.Shift ||
+		len(det.Metrics) != 1 || det.Severity != "warning" {
+		t.Fatalf("unexpected detector %+v", det)
+	}
+
+	json := `{"replace": true, "rules": [{"name": "Lag", "severity": "warning", "condition": "p95(repl_lag_*) > 10",
+		"symptoms": ["lag p95={p95(repl_lag_*)}s"]}], "thresholds": [{"metric": "cpu_idle", "threshold": 5, "severity": "info"}]}`
+	filename = filepath.Join(dir, "rules.json")
+	if err = os.WriteFile(filename, []byte(json), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rc, err = LoadRulesConfig(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.GetRules()) != 1 || len(rc.GetAnomalyThresholds()) != 1 || rc.GetAnomalyThresholds()[0].Label != "< 5" ||
+		rc.GetAnomalyDetector().Window != DefaultAnomalyDetector.Window {
+		t.Fatalf("unexpected config %+v", rc)
+	}
+	d.SetRules(rc.GetRules())
+	if results := d.Run(); len(results) != 1 || results[0].Symptoms[0] != "lag p95=12s" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	for _, bad := range []string{"rules: [{name: x, severity: fatal, condition: p95(a) > 1}]",
+		"rules: [{name: x, severity: info, condition: p95(a) >}]",
+		"rules: [{name: x, severity: info, condition: p95(a) > 1, symptoms: ['{p95(a)']}]",
+		"rules: [{name: x, severity: info, condition: p95(latency_wirte) > 1}]",
+		"rules: [{name: x, severity: info, condition: p95(latency_write) > 1, symptoms: [{text: x, when: score(disk_util) < 50}]}]",
+		"thresholds: [{threshold: 1, severity: info}]", "detector: {severity: fatal}"} {
+		filename = filepath.Join(dir, "bad.yml")
+		if err = os.WriteFile(filename, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = LoadRulesConfig(filename); err == nil {
+			t.Fatalf("expected error of %v", bad)
+		}
+	}
+}
+
+func TestSetAnomalyThresholds(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	stats := getTestClusterStats("shard01-a", start, 20)
+	stats.DiskStats = map[string]DiskStats{"sda": {Utilization: stats.TimeSeriesData["cpu_user"]}}
+	d := NewDiagnosis(stats, start, start.Add(10*time.Minute))
+	if len(d.GetAnomalies()) != 0 {
+		t.Fatalf("unexpected anomalies %v", d.GetAnomalies())
+	}
+	d.SetAnomalyThresholds([]AnomalyThreshold{{"cpu_user", 10, true, "warning", "> 10%"},
+		{"disk_util_*", 15, true, "critical", "> 15%"}})
+	anomalies := d.GetAnomalies()
+	if len(anomalies) != 2 {
+		t.Fatalf("expected 2 anomalies, got %v", anomalies)
+	}
+	var metrics []string
+	for _, a := range anomalies {
+		metrics = append(metrics, a.Metric)
+	}
+	if list := strings.Join(metrics, ","); list != "cpu_user,disk_util_sda" && list != "disk_util_sda,cpu_user" {
+		t.Fatalf("unexpected anomalies %v", list)
+	}
+}
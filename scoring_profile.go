@@ -0,0 +1,133 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// scoring_profile.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultScoringProfile is the profile of FormulaMap watermarks
+const DefaultScoringProfile = "default"
+
+// Watermark holds low and high watermarks of a score, 100 below low and 0 above high
+type Watermark struct {
+	Low  float64 `json:"low" yaml:"low"`
+	High float64 `json:"high" yaml:"high"`
+}
+
+// ScoringProfile overrides FormulaMap watermarks of a workload, keyed as FormulaMap,
+// e.g. latency_read or disku_
+type ScoringProfile struct {
+	Name       string               `json:"name" yaml:"name"`
+	Base       string               `json:"base" yaml:"base"` // preset extended by a file
+	Watermarks map[string]Watermark `json:"watermarks" yaml:"watermarks"`
+}
+
+// scoringProfiles are presets, Atlas tiers differ by burstable CPU and provisioned IOPS
+var scoringProfiles = map[string]ScoringProfile{
+	DefaultScoringProfile: {},
+	"oltp": {Watermarks: map[string]Watermark{
+		"latency_command": {10, 50}, "latency_read": {10, 50}, "latency_write": {10, 50},
+		"query_targeting_keys": {5, 50}, "query_targeting_objects": {5, 50},
+		"scan_sort": {0, 100}, "write_conflicts/s": {5, 50},
+	}},
+	"analytics": {Watermarks: map[string]Watermark{
+		"cpu_user": {70, 90}, "disku_": {70, 95},
+		"latency_command": {100, 1000}, "latency_read": {100, 1000}, "latency_write": {50, 200},
+		"query_targeting_keys": {100, 1000}, "query_targeting_objects": {100, 1000},
+		"scan_keys": {0, 16 * 1024 * 1024}, "scan_objects": {5, 20}, "scan_sort": {0, 100000},
+		"wt_cache_used": {90, 98},
+	}},
+	"atlas-m10": {Watermarks: map[string]Watermark{
+		"conns_created/s": {0, 2}, "cpu_iowait": {3, 10}, "cpu_system": {3, 10}, "cpu_user": {30, 50},
+		"disku_": {40, 80}, "iops_": {1.5, 3}, "mem_page_faults": {5, 10},
+	}},
+	"atlas-m30": {Watermarks: map[string]Watermark{
+		"cpu_iowait": {5, 10}, "cpu_user": {40, 60}, "disku_": {50, 85},
+	}},
+	"atlas-m50": {Watermarks: map[string]Watermark{
+		"conns_created/s": {0, 10}, "cpu_user": {60, 80},
+	}},
+}
+
+// GetScoringProfileNames returns names of presets
+func GetScoringProfileNames() []string {
+	var names []string
+	for name := range scoringProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetScoringProfile returns a copy of a preset
+func GetScoringProfile(name string) (*ScoringProfile, error) {
+	preset, ok := scoringProfiles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring profile %v, expected one of %v", name,
+			strings.Join(GetScoringProfileNames(), ", "))
+	}
+	profile := ScoringProfile{Name: strings.ToLower(name), Watermarks: map[string]Watermark{}}
+	for k, v := range preset.Watermarks {
+		profile.Watermarks[k] = v
+	}
+	return &profile, nil
+}
+
+// LoadScoringProfile returns a preset by name, or reads a YAML or JSON (.json) file of
+// watermarks extending its base preset
+func LoadScoringProfile(name string) (*ScoringProfile, error) {
+	if _, ok := scoringProfiles[strings.ToLower(name)]; ok {
+		return GetScoringProfile(name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var custom ScoringProfile
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		err = json.Unmarshal(data, &custom)
+	} else {
+		err = yaml.Unmarshal(data, &custom)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	if custom.Base == "" {
+		custom.Base = DefaultScoringProfile
+	}
+	profile, err := GetScoringProfile(custom.Base)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", name, err)
+	}
+	profile.Name = custom.Name
+	if profile.Name == "" {
+		profile.Name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	for k, v := range custom.Watermarks {
+		if _, ok := FormulaMap[k]; !ok {
+			return nil, fmt.Errorf("%v: unknown metric %v", name, k)
+		} else if v.Low >= v.High {
+			return nil, fmt.Errorf("%v: low watermark of %v is not below high", name, k)
+		}
+		profile.Watermarks[k] = v
+	}
+	return profile, nil
+}
+
+// getWatermark returns watermarks of a FormulaMap key, a profile overrides defaults
+func (p *ScoringProfile) getWatermark(key string) (Watermark, bool) {
+	if p == nil {
+		return Watermark{}, false
+	}
+	wm, ok := p.Watermarks[key]
+	return wm, ok
+}
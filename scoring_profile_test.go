@@ -0,0 +1,131 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// scoring_profile_test.go
+
+package ftdc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func getTestScoringStats(start time.Time) FTDCStats {
+	stats := newTestStats(start, 100, map[string]func(int) float64{"latency_read": func(int) float64 { return 30 }})
+	stats.ServerInfo.HostInfo.System.NumCores = 8
+	return stats
+}
+
+func TestScoringProfile(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	stats := getTestScoringStats(start)
+	end := start.Add(time.Hour)
+
+	var wg sync.WaitGroup
+	scores := make([]int, 2)
+	for i, name := range []string{DefaultScoringProfile, "oltp"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			profile, err := GetScoringProfile(name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			as := NewAssessment(stats)
+			as.SetScoringProfile(profile)
+			scores[i] = as.getStatsArray("latency_read", start, end).score
+		}(i, name)
+	}
+	wg.Wait()
+	if scores[0] != 87 || scores[1] != 50 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	as := NewAssessment(stats)
+	if low, high := as.getWatermark("queued_read"); low != 8 || high != 40 || FormulaMap["queued_read"].low != 1 {
+		t.Fatalf("unexpected watermarks %v %v, FormulaMap %v", low, high, FormulaMap["queued_read"])
+	}
+	profile, _ := GetScoringProfile("oltp")
+	profile.Watermarks["latency_read"] = Watermark{1, 2}
+	if wm, _ := scoringProfiles["oltp"].Watermarks["latency_read"]; wm.Low != 10 {
+		t.Fatal("preset changed")
+	}
+	if _, err := GetScoringProfile("batch"); err == nil {
+		t.Fatal("expected error of an unknown profile")
+	}
+
+	d := NewDiagnosis(stats, start, end)
+	if d.getMetric("latency_read").score != 87 {
+		t.Fatalf("unexpected score %v", d.getMetric("latency_read").score)
+	}
+	d.SetScoringProfile(profile)
+	if d.getMetric("latency_read").score != 0 {
+		t.Fatalf("unexpected score %v", d.getMetric("latency_read").score)
+	}
+}
+
+func TestLoadScoringProfile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "checkout.yaml")
+	yml := "base: oltp\nwatermarks:\n  latency_write: {low: 2, high: 8}\n  disku_: {low: 30, high: 60}\n"
+	if err := os.WriteFile(filename, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := LoadScoringProfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Name != "checkout" || profile.Watermarks["latency_write"].High != 8 ||
+		profile.Watermarks["disku_"].Low != 30 || profile.Watermarks["latency_read"].Low != 10 {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	if profile, err = LoadScoringProfile("Analytics"); err != nil || profile.Name != "analytics" {
+		t.Fatalf("unexpected profile %v %v", profile, err)
+	}
+	for _, bad := range []string{`{"watermarks": {"latency": {"low": 1, "high": 2}}}`,
+		`{"watermarks": {"latency_read": {"low": 2, "high": 2}}}`, `{"base": "batch"}`} {
+		filename = filepath.Join(dir, "bad.json")
+		if err = os.WriteFile(filename, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = LoadScoringProfile(filename); err == nil {
+			t.Fatalf("expected error of %v", bad)
+		}
+	}
+}
+
+func TestAssessmentTargetProfile(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	m := &Metrics{ftdcStats: getTestScoringStats(start)}
+	body := `{"range": {"from": "2020-05-13T14:00:00Z", "to": "2020-05-13T15:00:00Z"},
+		"targets": [{"target": "assessment", "type": "table"}, {"target": "assessment:oltp", "type": "table"},
+		{"target": "assessment:batch", "type": "table"}]}`
+	w := httptest.NewRecorder()
+	m.Handler(w, httptest.NewRequest(http.MethodPost, "/grafana/query", strings.NewReader(body)))
+	var tables []struct {
+		Rows [][]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tables); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables, got %v", len(tables))
+	}
+	for i, score := range []float64{87, 50} {
+		found := false
+		for _, row := range tables[i].Rows {
+			if row[0] == "latency_read" {
+				found = row[1] == score
+			}
+		}
+		if !found {
+			t.Fatalf("expected latency_read score %v, got %v", score, tables[i].Rows)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// server_status_columns.go
+
+package ftdc
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+)
+
+const localTimePath = "serverStatus/localTime"
+const uptimePath = "serverStatus/uptime"
+
+// ServerStatusColumns are serverStatus samples of FTDC files in columns, metrics by path,
+// e.g. serverStatus/opcounters/query, have a value per sample
+type ServerStatusColumns struct {
+	Labels []ServerStatusLabel // in the order of Index
+	Values map[string][]uint64
+}
+
+// ServerStatusLabel is host, process and version of samples from Index on
+type ServerStatusLabel struct {
+	Index   int
+	Host    string
+	Process string
+	Version string
+}
+
+// seriesKind is how a series is computed from columns
+type seriesKind int
+
+const (
+	gaugeSeries      seriesKind = iota // value of a sample
+	rateSeries                         // counter delta per second
+	intRateSeries                      // delta per second of int counters, e.g. documents
+	ratioSeries                        // value divided by value of another path, e.g. latency by ops
+	deltaRatioSeries                   // delta divided by delta of another path, e.g. scanned by returned
+)
+
+// seriesSpec is a time series of serverStatus columns
+type seriesSpec struct {
+	legend string
+	path   string
+	kind   seriesKind
+	scale  float64 // divisor of values
+	per    string  // path of divisors of ratios
+}
+
+// serverStatusSpecs are series of getAllServerStatusTimeSeriesDoc in columns
+var serverStatusSpecs = []seriesSpec{
+	// Server Status
+	{legend: "mem_resident", path: "serverStatus/mem/resident", kind: gaugeSeries, scale: 1024},
+	{legend: "mem_virtual", path: "serverStatus/mem/virtual", kind: gaugeSeries, scale: 1024},
+	{legend: "mem_page_faults", path: "serverStatus/extra_info/page_faults", kind: rateSeries, scale: 1},
+	{legend: "conns_active", path: "serverStatus/connections/active", kind: gaugeSeries, scale: 1},
+	{legend: "conns_available", path: "serverStatus/connections/available", kind: gaugeSeries, scale: 1},
+	{legend: "conns_current", path: "serverStatus/connections/current", kind: gaugeSeries, scale: 1},
+	{legend: "conns_created/s", path: "serverStatus/connections/totalCreated", kind: rateSeries, scale: 1},
+	{legend: "latency_read", path: "serverStatus/opLatencies/reads/latency", kind: ratioSeries, scale: 1000, per: "serverStatus/opLatencies/reads/ops"},
+	{legend: "latency_write", path: "serverStatus/opLatencies/writes/latency", kind: ratioSeries, scale: 1000, per: "serverStatus/opLatencies/writes/ops"},
+	{legend: "latency_command", path: "serverStatus/opLatencies/commands/latency", kind: ratioSeries, scale: 1000, per: "serverStatus/opLatencies/commands/ops"},
+	{legend: "net_in", path: "serverStatus/network/bytesIn", kind: rateSeries, scale: mb},
+	{legend: "net_out", path: "serverStatus/network/bytesOut", kind: rateSeries, scale: mb},
+	{legend: "net_requests", path: "serverStatus/network/numRequests", kind: rateSeries, scale: 1},
+	{legend: "net_physical_in", path: "serverStatus/network/physicalBytesIn", kind: rateSeries, scale: mb},
+	{legend: "net_physical_out", path: "serverStatus/network/physicalBytesOut", kind: rateSeries, scale: mb},
+	{legend: "ops_query", path: "serverStatus/opcounters/query", kind: rateSeries, scale: 1},
+	{legend: "ops_insert", path: "serverStatus/opcounters/insert", kind: rateSeries, scale: 1},
+	{legend: "ops_update", path: "serverStatus/opcounters/update", kind: rateSeries, scale: 1},
+	{legend: "ops_delete", path: "serverStatus/opcounters/delete", kind: rateSeries, scale: 1},
+	{legend: "ops_getmore", path: "serverStatus/opcounters/getmore", kind: rateSeries, scale: 1},
+	{legend: "ops_command", path: "serverStatus/opcounters/command", kind: rateSeries, scale: 1},
+	{legend: "q_active_read", path: "serverStatus/globalLock/activeClients/readers", kind: gaugeSeries, scale: 1},
+	{legend: "q_active_write", path: "serverStatus/globalLock/activeClients/writers", kind: gaugeSeries, scale: 1},
+	{legend: "q_queued_read", path: "serverStatus/globalLock/currentQueue/readers", kind: gaugeSeries, scale: 1},
+	{legend: "q_queued_write", path: "serverStatus/globalLock/currentQueue/writers", kind: gaugeSeries, scale: 1},
+	{legend: "scan_keys", path: "serverStatus/metrics/queryExecutor/scanned", kind: rateSeries, scale: 1},
+	{legend: "scan_objects", path: "serverStatus/metrics/queryExecutor/scannedObjects", kind: rateSeries, scale: 1},
+	{legend: "scan_sort", path: "serverStatus/metrics/operation/scanAndOrder", kind: rateSeries, scale: 1},
+	{legend: "query_targeting_keys", path: "serverStatus/metrics/queryExecutor/scanned", kind: deltaRatioSeries, per: "serverStatus/metrics/document/returned"},
+	{legend: "query_targeting_objects", path: "serverStatus/metrics/queryExecutor/scannedObjects", kind: deltaRatioSeries, per: "serverStatus/metrics/document/returned"},
+	{legend: "doc_returned/s", path: "serverStatus/metrics/document/returned", kind: intRateSeries},
+	{legend: "doc_inserted/s", path: "serverStatus/metrics/document/inserted", kind: intRateSeries},
+	{legend: "doc_updated/s", path: "serverStatus/metrics/document/updated", kind: intRateSeries},
+	{legend: "doc_deleted/s", path: "serverStatus/metrics/document/deleted", kind: intRateSeries},
+	{legend: "write_conflicts/s", path: "serverStatus/metrics/operation/writeConflicts", kind: rateSeries, scale: 1},
+
+	// WiredTiger
+	{legend: "wt_blkmgr_read", path: "serverStatus/wiredTiger/block-manager/bytes read", kind: rateSeries, scale: mb},
+	{legend: "wt_blkmgr_written", path: "serverStatus/wiredTiger/block-manager/bytes written", kind: rateSeries, scale: mb},
+	{legend: "wt_blkmgr_written_checkpoint", path: "serverStatus/wiredTiger/block-manager/bytes written for checkpoint", kind: rateSeries, scale: mb},
+	{legend: "wt_cache_max", path: "serverStatus/wiredTiger/cache/maximum bytes configured", kind: gaugeSeries, scale: gb},
+	{legend: "wt_cache_used", path: "serverStatus/wiredTiger/cache/bytes currently in the cache", kind: gaugeSeries, scale: gb},
+	{legend: "wt_cache_dirty", path: "serverStatus/wiredTiger/cache/tracked dirty bytes in the cache", kind: gaugeSeries, scale: gb},
+	{legend: "wt_modified_evicted", path: "serverStatus/wiredTiger/cache/modified pages evicted", kind: rateSeries, scale: 1},
+	{legend: "wt_unmodified_evicted", path: "serverStatus/wiredTiger/cache/unmodified pages evicted", kind: rateSeries, scale: 1},
+	{legend: "wt_cache_read_in", path: "serverStatus/wiredTiger/cache/bytes read into cache", kind: rateSeries, scale: mb},
+	{legend: "wt_cache_written_from", path: "serverStatus/wiredTiger/cache/bytes written from cache", kind: rateSeries, scale: mb},
+	{legend: "wt_dhandles_active", path: "serverStatus/wiredTiger/data-handle/connection data handles currently active", kind: gaugeSeries, scale: 1},
+	{legend: "ticket_avail_read", path: "serverStatus/wiredTiger/concurrentTransactions/read/available", kind: gaugeSeries, scale: 1},
+	{legend: "ticket_avail_write", path: "serverStatus/wiredTiger/concurrentTransactions/write/available", kind: gaugeSeries, scale: 1},
+
+	// MongoDB 7.0+ Queues (Admission Control)
+	{legend: "queues_read_out", path: "serverStatus/queues/execution/read/out", kind: gaugeSeries, scale: 1},
+	{legend: "queues_read_available", path: "serverStatus/queues/execution/read/available", kind: gaugeSeries, scale: 1},
+	{legend: "queues_read_total", path: "serverStatus/queues/execution/read/totalTickets", kind: gaugeSeries, scale: 1},
+	{legend: "queues_write_out", path: "serverStatus/queues/execution/write/out", kind: gaugeSeries, scale: 1},
+	{legend: "queues_write_available", path: "serverStatus/queues/execution/write/available", kind: gaugeSeries, scale: 1},
+	{legend: "queues_write_total", path: "serverStatus/queues/execution/write/totalTickets", kind: gaugeSeries, scale: 1},
+
+	// Transactions
+	{legend: "txn_active", path: "serverStatus/transactions/currentActive", kind: gaugeSeries, scale: 1},
+	{legend: "txn_inactive", path: "serverStatus/transactions/currentInactive", kind: gaugeSeries, scale: 1},
+	{legend: "txn_open", path: "serverStatus/transactions/currentOpen", kind: gaugeSeries, scale: 1},
+	{legend: "txn_aborted/s", path: "serverStatus/transactions/totalAborted", kind: rateSeries, scale: 1},
+	{legend: "txn_committed/s", path: "serverStatus/transactions/totalCommitted", kind: rateSeries, scale: 1},
+	{legend: "txn_started/s", path: "serverStatus/transactions/totalStarted", kind: rateSeries, scale: 1},
+
+	// tcmalloc Memory
+	{legend: "tcmalloc_in_use", path: "serverStatus/tcmalloc/generic/bytes_in_use_by_app", kind: gaugeSeries, scale: gb},
+	{legend: "tcmalloc_allocated", path: "serverStatus/tcmalloc/generic/current_allocated_bytes", kind: gaugeSeries, scale: gb},
+	{legend: "tcmalloc_heap", path: "serverStatus/tcmalloc/generic/heap_size", kind: gaugeSeries, scale: gb},
+	{legend: "tcmalloc_physical", path: "serverStatus/tcmalloc/generic/physical_memory_used", kind: gaugeSeries, scale: gb},
+
+	// Flow Control
+	{legend: "flowctl_rate_limit", path: "serverStatus/flowControl/targetRateLimit", kind: gaugeSeries, scale: 1},
+	{legend: "flowctl_acquiring_us", path: "serverStatus/flowControl/timeAcquiringMicros", kind: rateSeries, scale: 1},
+	{legend: "flowctl_lagged_count", path: "serverStatus/flowControl/isLaggedCount", kind: rateSeries, scale: 1},
+}
+
+// serverStatusPaths are paths kept in columns
+var serverStatusPaths = getServerStatusPaths()
+
+func getServerStatusPaths() []string {
+	paths := []string{localTimePath, uptimePath}
+	added := map[string]bool{localTimePath: true, uptimePath: true}
+	for _, spec := range serverStatusSpecs {
+		for _, path := range []string{spec.path, spec.per} {
+			if path != "" && !added[path] {
+				added[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// Len returns number of samples
+func (c ServerStatusColumns) Len() int { return len(c.Values[localTimePath]) }
+
+// GetTime returns time of a sample
+func (c ServerStatusColumns) GetTime(i int) time.Time {
+	return time.Unix(0, int64(time.Millisecond)*int64(c.Values[localTimePath][i]))
+}
+
+// GetServerStatusDoc returns serverStatus of a sample, only metrics of serverStatusPaths
+func (c ServerStatusColumns) GetServerStatusDoc(i int) ServerStatusDoc {
+	ss := NewAttribs(&c.Values).GetServerStatusDataPoints(i)
+	label := c.getLabel(i)
+	ss.Host, ss.Process, ss.Version = label.Host, label.Process, label.Version
+	return ss
+}
+
+// GetServerStatusList returns serverStatus of all samples
+func (c ServerStatusColumns) GetServerStatusList() []ServerStatusDoc {
+	list := make([]ServerStatusDoc, c.Len())
+	for i := range list {
+		list[i] = c.GetServerStatusDoc(i)
+	}
+	return list
+}
+
+// getLabel returns the label of a sample
+func (c ServerStatusColumns) getLabel(i int) ServerStatusLabel {
+	n := sort.Search(len(c.Labels), func(k int) bool { return c.Labels[k].Index > i })
+	if n == 0 {
+		return ServerStatusLabel{}
+	}
+	return c.Labels[n-1]
+}
+
+// addLabel adds a label of samples from index on if it changes
+func (c *ServerStatusColumns) addLabel(label ServerStatusLabel) {
+	if n := len(c.Labels); n > 0 {
+		last := c.Labels[n-1]
+		if last.Host == label.Host && last.Process == label.Process && last.Version == label.Version {
+			return
+		}
+		if last.Index == label.Index {
+			c.Labels = c.Labels[:n-1]
+		}
+	}
+	c.Labels = append(c.Labels, label)
+}
+
+// add appends samples of a decoded chunk, one pass per path
+func (c *ServerStatusColumns) add(v *decoder.MetricsData, samples []int, label ServerStatusLabel) {
+	if len(samples) == 0 {
+		return
+	}
+	if c.Values == nil {
+		c.Values = make(map[string][]uint64, len(serverStatusPaths))
+	}
+	label.Index = c.Len()
+	c.addLabel(label)
+	for _, path := range serverStatusPaths {
+		arr := v.DataPointsMap[path]
+		col := c.Values[path]
+		for _, i := range samples {
+			if i < len(arr) {
+				col = append(col, arr[i])
+			} else {
+				col = append(col, 0)
+			}
+		}
+		c.Values[path] = col
+	}
+}
+
+// appendFrom appends samples of another columns from i
+func (c *ServerStatusColumns) appendFrom(other ServerStatusColumns, i int) {
+	n := other.Len() - i
+	if n <= 0 {
+		return
+	}
+	if c.Values == nil {
+		c.Values = make(map[string][]uint64, len(serverStatusPaths))
+	}
+	size := c.Len()
+	for _, label := range other.Labels {
+		if label.Index < i {
+			label = other.getLabel(i)
+			label.Index = i
+		}
+		label.Index += size - i
+		c.addLabel(label)
+	}
+	for _, path := range serverStatusPaths {
+		col := c.Values[path]
+		if len(col) != size { // values of a missing path are 0
+			col = append(col[:0:0], make([]uint64, size)...)
+		}
+		if values := other.Values[path]; len(values) == other.Len() {
+			col = append(col, values[i:]...)
+		} else {
+			col = append(col, make([]uint64, n)...)
+		}
+		c.Values[path] = col
+	}
+}
+
+// merge appends samples of another columns after the last sample
+func (c *ServerStatusColumns) merge(other ServerStatusColumns) {
+	other.sort()
+	n := c.Len()
+	if n == 0 {
+		*c = other.slice(0)
+		return
+	}
+	last := c.GetTime(n - 1)
+	i := sort.Search(other.Len(), func(i int) bool { return other.GetTime(i).After(last) })
+	c.appendFrom(other, i)
+}
+
+// slice returns samples from i, columns are shared
+func (c ServerStatusColumns) slice(i int) ServerStatusColumns {
+	s := ServerStatusColumns{Values: make(map[string][]uint64, len(c.Values))}
+	for path, col := range c.Values {
+		s.Values[path] = col[i:]
+	}
+	for _, label := range c.Labels {
+		if label.Index < i {
+			label = c.getLabel(i)
+			label.Index = i
+		}
+		label.Index -= i
+		s.addLabel(label)
+	}
+	return s
+}
+
+// sort sorts samples by time
+func (c *ServerStatusColumns) sort() {
+	times := c.Values[localTimePath]
+	if sort.SliceIsSorted(times, func(i int, j int) bool { return times[i] < times[j] }) {
+		return
+	}
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i int, j int) bool { return times[order[i]] < times[order[j]] })
+	var labels []ServerStatusLabel
+	for i, k := range order {
+		label := c.getLabel(k)
+		label.Index = i
+		if n := len(labels); n == 0 || labels[n-1].Host != label.Host || labels[n-1].Process != label.Process || labels[n-1].Version != label.Version {
+			labels = append(labels, label)
+		}
+	}
+	values := make(map[string][]uint64, len(c.Values))
+	for path, col := range c.Values {
+		sorted := make([]uint64, len(col))
+		for i, k := range order {
+			if k < len(col) {
+				sorted[i] = col[k]
+			}
+		}
+		values[path] = sorted
+	}
+	c.Labels, c.Values = labels, values
+}
+
+// getRestarts returns samples of lower uptime than the previous ones
+func (c ServerStatusColumns) getRestarts() []ServerStatusDoc {
+	var restarts []ServerStatusDoc
+	uptimes := c.Values[uptimePath]
+	for i := 1; i < len(uptimes); i++ {
+		if uptimes[i] < uptimes[i-1] {
+			label := c.getLabel(i)
+			restarts = append(restarts, ServerStatusDoc{Host: label.Host, LocalTime: c.GetTime(i), Process: label.Process,
+				Uptime: uptimes[i], Version: label.Version})
+		}
+	}
+	return restarts
+}
+
+// getVersions returns the first samples of versions
+func (c ServerStatusColumns) getVersions() []ServerStatusDoc {
+	var versions []ServerStatusDoc
+	var version string
+	for _, label := range c.Labels {
+		if label.Version == "" || label.Version == version || label.Index >= c.Len() {
+			continue
+		}
+		versions = append(versions, ServerStatusDoc{Host: label.Host, LocalTime: c.GetTime(label.Index), Process: label.Process,
+			Version: label.Version})
+		version = label.Version
+	}
+	return versions
+}
+
+// getServerStatusTimeRange returns times of the first and the last samples, of columns of
+// FTDC files or of a list of keyhole stats
+func getServerStatusTimeRange(cols ServerStatusColumns, list []ServerStatusDoc) (time.Time, time.Time, bool) {
+	if n := cols.Len(); n > 0 {
+		return cols.GetTime(0), cols.GetTime(n - 1), true
+	} else if n = len(list); n > 0 {
+		return list[0].LocalTime, list[n-1].LocalTime, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// getColumnsTimeSeriesDoc returns the same series as getAllServerStatusTimeSeriesDoc
+// computed from columns, samples of increasing uptime are kept and deltas are of the
+// previous sample
+func getColumnsTimeSeriesDoc(cols ServerStatusColumns) map[string]TimeSeriesDoc {
+	localTimes, uptimes := cols.Values[localTimePath], cols.Values[uptimePath]
+	n := len(localTimes)
+	if n == 0 || len(uptimes) != n {
+		return map[string]TimeSeriesDoc{}
+	}
+	var kept []int
+	var puptime uint64
+	for i, uptime := range uptimes {
+		if uptime > puptime {
+			kept = append(kept, i)
+		}
+		puptime = uptime
+	}
+	times := make([]float64, len(kept))
+	seconds := make([]float64, len(kept)) // since the previous sample
+	for k, i := range kept {
+		times[k] = float64(int64(localTimes[i]))
+		if i > 0 {
+			d := time.Duration(int64(localTimes[i])-int64(localTimes[i-1])) * time.Millisecond
+			if seconds[k] = math.Round(d.Seconds()); seconds[k] < 1 {
+				seconds[k] = 1
+			}
+		}
+	}
+
+	var zeros []uint64
+	column := func(path string) []uint64 { // of a missing path, values are 0
+		if col := cols.Values[path]; len(col) == n {
+			return col
+		}
+		if zeros == nil {
+			zeros = make([]uint64, n)
+		}
+		return zeros
+	}
+	ts := make(map[string]*TimeSeriesDoc, len(serverStatusSpecs))
+	for _, spec := range serverStatusSpecs {
+		col, per := column(spec.path), column(spec.per)
+		doc := &TimeSeriesDoc{Target: spec.legend, Values: make([]float64, 0, len(kept))}
+		for k, i := range kept {
+			switch spec.kind {
+			case gaugeSeries:
+				doc.add(float64(col[i]) / spec.scale)
+			case ratioSeries:
+				var v float64
+				if per[i] > 0 {
+					v = float64(col[i]) / float64(per[i]) / spec.scale
+				}
+				doc.add(v)
+			}
+			if i == 0 {
+				continue
+			}
+			switch spec.kind {
+			case rateSeries:
+				doc.add(float64(col[i]-col[i-1]) / spec.scale / seconds[k])
+			case intRateSeries:
+				doc.add(float64(int(col[i])-int(col[i-1])) / seconds[k])
+			case deltaRatioSeries:
+				var v float64
+				if delta := float64(int(per[i]) - int(per[i-1])); delta > 0 {
+					v = float64(col[i]-col[i-1]) / delta
+				}
+				doc.add(v)
+			}
+		}
+		ts[spec.legend] = doc
+	}
+	setTimes(ts, times)
+	return toValueMap(ts)
+}
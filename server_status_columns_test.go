@@ -0,0 +1,223 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// server_status_columns_test.go
+
+package ftdc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// getColumnsTestSample returns a sample of serverStatus metrics of series at irregular but
+// increasing times, mongod restarts at sample 60 and queues are added at sample 90
+func getColumnsTestSample(start time.Time, i int) bson.D {
+	tm := start.Add(time.Duration(i)*time.Second + time.Duration(i%5)*200*time.Millisecond)
+	n := int64(i)
+	if i >= 60 { // counters reset by the restart
+		n = int64(i - 60)
+	}
+	serverStatus := bson.D{
+		{Key: "host", Value: "localhost"},
+		{Key: "version", Value: "7.0.2"},
+		{Key: "process", Value: "mongod"},
+		{Key: "uptime", Value: float64(1000 + n)},
+		{Key: "localTime", Value: primitive.NewDateTimeFromTime(tm)},
+		{Key: "connections", Value: bson.D{{Key: "current", Value: int32(10 + i%3)}, {Key: "available", Value: int32(800)},
+			{Key: "totalCreated", Value: int64(5 * n)}, {Key: "active", Value: int32(i % 4)}}},
+		{Key: "extra_info", Value: bson.D{{Key: "page_faults", Value: int64(3 * n)}}},
+		{Key: "mem", Value: bson.D{{Key: "resident", Value: int32(1024 + i)}, {Key: "virtual", Value: int32(2048)}}},
+		{Key: "network", Value: bson.D{{Key: "bytesIn", Value: int64(1 << 20 * n)}, {Key: "bytesOut", Value: int64(3 << 19 * n)},
+			{Key: "numRequests", Value: int64(100 * n)}}},
+		{Key: "opcounters", Value: bson.D{{Key: "insert", Value: int64(10 * n)}, {Key: "query", Value: int64(20*n + n*n)},
+			{Key: "update", Value: int64(0)}, {Key: "command", Value: int64(7 * n)}}},
+		{Key: "opLatencies", Value: bson.D{
+			{Key: "reads", Value: bson.D{{Key: "latency", Value: int64(1500 * n)}, {Key: "ops", Value: int64(n / 5)}}},
+			{Key: "writes", Value: bson.D{{Key: "latency", Value: int64(900 * n)}, {Key: "ops", Value: int64(n)}}},
+		}},
+		{Key: "metrics", Value: bson.D{
+			{Key: "document", Value: bson.D{{Key: "returned", Value: int64(4 * (n / 3))}, {Key: "inserted", Value: int64(10 * n)}}},
+			{Key: "operation", Value: bson.D{{Key: "scanAndOrder", Value: int64(n)}, {Key: "writeConflicts", Value: int64(n % 5)}}},
+			{Key: "queryExecutor", Value: bson.D{{Key: "scanned", Value: int64(30 * n)}, {Key: "scannedObjects", Value: int64(12 * n)}}},
+		}},
+		{Key: "wiredTiger", Value: bson.D{{Key: "cache", Value: bson.D{
+			{Key: "bytes currently in the cache", Value: int64(1<<30 + 1<<20*n)},
+			{Key: "maximum bytes configured", Value: int64(4 << 30)},
+			{Key: "tracked dirty bytes in the cache", Value: int64(1 << 20 * (n % 9))},
+			{Key: "bytes read into cache", Value: int64(1 << 21 * n)},
+		}}}},
+	}
+	if i >= 90 {
+		serverStatus = append(serverStatus, bson.E{Key: "queues", Value: bson.D{{Key: "execution", Value: bson.D{
+			{Key: "read", Value: bson.D{{Key: "out", Value: int32(i % 6)}, {Key: "available", Value: int32(120)}, {Key: "totalTickets", Value: int32(128)}}},
+		}}}})
+	}
+	return bson.D{
+		{Key: "start", Value: primitive.NewDateTimeFromTime(tm)},
+		{Key: "serverStatus", Value: serverStatus},
+		{Key: "end", Value: primitive.NewDateTimeFromTime(tm)},
+	}
+}
+
+// getLegacyServerStatusList returns serverStatus of a file by sample, as decoded before columns
+func getLegacyServerStatusList(t *testing.T, filename string) []ServerStatusDoc {
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var list []ServerStatusDoc
+	err = decoder.NewReader(file).ForEach(func(chunk *decoder.Chunk) error {
+		if chunk.Type == 0 {
+			return nil
+		}
+		attrib := NewAttribsFromMetricsData(chunk.Data)
+		for i := 0; i < int(chunk.Data.NumDeltas); i++ {
+			list = append(list, attrib.GetServerStatusDataPoints(i))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestGetColumnsTimeSeriesDoc(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	filename := filepath.Join(t.TempDir(), "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, filename, "", start, 120, testFileOptions{maxSamples: 25, sample: getColumnsTestSample})
+	d := NewDiagnosticData()
+	if err := d.DecodeDiagnosticData([]string{filename}); err != nil {
+		t.Fatal(err)
+	}
+	legacy := getLegacyServerStatusList(t, filename)
+	if len(legacy) < 100 || len(d.ServerStatusList) != 0 || d.ServerStatusColumns.Len() != len(legacy) {
+		t.Fatalf("expected %d samples, got %d %d", len(legacy), len(d.ServerStatusList), d.ServerStatusColumns.Len())
+	}
+	for i, ss := range d.ServerStatusColumns.GetServerStatusList() {
+		if !ss.LocalTime.Equal(legacy[i].LocalTime) || ss.Uptime != legacy[i].Uptime || ss.OpCounters != legacy[i].OpCounters {
+			t.Fatalf("unexpected sample %d %v", i, ss)
+		}
+		if ss.Host != "localhost" || ss.Process != "mongod" || ss.Version != "7.0.2" {
+			t.Fatalf("unexpected labels %v %v %v", ss.Host, ss.Process, ss.Version)
+		}
+	}
+	if restarts := d.ServerStatusColumns.getRestarts(); len(restarts) != 1 || restarts[0].Uptime != 1000 {
+		t.Fatalf("expected a restart, got %v", restarts)
+	}
+
+	expected := getAllServerStatusTimeSeriesDoc(legacy)
+	tsd := getColumnsTimeSeriesDoc(d.ServerStatusColumns)
+	if len(tsd) != len(expected) {
+		t.Fatalf("expected %d series, got %d", len(expected), len(tsd))
+	}
+	for legend, doc := range expected {
+		if !reflect.DeepEqual(doc, tsd[legend]) {
+			t.Fatalf("unexpected %v\nexpected %v\ngot %v", legend, doc.DataPoints(), tsd[legend].DataPoints())
+		}
+	}
+	if tsd["ops_query"].Len() == 0 || tsd["queues_read_out"].Values[tsd["queues_read_out"].Len()-1] == 0 {
+		t.Fatalf("expected values of ops_query and queues_read_out")
+	}
+}
+
+func TestMergeServerStatusColumns(t *testing.T) {
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	dir := filepath.Join(t.TempDir(), "diagnostic.data")
+	filename := filepath.Join(dir, "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(t, filename, "", start, 120, testFileOptions{maxSamples: 25, sample: getColumnsTestSample})
+	m := &Metrics{}
+	if err := m.ProcessFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	stats := m.GetFTDCStats()
+	legacy := getLegacyServerStatusList(t, filename)
+	if n := stats.ServerStatusColumns.Len(); n != len(legacy) || len(stats.ServerStatusList) != 0 {
+		t.Fatalf("expected columns of %d samples, got %d", len(legacy), n)
+	}
+	if from, to := m.GetTimeRange(); !from.Equal(start) || !to.Equal(legacy[len(legacy)-1].LocalTime) {
+		t.Fatalf("unexpected time range %v %v", from, to)
+	}
+
+	// samples out of order are sorted along with labels
+	cols := ServerStatusColumns{Labels: []ServerStatusLabel{{Index: 0, Version: "7.0.2"}, {Index: 1, Version: "6.0.9"}},
+		Values: map[string][]uint64{localTimePath: {2000, 0, 1000}, uptimePath: {12, 10, 11}}}
+	cols.sort()
+	if !reflect.DeepEqual(cols.Values[uptimePath], []uint64{10, 11, 12}) || len(cols.Labels) != 2 || cols.Labels[1].Index != 2 {
+		t.Fatalf("unexpected order %v", cols)
+	}
+	if versions := cols.getVersions(); len(versions) != 2 || versions[1].Version != "7.0.2" || versions[1].LocalTime.UnixMilli() != 2000 {
+		t.Fatalf("unexpected versions %v", versions)
+	}
+
+	// samples after the last one are merged, missing paths are 0
+	cols = cols.slice(1)
+	cols.merge(ServerStatusColumns{Labels: []ServerStatusLabel{{Index: 0, Version: "7.0.2"}},
+		Values: map[string][]uint64{localTimePath: {3000, 2000}, uptimePath: {13, 12}, "serverStatus/mem/resident": {9, 8}}})
+	if cols.Len() != 3 || !reflect.DeepEqual(cols.Values[uptimePath], []uint64{11, 12, 13}) ||
+		!reflect.DeepEqual(cols.Values["serverStatus/mem/resident"], []uint64{0, 0, 9}) {
+		t.Fatalf("unexpected columns %v", cols)
+	}
+	if len(cols.Labels) != 2 || cols.getLabel(0).Version != "6.0.9" || cols.getLabel(2).Version != "7.0.2" {
+		t.Fatalf("unexpected labels %v", cols.Labels)
+	}
+}
+
+// getBenchChunks returns decoded chunks of a day of samples
+func getBenchChunks(b *testing.B) []*decoder.MetricsData {
+	filename := filepath.Join(b.TempDir(), "metrics.2020-05-13T14-20-19Z-00000")
+	writeTestFile(b, filename, "", time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC), 86400, testFileOptions{sample: getColumnsTestSample})
+	file, err := os.Open(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	var chunks []*decoder.MetricsData
+	decoder.NewReader(file).ForEach(func(chunk *decoder.Chunk) error {
+		if chunk.Type == 1 {
+			chunks = append(chunks, chunk.Data)
+		}
+		return nil
+	})
+	return chunks
+}
+
+// BenchmarkServerStatusColumns computes series of decoded chunks from columns
+func BenchmarkServerStatusColumns(b *testing.B) {
+	chunks := getBenchChunks(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := NewDiagnosticData()
+		for _, chunk := range chunks {
+			d.addMetricsData(chunk, false)
+		}
+		_ = getColumnsTimeSeriesDoc(d.ServerStatusColumns)
+	}
+}
+
+// BenchmarkServerStatusDocs computes series of decoded chunks from ServerStatusDoc by sample
+func BenchmarkServerStatusDocs(b *testing.B) {
+	chunks := getBenchChunks(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var list []ServerStatusDoc
+		var systemMetricsList []SystemMetricsDoc
+		for _, chunk := range chunks {
+			attrib := NewAttribsFromMetricsData(chunk)
+			for j := 0; j < int(chunk.NumDeltas); j++ {
+				list = append(list, attrib.GetServerStatusDataPoints(j))
+				systemMetricsList = append(systemMetricsList, attrib.GetSystemMetricsDataPoints(j))
+			}
+		}
+		_ = getAllServerStatusTimeSeriesDoc(list)
+	}
+}
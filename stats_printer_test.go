@@ -14,7 +14,7 @@ func getServerStatusDocs() []ServerStatusDoc {
 	d := NewDiagnosticData()
 	diag, _ = d.readDiagnosticFile(DiagnosticDataFilename)
 
-	for _, ss := range diag.ServerStatusList {
+	for _, ss := range diag.ServerStatusColumns.GetServerStatusList() {
 		b, _ := json.Marshal(ss)
 		doc := ServerStatusDoc{}
 		json.Unmarshal(b, &doc)
@@ -0,0 +1,135 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// time_range.go
+
+package ftdc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simagix/mongo-ftdc/decoder"
+)
+
+// ParseTimeSpec parses a RFC3339 time or a duration before the end of data, e.g. -6h.
+// It returns zero time and the duration for a relative time, empty is unbounded.
+func ParseTimeSpec(spec string) (time.Time, time.Duration, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return time.Time{}, 0, nil
+	}
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return t, 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(spec, "-"))
+	if err != nil || d <= 0 {
+		return time.Time{}, 0, errors.New("invalid time " + spec + ", expected RFC3339 or a duration, e.g. -6h")
+	}
+	return time.Time{}, d, nil
+}
+
+// ParseTimeRange parses a time range of from/to time specs, relative durations are before end.
+// Either side can be empty, e.g. -6h/ is the last 6 hours.
+func ParseTimeRange(spec string, end time.Time) (time.Time, time.Time, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, errors.New("invalid time range " + spec + ", expected from/to")
+	}
+	getEnd := func() time.Time { return end }
+	from, err := resolveTimeSpec(parts[0], getEnd)
+	if err != nil {
+		return from, time.Time{}, err
+	}
+	to, err := resolveTimeSpec(parts[1], getEnd)
+	if err == nil && !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		err = errors.New("invalid time range " + spec + ", from is not before to")
+	}
+	return from, to, err
+}
+
+// resolveTimeSpec returns time of a spec, relative durations are before the end of data
+func resolveTimeSpec(spec string, end func() time.Time) (time.Time, error) {
+	t, d, err := ParseTimeSpec(spec)
+	if err != nil || d == 0 {
+		return t, err
+	}
+	return end().Add(-d), nil
+}
+
+// getFileStartTime returns time from a file name, e.g. metrics.2020-05-13T14-20-19Z-00000
+func getFileStartTime(filename string) (time.Time, bool) {
+	name := strings.TrimPrefix(filepath.Base(filename), "metrics.")
+	if n := strings.Index(name, "Z"); n > 0 {
+		if t, err := time.Parse("2006-01-02T15-04-05", name[:n]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// filterFilesByTime removes files entirely outside of a time range, a file ends where
+// the next one starts. Files without time in names, e.g. metrics.interim, are kept.
+func filterFilesByTime(filenames []string, from time.Time, to time.Time) []string {
+	var list []string
+	for i, filename := range filenames {
+		start, ok := getFileStartTime(filename)
+		if ok && !to.IsZero() && start.After(to) {
+			continue
+		}
+		if ok && !from.IsZero() && i+1 < len(filenames) {
+			if next, ok := getFileStartTime(filenames[i+1]); ok && !next.After(from) {
+				continue
+			}
+		}
+		list = append(list, filename)
+	}
+	return list
+}
+
+// getDataEndTime returns time of the last sample of files, or the latest mtime if the
+// last chunks cannot be decoded
+func getDataEndTime(filenames []string) time.Time {
+	var end time.Time
+	for _, filename := range filenames {
+		if fi, err := os.Stat(filename); err == nil && fi.ModTime().After(end) {
+			end = fi.ModTime()
+		}
+	}
+	var last time.Time
+	for _, filename := range filenames {
+		if t, ok := getLastSampleTime(filename); ok && t.After(last) {
+			last = t
+		}
+	}
+	if !last.IsZero() {
+		return last
+	}
+	return end
+}
+
+// getLastSampleTime decodes the last complete chunk of a file
+func getLastSampleTime(filename string) (time.Time, bool) {
+	offset, ok := getLastDocumentOffset(filename)
+	if !ok {
+		return time.Time{}, false
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+	if _, err = file.Seek(offset, 0); err != nil {
+		return time.Time{}, false
+	}
+	chunk, err := decoder.NewReader(file).Next()
+	if err != nil || chunk.Data == nil {
+		return time.Time{}, false
+	}
+	starts := chunk.Data.DataPointsMap["start"]
+	if len(starts) == 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(starts[len(starts)-1])).UTC(), true
+}
@@ -0,0 +1,91 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// time_range_test.go
+
+package ftdc
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeSpec(t *testing.T) {
+	if tm, d, err := ParseTimeSpec("2020-05-13T14:20:19Z"); err != nil || d != 0 || tm.Unix() != 1589379619 {
+		t.Fatalf("unexpected %v %v %v", tm, d, err)
+	}
+	if tm, d, err := ParseTimeSpec("-6h"); err != nil || d != 6*time.Hour || !tm.IsZero() {
+		t.Fatalf("unexpected %v %v %v", tm, d, err)
+	}
+	for _, spec := range []string{"yesterday", "-0s", "2020-05-13"} {
+		if _, _, err := ParseTimeSpec(spec); err == nil {
+			t.Fatalf("expected error of %v", spec)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	end := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	from, to, err := ParseTimeRange("-2h/-1h", end)
+	if err != nil || !from.Equal(end.Add(-2*time.Hour)) || !to.Equal(end.Add(-time.Hour)) {
+		t.Fatalf("unexpected %v %v %v", from, to, err)
+	}
+	if from, to, err = ParseTimeRange("2020-05-13T10:00:00Z/", end); err != nil || from.Hour() != 10 || !to.IsZero() {
+		t.Fatalf("unexpected %v %v %v", from, to, err)
+	}
+	for _, spec := range []string{"-1h", "-1h/-2h", "diagnostic.data/", "a/b/c"} {
+		if _, _, err = ParseTimeRange(spec, end); err == nil {
+			t.Fatalf("expected error of %v", spec)
+		}
+	}
+}
+
+func TestFilterFilesByTime(t *testing.T) {
+	filenames := []string{"metrics.2020-05-13T10-00-00Z-00000", "metrics.2020-05-13T12-00-00Z-00000",
+		"metrics.2020-05-13T14-00-00Z-00000", "metrics.interim"}
+	from := time.Date(2020, 5, 13, 12, 30, 0, 0, time.UTC)
+	to := time.Date(2020, 5, 13, 13, 0, 0, 0, time.UTC)
+	list := filterFilesByTime(filenames, from, to)
+	if strings.Join(list, ",") != "metrics.2020-05-13T12-00-00Z-00000,metrics.interim" {
+		t.Fatalf("unexpected files %v", list)
+	}
+	if list = filterFilesByTime(filenames, from, time.Time{}); len(list) != 3 {
+		t.Fatalf("unexpected files %v", list)
+	}
+}
+
+func TestProcessFilesTimeRange(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "diagnostic.data")
+	start := time.Date(2020, 5, 13, 14, 20, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(dir, "metrics.2020-05-13T14-20-00Z-00000"), "shard01-a", start, 300)
+	writeTestFile(t, filepath.Join(dir, "metrics.2020-05-13T14-25-00Z-00000"), "shard01-a", start.Add(5*time.Minute), 300)
+
+	m := &Metrics{}
+	if err := m.SetTimeRange("-100s", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ProcessFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	from, to := m.GetTimeRange()
+	if !from.Equal(start.Add(499*time.Second)) || !to.Equal(start.Add(598*time.Second)) {
+		t.Fatalf("unexpected time range %v %v", from, to)
+	}
+
+	m = &Metrics{}
+	m.SetLatest(1)
+	m.SetTimeRange("2020-05-13T14:24:00Z", "2020-05-13T14:26:00Z")
+	if err := m.ProcessFiles([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	from, to = m.GetTimeRange()
+	if !from.Equal(start.Add(4*time.Minute)) || !to.Equal(start.Add(6*time.Minute)) {
+		t.Fatalf("unexpected time range %v %v", from, to)
+	}
+	if m.GetFTDCStats().ServerStatusColumns.Len() != 120 {
+		t.Fatalf("expected 120 samples, got %d", m.GetFTDCStats().ServerStatusColumns.Len())
+	}
+	if err := m.SetTimeRange("last week", ""); err == nil {
+		t.Fatal("expected error of an invalid time")
+	}
+}
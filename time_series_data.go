@@ -4,6 +4,7 @@
 package ftdc
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"math"
@@ -16,10 +17,155 @@ import (
 const mb = 1024.0 * 1024
 const gb = 1024.0 * 1024 * 1024
 
-// TimeSeriesDoc -
+// TimeSeriesDoc is a metric in columns, series of the same source, e.g. serverStatus,
+// share a time column. It's converted to Grafana [[value, time], ...] in JSON only.
 type TimeSeriesDoc struct {
-	Target     string      `json:"target"`
-	DataPoints [][]float64 `json:"datapoints"`
+	Target string
+	Times  []float64 // milliseconds since epoch, may be shared, don't modify
+	Values []float64
+}
+
+// NewTimeSeriesDoc returns TimeSeriesDoc of [value, time] data points
+func NewTimeSeriesDoc(target string, points [][]float64) TimeSeriesDoc {
+	doc := TimeSeriesDoc{Target: target, Times: make([]float64, 0, len(points)), Values: make([]float64, 0, len(points))}
+	for _, dp := range points {
+		if len(dp) > 1 {
+			doc.Append(dp[0], dp[1])
+		}
+	}
+	return doc
+}
+
+// Len returns number of data points
+func (doc TimeSeriesDoc) Len() int { return len(doc.Values) }
+
+// Append adds a data point, a shared time column is copied on write
+func (doc *TimeSeriesDoc) Append(v float64, t float64) {
+	doc.Times = append(doc.Times, t)
+	doc.Values = append(doc.Values, v)
+}
+
+// Slice returns data points from i to j, columns are shared
+func (doc TimeSeriesDoc) Slice(i int, j int) TimeSeriesDoc {
+	return TimeSeriesDoc{Target: doc.Target, Times: doc.Times[i:j:j], Values: doc.Values[i:j:j]}
+}
+
+// DataPoints returns [value, time] data points
+func (doc TimeSeriesDoc) DataPoints() [][]float64 {
+	points := make([][]float64, len(doc.Values))
+	for i, v := range doc.Values {
+		points[i] = []float64{v, doc.Times[i]}
+	}
+	return points
+}
+
+// MarshalJSON returns {"target": ..., "datapoints": [[value, time], ...]} for Grafana,
+// NaN and infinite values are null
+func (doc TimeSeriesDoc) MarshalJSON() ([]byte, error) {
+	target, err := json.Marshal(doc.Target)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, len(target)+32+len(doc.Values)*24)
+	b = append(b, `{"target":`...)
+	b = append(b, target...)
+	b = append(b, `,"datapoints":[`...)
+	for i, v := range doc.Values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		b = appendJSONFloat(b, v)
+		b = append(b, ',')
+		b = appendJSONFloat(b, doc.Times[i])
+		b = append(b, ']')
+	}
+	return append(b, "]}"...), nil
+}
+
+// UnmarshalJSON reads {"target": ..., "datapoints": [[value, time], ...]}
+func (doc *TimeSeriesDoc) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Target     string      `json:"target"`
+		DataPoints [][]float64 `json:"datapoints"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*doc = NewTimeSeriesDoc(v.Target, v.DataPoints)
+	return nil
+}
+
+// appendJSONFloat appends a float the same as encoding/json
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(b, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if n := len(b); format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+		b[n-2] = b[n-1] // e-09 to e-9
+		b = b[:n-1]
+	}
+	return b
+}
+
+// add appends a value, its time is set by setTimes
+func (doc *TimeSeriesDoc) add(v float64) {
+	doc.Values = append(doc.Values, nonNegative(v))
+}
+
+// setTimes shares a time column, values are added at the last len(doc.Values) times
+func setTimes(docs map[string]*TimeSeriesDoc, times []float64) {
+	for _, doc := range docs {
+		n := len(times)
+		doc.Times = times[n-len(doc.Values) : n : n]
+	}
+}
+
+// appendTimeSeriesData appends points of series later than the last points of data, series
+// sharing a time column share the appended column
+func appendTimeSeriesData(data map[string]TimeSeriesDoc, tail map[string]TimeSeriesDoc) {
+	columns := map[*float64][]float64{} // by the last time of a column
+	for name, t := range tail {
+		if doc := data[name]; doc.Len() > 0 && t.Len() > 0 {
+			if key := &doc.Times[doc.Len()-1]; len(doc.Times) > len(columns[key]) {
+				columns[key] = doc.Times
+			}
+		}
+	}
+	added := map[*float64]int{} // of times appended to a column
+	for name, t := range tail {
+		doc := data[name]
+		if doc.Len() == 0 {
+			data[name] = t
+			continue
+		}
+		n := doc.Len()
+		last := doc.Times[n-1]
+		i := sort.Search(t.Len(), func(i int) bool { return t.Times[i] > last })
+		if i == t.Len() {
+			continue
+		}
+		times := t.Times[i:]
+		doc.Values = append(doc.Values, t.Values[i:]...)
+		key := &doc.Times[n-1]
+		column := columns[key]
+		if count, ok := added[key]; !ok {
+			column = append(column[:len(column):len(column)], times...)
+			columns[key], added[key] = column, len(times)
+		} else if count != len(times) || column[len(column)-1] != times[len(times)-1] { // not of the same samples
+			doc.Times = append(doc.Times[:n:n], times...)
+			data[name] = doc
+			continue
+		}
+		k := len(column)
+		doc.Times = column[k-doc.Len() : k : k]
+		data[name] = doc
+	}
 }
 
 // RangeDoc -
@@ -88,21 +234,21 @@ var systemMetricsChartsLegends = []string{
 	"disks_utils", "disks_iops", "io_in_progress", "read_time_ms", "write_time_ms", "io_queued_ms"}
 var replSetChartsLegends = []string{"replication_lags"}
 
-// dataPoint returns a pre-allocated 2-element slice [value, timestamp]
-func dataPoint(v, t float64) []float64 {
+// nonNegative returns 0 of negative values, e.g. deltas of counters reset by restarts
+func nonNegative(v float64) float64 {
 	if v < 0 {
-		v = 0
+		return 0
 	}
-	return []float64{v, t}
+	return v
 }
 
-// initTimeSeriesMap creates a map with pre-allocated slices for each legend
+// initTimeSeriesMap creates a map with pre-allocated value columns for each legend
 func initTimeSeriesMap(legends []string, capacity int) map[string]*TimeSeriesDoc {
 	m := make(map[string]*TimeSeriesDoc, len(legends))
 	for _, legend := range legends {
 		m[legend] = &TimeSeriesDoc{
-			Target:     legend,
-			DataPoints: make([][]float64, 0, capacity),
+			Target: legend,
+			Values: make([]float64, 0, capacity),
 		}
 	}
 	return m
@@ -124,7 +270,7 @@ func getReplSetGetStatusTimeSeriesDoc(replSetGetStatusList []ReplSetStatusDoc, l
 	var ts int64
 
 	for _, legend := range replSetChartsLegends {
-		timeSeriesData[legend] = TimeSeriesDoc{legend, [][]float64{}}
+		timeSeriesData[legend] = TimeSeriesDoc{Target: legend}
 	}
 	for _, stat := range replSetGetStatusList {
 		if len(stat.Members) == 0 { // missing, shouldn't happen
@@ -148,9 +294,9 @@ func getReplSetGetStatusTimeSeriesDoc(replSetGetStatusList []ReplSetStatusDoc, l
 					log.Println(hostname, legend)
 				}
 				hosts = append(hosts, hostname)
-				timeSeriesData[legend] = TimeSeriesDoc{legend, [][]float64{}}
+				timeSeriesData[legend] = TimeSeriesDoc{Target: legend}
 				node := "repl_" + strconv.Itoa(n)
-				timeSeriesData[node] = TimeSeriesDoc{node, [][]float64{}}
+				timeSeriesData[node] = TimeSeriesDoc{Target: node}
 			}
 			continue
 		}
@@ -176,7 +322,7 @@ func getReplSetGetStatusTimeSeriesDoc(replSetGetStatusList []ReplSetStatusDoc, l
 					continue
 				}
 				x := replicationLags[hosts[i]]
-				x.DataPoints = append(x.DataPoints, dataPoint(v, t))
+				x.Append(nonNegative(v), t)
 				replicationLags[hosts[i]] = x
 			}
 		}
@@ -190,6 +336,8 @@ func getSystemMetricsTimeSeriesDoc(systemMetricsList []SystemMetricsDoc) (map[st
 	n := len(systemMetricsList)
 	tsData := initTimeSeriesMap(systemMetricsChartsLegends, n)
 	diskStats := make(map[string]DiskStats)
+	times := make([]float64, 0, n)
+	diskTimes := map[string][]float64{} // disks may come and go
 	var pstat SystemMetricsDoc
 
 	for i, stat := range systemMetricsList {
@@ -209,13 +357,14 @@ func getSystemMetricsTimeSeriesDoc(systemMetricsList []SystemMetricsDoc) (map[st
 			u := 100 * float64(disk.IOTimeMS-pdisk.IOTimeMS) / 1000
 			iops := float64(disk.Reads+disk.Writes-(pdisk.Reads+pdisk.Writes)) / seconds
 
+			diskTimes[k] = append(diskTimes[k], t)
 			ds := diskStats[k]
-			ds.Utilization.DataPoints = append(ds.Utilization.DataPoints, dataPoint(u, t))
-			ds.IOPS.DataPoints = append(ds.IOPS.DataPoints, dataPoint(iops, t))
-			ds.IOInProgress.DataPoints = append(ds.IOInProgress.DataPoints, dataPoint(float64(disk.IOInProgress), t))
-			ds.ReadTimeMS.DataPoints = append(ds.ReadTimeMS.DataPoints, dataPoint(float64(disk.ReadTimeMS-pdisk.ReadTimeMS), t))
-			ds.WriteTimeMS.DataPoints = append(ds.WriteTimeMS.DataPoints, dataPoint(float64(disk.WriteTimeMS-pdisk.WriteTimeMS), t))
-			ds.IOQueuedMS.DataPoints = append(ds.IOQueuedMS.DataPoints, dataPoint(float64(disk.IOQueuedMS-pdisk.IOQueuedMS), t))
+			ds.Utilization.add(u)
+			ds.IOPS.add(iops)
+			ds.IOInProgress.add(float64(disk.IOInProgress))
+			ds.ReadTimeMS.add(float64(disk.ReadTimeMS - pdisk.ReadTimeMS))
+			ds.WriteTimeMS.add(float64(disk.WriteTimeMS - pdisk.WriteTimeMS))
+			ds.IOQueuedMS.add(float64(disk.IOQueuedMS - pdisk.IOQueuedMS))
 			diskStats[k] = ds
 		}
 
@@ -226,16 +375,23 @@ func getSystemMetricsTimeSeriesDoc(systemMetricsList []SystemMetricsDoc) (map[st
 			deltaTotalMS = 1
 		}
 
-		tsData["cpu_idle"].DataPoints = append(tsData["cpu_idle"].DataPoints, dataPoint(100*float64(stat.CPU.IdleMS-pstat.CPU.IdleMS)/deltaTotalMS, t))
-		tsData["cpu_iowait"].DataPoints = append(tsData["cpu_iowait"].DataPoints, dataPoint(100*float64(stat.CPU.IOWaitMS-pstat.CPU.IOWaitMS)/deltaTotalMS, t))
-		tsData["cpu_system"].DataPoints = append(tsData["cpu_system"].DataPoints, dataPoint(100*float64(stat.CPU.SystemMS-pstat.CPU.SystemMS)/deltaTotalMS, t))
-		tsData["cpu_user"].DataPoints = append(tsData["cpu_user"].DataPoints, dataPoint(100*float64(stat.CPU.UserMS-pstat.CPU.UserMS)/deltaTotalMS, t))
-		tsData["cpu_nice"].DataPoints = append(tsData["cpu_nice"].DataPoints, dataPoint(100*float64(stat.CPU.NiceMS-pstat.CPU.NiceMS)/deltaTotalMS, t))
-		tsData["cpu_steal"].DataPoints = append(tsData["cpu_steal"].DataPoints, dataPoint(100*float64(stat.CPU.StealMS-pstat.CPU.StealMS)/deltaTotalMS, t))
-		tsData["cpu_softirq"].DataPoints = append(tsData["cpu_softirq"].DataPoints, dataPoint(100*float64(stat.CPU.SoftirqMS-pstat.CPU.SoftirqMS)/deltaTotalMS, t))
+		times = append(times, t)
+		tsData["cpu_idle"].add(100 * float64(stat.CPU.IdleMS-pstat.CPU.IdleMS) / deltaTotalMS)
+		tsData["cpu_iowait"].add(100 * float64(stat.CPU.IOWaitMS-pstat.CPU.IOWaitMS) / deltaTotalMS)
+		tsData["cpu_system"].add(100 * float64(stat.CPU.SystemMS-pstat.CPU.SystemMS) / deltaTotalMS)
+		tsData["cpu_user"].add(100 * float64(stat.CPU.UserMS-pstat.CPU.UserMS) / deltaTotalMS)
+		tsData["cpu_nice"].add(100 * float64(stat.CPU.NiceMS-pstat.CPU.NiceMS) / deltaTotalMS)
+		tsData["cpu_steal"].add(100 * float64(stat.CPU.StealMS-pstat.CPU.StealMS) / deltaTotalMS)
+		tsData["cpu_softirq"].add(100 * float64(stat.CPU.SoftirqMS-pstat.CPU.SoftirqMS) / deltaTotalMS)
 
 		pstat = stat
 	}
+	setTimes(tsData, times)
+	for k, ds := range diskStats {
+		setTimes(map[string]*TimeSeriesDoc{"iops": &ds.IOPS, "io_in_progress": &ds.IOInProgress, "io_queued_ms": &ds.IOQueuedMS,
+			"read_time_ms": &ds.ReadTimeMS, "write_time_ms": &ds.WriteTimeMS, "utilization": &ds.Utilization}, diskTimes[k])
+		diskStats[k] = ds
+	}
 	return toValueMap(tsData), diskStats
 }
 
@@ -257,6 +413,7 @@ func getAllServerStatusTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[str
 	allLegends = append(allLegends, flowControlChartsLegends...)
 
 	ts := initTimeSeriesMap(allLegends, n)
+	times := make([]float64, 0, n)
 	var pstat ServerStatusDoc
 
 	for i, stat := range serverStatusList {
@@ -265,18 +422,18 @@ func getAllServerStatusTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[str
 			continue
 		}
 
-		t := float64(stat.LocalTime.UnixNano() / (1000 * 1000))
+		times = append(times, float64(stat.LocalTime.UnixNano()/(1000*1000)))
 
 		// === Server Status metrics (gauges - no delta needed) ===
-		ts["mem_resident"].DataPoints = append(ts["mem_resident"].DataPoints, dataPoint(float64(stat.Mem.Resident)/1024, t))
-		ts["mem_virtual"].DataPoints = append(ts["mem_virtual"].DataPoints, dataPoint(float64(stat.Mem.Virtual)/1024, t))
-		ts["conns_active"].DataPoints = append(ts["conns_active"].DataPoints, dataPoint(float64(stat.Connections.Active), t))
-		ts["conns_available"].DataPoints = append(ts["conns_available"].DataPoints, dataPoint(float64(stat.Connections.Available), t))
-		ts["conns_current"].DataPoints = append(ts["conns_current"].DataPoints, dataPoint(float64(stat.Connections.Current), t))
-		ts["q_active_read"].DataPoints = append(ts["q_active_read"].DataPoints, dataPoint(float64(stat.GlobalLock.ActiveClients.Readers), t))
-		ts["q_active_write"].DataPoints = append(ts["q_active_write"].DataPoints, dataPoint(float64(stat.GlobalLock.ActiveClients.Writers), t))
-		ts["q_queued_read"].DataPoints = append(ts["q_queued_read"].DataPoints, dataPoint(float64(stat.GlobalLock.CurrentQueue.Readers), t))
-		ts["q_queued_write"].DataPoints = append(ts["q_queued_write"].DataPoints, dataPoint(float64(stat.GlobalLock.CurrentQueue.Writers), t))
+		ts["mem_resident"].add(float64(stat.Mem.Resident) / 1024)
+		ts["mem_virtual"].add(float64(stat.Mem.Virtual) / 1024)
+		ts["conns_active"].add(float64(stat.Connections.Active))
+		ts["conns_available"].add(float64(stat.Connections.Available))
+		ts["conns_current"].add(float64(stat.Connections.Current))
+		ts["q_active_read"].add(float64(stat.GlobalLock.ActiveClients.Readers))
+		ts["q_active_write"].add(float64(stat.GlobalLock.ActiveClients.Writers))
+		ts["q_queued_read"].add(float64(stat.GlobalLock.CurrentQueue.Readers))
+		ts["q_queued_write"].add(float64(stat.GlobalLock.CurrentQueue.Writers))
 
 		// Latencies (computed)
 		var r, w, c float64
@@ -289,39 +446,39 @@ func getAllServerStatusTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[str
 		if stat.OpLatencies.Commands.Ops > 0 {
 			c = float64(stat.OpLatencies.Commands.Latency) / float64(stat.OpLatencies.Commands.Ops) / 1000
 		}
-		ts["latency_read"].DataPoints = append(ts["latency_read"].DataPoints, dataPoint(r, t))
-		ts["latency_write"].DataPoints = append(ts["latency_write"].DataPoints, dataPoint(w, t))
-		ts["latency_command"].DataPoints = append(ts["latency_command"].DataPoints, dataPoint(c, t))
+		ts["latency_read"].add(r)
+		ts["latency_write"].add(w)
+		ts["latency_command"].add(c)
 
 		// === WiredTiger metrics (gauges) ===
-		ts["wt_cache_max"].DataPoints = append(ts["wt_cache_max"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.MaxBytesConfigured)/gb, t))
-		ts["wt_cache_used"].DataPoints = append(ts["wt_cache_used"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.CurrentlyInCache)/gb, t))
-		ts["wt_cache_dirty"].DataPoints = append(ts["wt_cache_dirty"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.TrackedDirtyBytes)/gb, t))
-		ts["wt_dhandles_active"].DataPoints = append(ts["wt_dhandles_active"].DataPoints, dataPoint(float64(stat.WiredTiger.DataHandle.Active), t))
-		ts["ticket_avail_read"].DataPoints = append(ts["ticket_avail_read"].DataPoints, dataPoint(float64(stat.WiredTiger.ConcurrentTransactions.Read.Available), t))
-		ts["ticket_avail_write"].DataPoints = append(ts["ticket_avail_write"].DataPoints, dataPoint(float64(stat.WiredTiger.ConcurrentTransactions.Write.Available), t))
+		ts["wt_cache_max"].add(float64(stat.WiredTiger.Cache.MaxBytesConfigured) / gb)
+		ts["wt_cache_used"].add(float64(stat.WiredTiger.Cache.CurrentlyInCache) / gb)
+		ts["wt_cache_dirty"].add(float64(stat.WiredTiger.Cache.TrackedDirtyBytes) / gb)
+		ts["wt_dhandles_active"].add(float64(stat.WiredTiger.DataHandle.Active))
+		ts["ticket_avail_read"].add(float64(stat.WiredTiger.ConcurrentTransactions.Read.Available))
+		ts["ticket_avail_write"].add(float64(stat.WiredTiger.ConcurrentTransactions.Write.Available))
 
 		// === Queues (MongoDB 7.0+) ===
-		ts["queues_read_out"].DataPoints = append(ts["queues_read_out"].DataPoints, dataPoint(float64(stat.Queues.Execution.Read.Out), t))
-		ts["queues_read_available"].DataPoints = append(ts["queues_read_available"].DataPoints, dataPoint(float64(stat.Queues.Execution.Read.Available), t))
-		ts["queues_read_total"].DataPoints = append(ts["queues_read_total"].DataPoints, dataPoint(float64(stat.Queues.Execution.Read.TotalTickets), t))
-		ts["queues_write_out"].DataPoints = append(ts["queues_write_out"].DataPoints, dataPoint(float64(stat.Queues.Execution.Write.Out), t))
-		ts["queues_write_available"].DataPoints = append(ts["queues_write_available"].DataPoints, dataPoint(float64(stat.Queues.Execution.Write.Available), t))
-		ts["queues_write_total"].DataPoints = append(ts["queues_write_total"].DataPoints, dataPoint(float64(stat.Queues.Execution.Write.TotalTickets), t))
+		ts["queues_read_out"].add(float64(stat.Queues.Execution.Read.Out))
+		ts["queues_read_available"].add(float64(stat.Queues.Execution.Read.Available))
+		ts["queues_read_total"].add(float64(stat.Queues.Execution.Read.TotalTickets))
+		ts["queues_write_out"].add(float64(stat.Queues.Execution.Write.Out))
+		ts["queues_write_available"].add(float64(stat.Queues.Execution.Write.Available))
+		ts["queues_write_total"].add(float64(stat.Queues.Execution.Write.TotalTickets))
 
 		// === Transactions (gauges) ===
-		ts["txn_active"].DataPoints = append(ts["txn_active"].DataPoints, dataPoint(float64(stat.Transactions.CurrentActive), t))
-		ts["txn_inactive"].DataPoints = append(ts["txn_inactive"].DataPoints, dataPoint(float64(stat.Transactions.CurrentInactive), t))
-		ts["txn_open"].DataPoints = append(ts["txn_open"].DataPoints, dataPoint(float64(stat.Transactions.CurrentOpen), t))
+		ts["txn_active"].add(float64(stat.Transactions.CurrentActive))
+		ts["txn_inactive"].add(float64(stat.Transactions.CurrentInactive))
+		ts["txn_open"].add(float64(stat.Transactions.CurrentOpen))
 
 		// === tcmalloc (gauges) ===
-		ts["tcmalloc_in_use"].DataPoints = append(ts["tcmalloc_in_use"].DataPoints, dataPoint(float64(stat.Tcmalloc.Generic.BytesInUseByApp)/gb, t))
-		ts["tcmalloc_allocated"].DataPoints = append(ts["tcmalloc_allocated"].DataPoints, dataPoint(float64(stat.Tcmalloc.Generic.CurrentAllocatedBytes)/gb, t))
-		ts["tcmalloc_heap"].DataPoints = append(ts["tcmalloc_heap"].DataPoints, dataPoint(float64(stat.Tcmalloc.Generic.HeapSize)/gb, t))
-		ts["tcmalloc_physical"].DataPoints = append(ts["tcmalloc_physical"].DataPoints, dataPoint(float64(stat.Tcmalloc.Generic.PhysicalMemoryUsed)/gb, t))
+		ts["tcmalloc_in_use"].add(float64(stat.Tcmalloc.Generic.BytesInUseByApp) / gb)
+		ts["tcmalloc_allocated"].add(float64(stat.Tcmalloc.Generic.CurrentAllocatedBytes) / gb)
+		ts["tcmalloc_heap"].add(float64(stat.Tcmalloc.Generic.HeapSize) / gb)
+		ts["tcmalloc_physical"].add(float64(stat.Tcmalloc.Generic.PhysicalMemoryUsed) / gb)
 
 		// === Flow Control (gauge) ===
-		ts["flowctl_rate_limit"].DataPoints = append(ts["flowctl_rate_limit"].DataPoints, dataPoint(float64(stat.FlowControl.TargetRateLimit), t))
+		ts["flowctl_rate_limit"].add(float64(stat.FlowControl.TargetRateLimit))
 
 		// === Delta-based metrics (need previous stat) ===
 		if i > 0 {
@@ -331,66 +488,67 @@ func getAllServerStatusTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[str
 			}
 
 			// Server Status deltas
-			ts["mem_page_faults"].DataPoints = append(ts["mem_page_faults"].DataPoints, dataPoint(float64(stat.ExtraInfo.PageFaults-pstat.ExtraInfo.PageFaults)/seconds, t))
-			ts["conns_created/s"].DataPoints = append(ts["conns_created/s"].DataPoints, dataPoint(float64(stat.Connections.TotalCreated-pstat.Connections.TotalCreated)/seconds, t))
-			ts["net_in"].DataPoints = append(ts["net_in"].DataPoints, dataPoint(float64(stat.Network.BytesIn-pstat.Network.BytesIn)/mb/seconds, t))
-			ts["net_out"].DataPoints = append(ts["net_out"].DataPoints, dataPoint(float64(stat.Network.BytesOut-pstat.Network.BytesOut)/mb/seconds, t))
-			ts["net_requests"].DataPoints = append(ts["net_requests"].DataPoints, dataPoint(float64(stat.Network.NumRequests-pstat.Network.NumRequests)/seconds, t))
-			ts["net_physical_in"].DataPoints = append(ts["net_physical_in"].DataPoints, dataPoint(float64(stat.Network.PhysicalBytesIn-pstat.Network.PhysicalBytesIn)/mb/seconds, t))
-			ts["net_physical_out"].DataPoints = append(ts["net_physical_out"].DataPoints, dataPoint(float64(stat.Network.PhysicalBytesOut-pstat.Network.PhysicalBytesOut)/mb/seconds, t))
-			ts["ops_query"].DataPoints = append(ts["ops_query"].DataPoints, dataPoint(float64(stat.OpCounters.Query-pstat.OpCounters.Query)/seconds, t))
-			ts["ops_insert"].DataPoints = append(ts["ops_insert"].DataPoints, dataPoint(float64(stat.OpCounters.Insert-pstat.OpCounters.Insert)/seconds, t))
-			ts["ops_update"].DataPoints = append(ts["ops_update"].DataPoints, dataPoint(float64(stat.OpCounters.Update-pstat.OpCounters.Update)/seconds, t))
-			ts["ops_delete"].DataPoints = append(ts["ops_delete"].DataPoints, dataPoint(float64(stat.OpCounters.Delete-pstat.OpCounters.Delete)/seconds, t))
-			ts["ops_getmore"].DataPoints = append(ts["ops_getmore"].DataPoints, dataPoint(float64(stat.OpCounters.Getmore-pstat.OpCounters.Getmore)/seconds, t))
-			ts["ops_command"].DataPoints = append(ts["ops_command"].DataPoints, dataPoint(float64(stat.OpCounters.Command-pstat.OpCounters.Command)/seconds, t))
-			ts["scan_keys"].DataPoints = append(ts["scan_keys"].DataPoints, dataPoint(float64(stat.Metrics.QueryExecutor.Scanned-pstat.Metrics.QueryExecutor.Scanned)/seconds, t))
-			ts["scan_objects"].DataPoints = append(ts["scan_objects"].DataPoints, dataPoint(float64(stat.Metrics.QueryExecutor.ScannedObjects-pstat.Metrics.QueryExecutor.ScannedObjects)/seconds, t))
-			ts["scan_sort"].DataPoints = append(ts["scan_sort"].DataPoints, dataPoint(float64(stat.Metrics.Operation.ScanAndOrder-pstat.Metrics.Operation.ScanAndOrder)/seconds, t))
+			ts["mem_page_faults"].add(float64(stat.ExtraInfo.PageFaults-pstat.ExtraInfo.PageFaults) / seconds)
+			ts["conns_created/s"].add(float64(stat.Connections.TotalCreated-pstat.Connections.TotalCreated) / seconds)
+			ts["net_in"].add(float64(stat.Network.BytesIn-pstat.Network.BytesIn) / mb / seconds)
+			ts["net_out"].add(float64(stat.Network.BytesOut-pstat.Network.BytesOut) / mb / seconds)
+			ts["net_requests"].add(float64(stat.Network.NumRequests-pstat.Network.NumRequests) / seconds)
+			ts["net_physical_in"].add(float64(stat.Network.PhysicalBytesIn-pstat.Network.PhysicalBytesIn) / mb / seconds)
+			ts["net_physical_out"].add(float64(stat.Network.PhysicalBytesOut-pstat.Network.PhysicalBytesOut) / mb / seconds)
+			ts["ops_query"].add(float64(stat.OpCounters.Query-pstat.OpCounters.Query) / seconds)
+			ts["ops_insert"].add(float64(stat.OpCounters.Insert-pstat.OpCounters.Insert) / seconds)
+			ts["ops_update"].add(float64(stat.OpCounters.Update-pstat.OpCounters.Update) / seconds)
+			ts["ops_delete"].add(float64(stat.OpCounters.Delete-pstat.OpCounters.Delete) / seconds)
+			ts["ops_getmore"].add(float64(stat.OpCounters.Getmore-pstat.OpCounters.Getmore) / seconds)
+			ts["ops_command"].add(float64(stat.OpCounters.Command-pstat.OpCounters.Command) / seconds)
+			ts["scan_keys"].add(float64(stat.Metrics.QueryExecutor.Scanned-pstat.Metrics.QueryExecutor.Scanned) / seconds)
+			ts["scan_objects"].add(float64(stat.Metrics.QueryExecutor.ScannedObjects-pstat.Metrics.QueryExecutor.ScannedObjects) / seconds)
+			ts["scan_sort"].add(float64(stat.Metrics.Operation.ScanAndOrder-pstat.Metrics.Operation.ScanAndOrder) / seconds)
 
 			// Query Targeting (ratio of scanned to returned - lower is better, 1.0 is ideal)
 			docReturnedDelta := float64(stat.Metrics.Document.Returned - pstat.Metrics.Document.Returned)
 			if docReturnedDelta > 0 {
 				keysDelta := float64(stat.Metrics.QueryExecutor.Scanned - pstat.Metrics.QueryExecutor.Scanned)
 				objDelta := float64(stat.Metrics.QueryExecutor.ScannedObjects - pstat.Metrics.QueryExecutor.ScannedObjects)
-				ts["query_targeting_keys"].DataPoints = append(ts["query_targeting_keys"].DataPoints, dataPoint(keysDelta/docReturnedDelta, t))
-				ts["query_targeting_objects"].DataPoints = append(ts["query_targeting_objects"].DataPoints, dataPoint(objDelta/docReturnedDelta, t))
+				ts["query_targeting_keys"].add(keysDelta / docReturnedDelta)
+				ts["query_targeting_objects"].add(objDelta / docReturnedDelta)
 			} else {
-				ts["query_targeting_keys"].DataPoints = append(ts["query_targeting_keys"].DataPoints, dataPoint(0, t))
-				ts["query_targeting_objects"].DataPoints = append(ts["query_targeting_objects"].DataPoints, dataPoint(0, t))
+				ts["query_targeting_keys"].add(0)
+				ts["query_targeting_objects"].add(0)
 			}
 
 			// Document metrics (per second)
-			ts["doc_returned/s"].DataPoints = append(ts["doc_returned/s"].DataPoints, dataPoint(float64(stat.Metrics.Document.Returned-pstat.Metrics.Document.Returned)/seconds, t))
-			ts["doc_inserted/s"].DataPoints = append(ts["doc_inserted/s"].DataPoints, dataPoint(float64(stat.Metrics.Document.Inserted-pstat.Metrics.Document.Inserted)/seconds, t))
-			ts["doc_updated/s"].DataPoints = append(ts["doc_updated/s"].DataPoints, dataPoint(float64(stat.Metrics.Document.Updated-pstat.Metrics.Document.Updated)/seconds, t))
-			ts["doc_deleted/s"].DataPoints = append(ts["doc_deleted/s"].DataPoints, dataPoint(float64(stat.Metrics.Document.Deleted-pstat.Metrics.Document.Deleted)/seconds, t))
+			ts["doc_returned/s"].add(float64(stat.Metrics.Document.Returned-pstat.Metrics.Document.Returned) / seconds)
+			ts["doc_inserted/s"].add(float64(stat.Metrics.Document.Inserted-pstat.Metrics.Document.Inserted) / seconds)
+			ts["doc_updated/s"].add(float64(stat.Metrics.Document.Updated-pstat.Metrics.Document.Updated) / seconds)
+			ts["doc_deleted/s"].add(float64(stat.Metrics.Document.Deleted-pstat.Metrics.Document.Deleted) / seconds)
 
 			// Write Conflicts (per second)
-			ts["write_conflicts/s"].DataPoints = append(ts["write_conflicts/s"].DataPoints, dataPoint(float64(stat.Metrics.Operation.WriteConflicts-pstat.Metrics.Operation.WriteConflicts)/seconds, t))
+			ts["write_conflicts/s"].add(float64(stat.Metrics.Operation.WriteConflicts-pstat.Metrics.Operation.WriteConflicts) / seconds)
 
 			// WiredTiger deltas
-			ts["wt_blkmgr_read"].DataPoints = append(ts["wt_blkmgr_read"].DataPoints, dataPoint(float64(stat.WiredTiger.BlockManager.BytesRead-pstat.WiredTiger.BlockManager.BytesRead)/mb/seconds, t))
-			ts["wt_blkmgr_written"].DataPoints = append(ts["wt_blkmgr_written"].DataPoints, dataPoint(float64(stat.WiredTiger.BlockManager.BytesWritten-pstat.WiredTiger.BlockManager.BytesWritten)/mb/seconds, t))
-			ts["wt_blkmgr_written_checkpoint"].DataPoints = append(ts["wt_blkmgr_written_checkpoint"].DataPoints, dataPoint(float64(stat.WiredTiger.BlockManager.BytesWrittenCheckPoint-pstat.WiredTiger.BlockManager.BytesWrittenCheckPoint)/mb/seconds, t))
-			ts["wt_modified_evicted"].DataPoints = append(ts["wt_modified_evicted"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.ModifiedPagesEvicted-pstat.WiredTiger.Cache.ModifiedPagesEvicted)/seconds, t))
-			ts["wt_unmodified_evicted"].DataPoints = append(ts["wt_unmodified_evicted"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.UnmodifiedPagesEvicted-pstat.WiredTiger.Cache.UnmodifiedPagesEvicted)/seconds, t))
-			ts["wt_cache_read_in"].DataPoints = append(ts["wt_cache_read_in"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.BytesReadIntoCache-pstat.WiredTiger.Cache.BytesReadIntoCache)/mb/seconds, t))
-			ts["wt_cache_written_from"].DataPoints = append(ts["wt_cache_written_from"].DataPoints, dataPoint(float64(stat.WiredTiger.Cache.BytesWrittenFromCache-pstat.WiredTiger.Cache.BytesWrittenFromCache)/mb/seconds, t))
+			ts["wt_blkmgr_read"].add(float64(stat.WiredTiger.BlockManager.BytesRead-pstat.WiredTiger.BlockManager.BytesRead) / mb / seconds)
+			ts["wt_blkmgr_written"].add(float64(stat.WiredTiger.BlockManager.BytesWritten-pstat.WiredTiger.BlockManager.BytesWritten) / mb / seconds)
+			ts["wt_blkmgr_written_checkpoint"].add(float64(stat.WiredTiger.BlockManager.BytesWrittenCheckPoint-pstat.WiredTiger.BlockManager.BytesWrittenCheckPoint) / mb / seconds)
+			ts["wt_modified_evicted"].add(float64(stat.WiredTiger.Cache.ModifiedPagesEvicted-pstat.WiredTiger.Cache.ModifiedPagesEvicted) / seconds)
+			ts["wt_unmodified_evicted"].add(float64(stat.WiredTiger.Cache.UnmodifiedPagesEvicted-pstat.WiredTiger.Cache.UnmodifiedPagesEvicted) / seconds)
+			ts["wt_cache_read_in"].add(float64(stat.WiredTiger.Cache.BytesReadIntoCache-pstat.WiredTiger.Cache.BytesReadIntoCache) / mb / seconds)
+			ts["wt_cache_written_from"].add(float64(stat.WiredTiger.Cache.BytesWrittenFromCache-pstat.WiredTiger.Cache.BytesWrittenFromCache) / mb / seconds)
 
 			// Transactions deltas
-			ts["txn_aborted/s"].DataPoints = append(ts["txn_aborted/s"].DataPoints, dataPoint(float64(stat.Transactions.TotalAborted-pstat.Transactions.TotalAborted)/seconds, t))
-			ts["txn_committed/s"].DataPoints = append(ts["txn_committed/s"].DataPoints, dataPoint(float64(stat.Transactions.TotalCommitted-pstat.Transactions.TotalCommitted)/seconds, t))
-			ts["txn_started/s"].DataPoints = append(ts["txn_started/s"].DataPoints, dataPoint(float64(stat.Transactions.TotalStarted-pstat.Transactions.TotalStarted)/seconds, t))
+			ts["txn_aborted/s"].add(float64(stat.Transactions.TotalAborted-pstat.Transactions.TotalAborted) / seconds)
+			ts["txn_committed/s"].add(float64(stat.Transactions.TotalCommitted-pstat.Transactions.TotalCommitted) / seconds)
+			ts["txn_started/s"].add(float64(stat.Transactions.TotalStarted-pstat.Transactions.TotalStarted) / seconds)
 
 			// Flow Control deltas
-			ts["flowctl_acquiring_us"].DataPoints = append(ts["flowctl_acquiring_us"].DataPoints, dataPoint(float64(stat.FlowControl.TimeAcquiringMicros-pstat.FlowControl.TimeAcquiringMicros)/seconds, t))
-			ts["flowctl_lagged_count"].DataPoints = append(ts["flowctl_lagged_count"].DataPoints, dataPoint(float64(stat.FlowControl.IsLaggedCount-pstat.FlowControl.IsLaggedCount)/seconds, t))
+			ts["flowctl_acquiring_us"].add(float64(stat.FlowControl.TimeAcquiringMicros-pstat.FlowControl.TimeAcquiringMicros) / seconds)
+			ts["flowctl_lagged_count"].add(float64(stat.FlowControl.IsLaggedCount-pstat.FlowControl.IsLaggedCount) / seconds)
 		}
 
 		pstat = stat
 	}
 
+	setTimes(ts, times)
 	return toValueMap(ts)
 }
 
@@ -460,8 +618,3 @@ func getFlowControlTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[string]
 	}
 	return result
 }
-
-// Deprecated: use dataPoint instead
-func getDataPoint(v float64, t float64) []float64 {
-	return dataPoint(v, t)
-}
@@ -0,0 +1,196 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+// time_series_data_legacy_test.go
+
+package ftdc
+
+import "math"
+
+// legacyTimeSeriesDoc is the former layout of a series, a [value, timestamp] slice per point
+type legacyTimeSeriesDoc struct {
+	Target     string
+	DataPoints [][]float64
+}
+
+// legacyDataPoint returns a pre-allocated 2-element slice [value, timestamp]
+func legacyDataPoint(v, t float64) []float64 {
+	if v < 0 {
+		v = 0
+	}
+	return []float64{v, t}
+}
+
+// legacyInitTimeSeriesMap creates a map with pre-allocated slices for each legend
+func legacyInitTimeSeriesMap(legends []string, capacity int) map[string]*legacyTimeSeriesDoc {
+	m := make(map[string]*legacyTimeSeriesDoc, len(legends))
+	for _, legend := range legends {
+		m[legend] = &legacyTimeSeriesDoc{
+			Target:     legend,
+			DataPoints: make([][]float64, 0, capacity),
+		}
+	}
+	return m
+}
+
+// legacyToValueMap converts pointer map to value map for return
+func legacyToValueMap(m map[string]*legacyTimeSeriesDoc) map[string]legacyTimeSeriesDoc {
+	result := make(map[string]legacyTimeSeriesDoc, len(m))
+	for k, v := range m {
+		result[k] = *v
+	}
+	return result
+}
+
+// getLegacyServerStatusTimeSeriesDoc is getAllServerStatusTimeSeriesDoc before the columnar layout
+func getLegacyServerStatusTimeSeriesDoc(serverStatusList []ServerStatusDoc) map[string]legacyTimeSeriesDoc {
+	n := len(serverStatusList)
+	if n == 0 {
+		return map[string]legacyTimeSeriesDoc{}
+	}
+
+	// Combine all legends for single-pass processing
+	allLegends := make([]string, 0, len(serverStatusChartsLegends)+len(wiredTigerChartsLegends)+
+		len(queuesChartsLegends)+len(transactionsChartsLegends)+len(tcmallocChartsLegends)+len(flowControlChartsLegends))
+	allLegends = append(allLegends, serverStatusChartsLegends...)
+	allLegends = append(allLegends, wiredTigerChartsLegends...)
+	allLegends = append(allLegends, queuesChartsLegends...)
+	allLegends = append(allLegends, transactionsChartsLegends...)
+	allLegends = append(allLegends, tcmallocChartsLegends...)
+	allLegends = append(allLegends, flowControlChartsLegends...)
+
+	ts := legacyInitTimeSeriesMap(allLegends, n)
+	var pstat ServerStatusDoc
+
+	for i, stat := range serverStatusList {
+		if stat.Uptime <= pstat.Uptime {
+			pstat = stat
+			continue
+		}
+
+		t := float64(stat.LocalTime.UnixNano() / (1000 * 1000))
+
+		// === Server Status metrics (gauges - no delta needed) ===
+		ts["mem_resident"].DataPoints = append(ts["mem_resident"].DataPoints, legacyDataPoint(float64(stat.Mem.Resident)/1024, t))
+		ts["mem_virtual"].DataPoints = append(ts["mem_virtual"].DataPoints, legacyDataPoint(float64(stat.Mem.Virtual)/1024, t))
+		ts["conns_active"].DataPoints = append(ts["conns_active"].DataPoints, legacyDataPoint(float64(stat.Connections.Active), t))
+		ts["conns_available"].DataPoints = append(ts["conns_available"].DataPoints, legacyDataPoint(float64(stat.Connections.Available), t))
+		ts["conns_current"].DataPoints = append(ts["conns_current"].DataPoints, legacyDataPoint(float64(stat.Connections.Current), t))
+		ts["q_active_read"].DataPoints = append(ts["q_active_read"].DataPoints, legacyDataPoint(float64(stat.GlobalLock.ActiveClients.Readers), t))
+		ts["q_active_write"].DataPoints = append(ts["q_active_write"].DataPoints, legacyDataPoint(float64(stat.GlobalLock.ActiveClients.Writers), t))
+		ts["q_queued_read"].DataPoints = append(ts["q_queued_read"].DataPoints, legacyDataPoint(float64(stat.GlobalLock.CurrentQueue.Readers), t))
+		ts["q_queued_write"].DataPoints = append(ts["q_queued_write"].DataPoints, legacyDataPoint(float64(stat.GlobalLock.CurrentQueue.Writers), t))
+
+		// Latencies (computed)
+		var r, w, c float64
+		if stat.OpLatencies.Reads.Ops > 0 {
+			r = float64(stat.OpLatencies.Reads.Latency) / float64(stat.OpLatencies.Reads.Ops) / 1000
+		}
+		if stat.OpLatencies.Writes.Ops > 0 {
+			w = float64(stat.OpLatencies.Writes.Latency) / float64(stat.OpLatencies.Writes.Ops) / 1000
+		}
+		if stat.OpLatencies.Commands.Ops > 0 {
+			c = float64(stat.OpLatencies.Commands.Latency) / float64(stat.OpLatencies.Commands.Ops) / 1000
+		}
+		ts["latency_read"].DataPoints = append(ts["latency_read"].DataPoints, legacyDataPoint(r, t))
+		ts["latency_write"].DataPoints = append(ts["latency_write"].DataPoints, legacyDataPoint(w, t))
+		ts["latency_command"].DataPoints = append(ts["latency_command"].DataPoints, legacyDataPoint(c, t))
+
+		// === WiredTiger metrics (gauges) ===
+		ts["wt_cache_max"].DataPoints = append(ts["wt_cache_max"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.MaxBytesConfigured)/gb, t))
+		ts["wt_cache_used"].DataPoints = append(ts["wt_cache_used"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.CurrentlyInCache)/gb, t))
+		ts["wt_cache_dirty"].DataPoints = append(ts["wt_cache_dirty"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.TrackedDirtyBytes)/gb, t))
+		ts["wt_dhandles_active"].DataPoints = append(ts["wt_dhandles_active"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.DataHandle.Active), t))
+		ts["ticket_avail_read"].DataPoints = append(ts["ticket_avail_read"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.ConcurrentTransactions.Read.Available), t))
+		ts["ticket_avail_write"].DataPoints = append(ts["ticket_avail_write"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.ConcurrentTransactions.Write.Available), t))
+
+		// === Queues (MongoDB 7.0+) ===
+		ts["queues_read_out"].DataPoints = append(ts["queues_read_out"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Read.Out), t))
+		ts["queues_read_available"].DataPoints = append(ts["queues_read_available"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Read.Available), t))
+		ts["queues_read_total"].DataPoints = append(ts["queues_read_total"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Read.TotalTickets), t))
+		ts["queues_write_out"].DataPoints = append(ts["queues_write_out"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Write.Out), t))
+		ts["queues_write_available"].DataPoints = append(ts["queues_write_available"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Write.Available), t))
+		ts["queues_write_total"].DataPoints = append(ts["queues_write_total"].DataPoints, legacyDataPoint(float64(stat.Queues.Execution.Write.TotalTickets), t))
+
+		// === Transactions (gauges) ===
+		ts["txn_active"].DataPoints = append(ts["txn_active"].DataPoints, legacyDataPoint(float64(stat.Transactions.CurrentActive), t))
+		ts["txn_inactive"].DataPoints = append(ts["txn_inactive"].DataPoints, legacyDataPoint(float64(stat.Transactions.CurrentInactive), t))
+		ts["txn_open"].DataPoints = append(ts["txn_open"].DataPoints, legacyDataPoint(float64(stat.Transactions.CurrentOpen), t))
+
+		// === tcmalloc (gauges) ===
+		ts["tcmalloc_in_use"].DataPoints = append(ts["tcmalloc_in_use"].DataPoints, legacyDataPoint(float64(stat.Tcmalloc.Generic.BytesInUseByApp)/gb, t))
+		ts["tcmalloc_allocated"].DataPoints = append(ts["tcmalloc_allocated"].DataPoints, legacyDataPoint(float64(stat.Tcmalloc.Generic.CurrentAllocatedBytes)/gb, t))
+		ts["tcmalloc_heap"].DataPoints = append(ts["tcmalloc_heap"].DataPoints, legacyDataPoint(float64(stat.Tcmalloc.Generic.HeapSize)/gb, t))
+		ts["tcmalloc_physical"].DataPoints = append(ts["tcmalloc_physical"].DataPoints, legacyDataPoint(float64(stat.Tcmalloc.Generic.PhysicalMemoryUsed)/gb, t))
+
+		// === Flow Control (gauge) ===
+		ts["flowctl_rate_limit"].DataPoints = append(ts["flowctl_rate_limit"].DataPoints, legacyDataPoint(float64(stat.FlowControl.TargetRateLimit), t))
+
+		// === Delta-based metrics (need previous stat) ===
+		if i > 0 {
+			seconds := math.Round(stat.LocalTime.Sub(pstat.LocalTime).Seconds())
+			if seconds < 1 {
+				seconds = 1
+			}
+
+			// Server Status deltas
+			ts["mem_page_faults"].DataPoints = append(ts["mem_page_faults"].DataPoints, legacyDataPoint(float64(stat.ExtraInfo.PageFaults-pstat.ExtraInfo.PageFaults)/seconds, t))
+			ts["conns_created/s"].DataPoints = append(ts["conns_created/s"].DataPoints, legacyDataPoint(float64(stat.Connections.TotalCreated-pstat.Connections.TotalCreated)/seconds, t))
+			ts["net_in"].DataPoints = append(ts["net_in"].DataPoints, legacyDataPoint(float64(stat.Network.BytesIn-pstat.Network.BytesIn)/mb/seconds, t))
+			ts["net_out"].DataPoints = append(ts["net_out"].DataPoints, legacyDataPoint(float64(stat.Network.BytesOut-pstat.Network.BytesOut)/mb/seconds, t))
+			ts["net_requests"].DataPoints = append(ts["net_requests"].DataPoints, legacyDataPoint(float64(stat.Network.NumRequests-pstat.Network.NumRequests)/seconds, t))
+			ts["net_physical_in"].DataPoints = append(ts["net_physical_in"].DataPoints, legacyDataPoint(float64(stat.Network.PhysicalBytesIn-pstat.Network.PhysicalBytesIn)/mb/seconds, t))
+			ts["net_physical_out"].DataPoints = append(ts["net_physical_out"].DataPoints, legacyDataPoint(float64(stat.Network.PhysicalBytesOut-pstat.Network.PhysicalBytesOut)/mb/seconds, t))
+			ts["ops_query"].DataPoints = append(ts["ops_query"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Query-pstat.OpCounters.Query)/seconds, t))
+			ts["ops_insert"].DataPoints = append(ts["ops_insert"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Insert-pstat.OpCounters.Insert)/seconds, t))
+			ts["ops_update"].DataPoints = append(ts["ops_update"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Update-pstat.OpCounters.Update)/seconds, t))
+			ts["ops_delete"].DataPoints = append(ts["ops_delete"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Delete-pstat.OpCounters.Delete)/seconds, t))
+			ts["ops_getmore"].DataPoints = append(ts["ops_getmore"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Getmore-pstat.OpCounters.Getmore)/seconds, t))
+			ts["ops_command"].DataPoints = append(ts["ops_command"].DataPoints, legacyDataPoint(float64(stat.OpCounters.Command-pstat.OpCounters.Command)/seconds, t))
+			ts["scan_keys"].DataPoints = append(ts["scan_keys"].DataPoints, legacyDataPoint(float64(stat.Metrics.QueryExecutor.Scanned-pstat.Metrics.QueryExecutor.Scanned)/seconds, t))
+			ts["scan_objects"].DataPoints = append(ts["scan_objects"].DataPoints, legacyDataPoint(float64(stat.Metrics.QueryExecutor.ScannedObjects-pstat.Metrics.QueryExecutor.ScannedObjects)/seconds, t))
+			ts["scan_sort"].DataPoints = append(ts["scan_sort"].DataPoints, legacyDataPoint(float64(stat.Metrics.Operation.ScanAndOrder-pstat.Metrics.Operation.ScanAndOrder)/seconds, t))
+
+			// Query Targeting (ratio of scanned to returned - lower is better, 1.0 is ideal)
+			docReturnedDelta := float64(stat.Metrics.Document.Returned - pstat.Metrics.Document.Returned)
+			if docReturnedDelta > 0 {
+				keysDelta := float64(stat.Metrics.QueryExecutor.Scanned - pstat.Metrics.QueryExecutor.Scanned)
+				objDelta := float64(stat.Metrics.QueryExecutor.ScannedObjects - pstat.Metrics.QueryExecutor.ScannedObjects)
+				ts["query_targeting_keys"].DataPoints = append(ts["query_targeting_keys"].DataPoints, legacyDataPoint(keysDelta/docReturnedDelta, t))
+				ts["query_targeting_objects"].DataPoints = append(ts["query_targeting_objects"].DataPoints, legacyDataPoint(objDelta/docReturnedDelta, t))
+			} else {
+				ts["query_targeting_keys"].DataPoints = append(ts["query_targeting_keys"].DataPoints, legacyDataPoint(0, t))
+				ts["query_targeting_objects"].DataPoints = append(ts["query_targeting_objects"].DataPoints, legacyDataPoint(0, t))
+			}
+
+			// Document metrics (per second)
+			ts["doc_returned/s"].DataPoints = append(ts["doc_returned/s"].DataPoints, legacyDataPoint(float64(stat.Metrics.Document.Returned-pstat.Metrics.Document.Returned)/seconds, t))
+			ts["doc_inserted/s"].DataPoints = append(ts["doc_inserted/s"].DataPoints, legacyDataPoint(float64(stat.Metrics.Document.Inserted-pstat.Metrics.Document.Inserted)/seconds, t))
+			ts["doc_updated/s"].DataPoints = append(ts["doc_updated/s"].DataPoints, legacyDataPoint(float64(stat.Metrics.Document.Updated-pstat.Metrics.Document.Updated)/seconds, t))
+			ts["doc_deleted/s"].DataPoints = append(ts["doc_deleted/s"].DataPoints, legacyDataPoint(float64(stat.Metrics.Document.Deleted-pstat.Metrics.Document.Deleted)/seconds, t))
+
+			// Write Conflicts (per second)
+			ts["write_conflicts/s"].DataPoints = append(ts["write_conflicts/s"].DataPoints, legacyDataPoint(float64(stat.Metrics.Operation.WriteConflicts-pstat.Metrics.Operation.WriteConflicts)/seconds, t))
+
+			// WiredTiger deltas
+			ts["wt_blkmgr_read"].DataPoints = append(ts["wt_blkmgr_read"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.BlockManager.BytesRead-pstat.WiredTiger.BlockManager.BytesRead)/mb/seconds, t))
+			ts["wt_blkmgr_written"].DataPoints = append(ts["wt_blkmgr_written"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.BlockManager.BytesWritten-pstat.WiredTiger.BlockManager.BytesWritten)/mb/seconds, t))
+			ts["wt_blkmgr_written_checkpoint"].DataPoints = append(ts["wt_blkmgr_written_checkpoint"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.BlockManager.BytesWrittenCheckPoint-pstat.WiredTiger.BlockManager.BytesWrittenCheckPoint)/mb/seconds, t))
+			ts["wt_modified_evicted"].DataPoints = append(ts["wt_modified_evicted"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.ModifiedPagesEvicted-pstat.WiredTiger.Cache.ModifiedPagesEvicted)/seconds, t))
+			ts["wt_unmodified_evicted"].DataPoints = append(ts["wt_unmodified_evicted"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.UnmodifiedPagesEvicted-pstat.WiredTiger.Cache.UnmodifiedPagesEvicted)/seconds, t))
+			ts["wt_cache_read_in"].DataPoints = append(ts["wt_cache_read_in"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.BytesReadIntoCache-pstat.WiredTiger.Cache.BytesReadIntoCache)/mb/seconds, t))
+			ts["wt_cache_written_from"].DataPoints = append(ts["wt_cache_written_from"].DataPoints, legacyDataPoint(float64(stat.WiredTiger.Cache.BytesWrittenFromCache-pstat.WiredTiger.Cache.BytesWrittenFromCache)/mb/seconds, t))
+
+			// Transactions deltas
+			ts["txn_aborted/s"].DataPoints = append(ts["txn_aborted/s"].DataPoints, legacyDataPoint(float64(stat.Transactions.TotalAborted-pstat.Transactions.TotalAborted)/seconds, t))
+			ts["txn_committed/s"].DataPoints = append(ts["txn_committed/s"].DataPoints, legacyDataPoint(float64(stat.Transactions.TotalCommitted-pstat.Transactions.TotalCommitted)/seconds, t))
+			ts["txn_started/s"].DataPoints = append(ts["txn_started/s"].DataPoints, legacyDataPoint(float64(stat.Transactions.TotalStarted-pstat.Transactions.TotalStarted)/seconds, t))
+
+			// Flow Control deltas
+			ts["flowctl_acquiring_us"].DataPoints = append(ts["flowctl_acquiring_us"].DataPoints, legacyDataPoint(float64(stat.FlowControl.TimeAcquiringMicros-pstat.FlowControl.TimeAcquiringMicros)/seconds, t))
+			ts["flowctl_lagged_count"].DataPoints = append(ts["flowctl_lagged_count"].DataPoints, legacyDataPoint(float64(stat.FlowControl.IsLaggedCount-pstat.FlowControl.IsLaggedCount)/seconds, t))
+		}
+
+		pstat = stat
+	}
+
+	return legacyToValueMap(ts)
+}
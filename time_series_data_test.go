@@ -4,25 +4,71 @@
 package ftdc
 
 import (
+	"encoding/json"
+	"math"
+	"runtime"
 	"testing"
 	"time"
 )
 
-func TestGetDataPoint(t *testing.T) {
-	tm := float64(time.Now().UnixNano() / 1000 / 1000)
-	v := 123.45
-	dp := getDataPoint(v, tm)
-	if dp[0] != v {
-		t.Fatal()
+func TestTimeSeriesDoc(t *testing.T) {
+	doc := NewTimeSeriesDoc("ops_query", [][]float64{{1.5, 1000}, {math.NaN(), 2000}, {3e-7, 3000}})
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"target":"ops_query","datapoints":[[1.5,1000],[null,2000],[3e-7,3000]]}`
+	if string(b) != expected {
+		t.Fatalf("expected %v, got %v", expected, string(b))
+	}
+	var tsd TimeSeriesDoc
+	if err = json.Unmarshal([]byte(`{"target":"ops_query","datapoints":[[1.5,1000],[2,2000]]}`), &tsd); err != nil {
+		t.Fatal(err)
+	}
+	if tsd.Target != "ops_query" || tsd.Len() != 2 || tsd.Values[1] != 2 || tsd.Times[1] != 2000 {
+		t.Fatalf("unexpected %v", tsd)
+	}
+	if b, _ = json.Marshal(TimeSeriesDoc{}); string(b) != `{"target":"","datapoints":[]}` {
+		t.Fatalf("unexpected %v", string(b))
+	}
+
+	times := []float64{1000, 2000, 3000}
+	gauge, delta := &TimeSeriesDoc{}, &TimeSeriesDoc{}
+	gauge.add(1)
+	gauge.add(2)
+	gauge.add(3)
+	delta.add(-1)
+	delta.add(5)
+	setTimes(map[string]*TimeSeriesDoc{"gauge": gauge, "delta": delta}, times)
+	if &gauge.Times[0] != &times[0] || delta.Times[0] != 2000 || delta.Values[0] != 0 {
+		t.Fatalf("expected shared times, got %v %v", gauge, delta)
+	}
+	delta.Append(6, 4000) // copied on write
+	if times[2] != 3000 || delta.Len() != 3 || gauge.Len() != 3 || len(gauge.Times) != 3 {
+		t.Fatalf("unexpected %v %v", gauge, delta)
+	}
+	if slice := gauge.Slice(1, 3); slice.Len() != 2 || slice.Times[0] != 2000 || len(slice.DataPoints()) != 2 {
+		t.Fatalf("unexpected %v", slice)
+	}
+}
+
+func TestGetAllServerStatusTimeSeriesDoc(t *testing.T) {
+	list := getBenchServerStatusList(100)
+	tsd := getAllServerStatusTimeSeriesDoc(list)
+	mem, ops := tsd["mem_resident"], tsd["ops_query"]
+	if mem.Len() != 100 || ops.Len() != 99 || &mem.Times[1] != &ops.Times[0] { // deltas share the suffix
+		t.Fatalf("expected a shared time column, got %v %v", mem.Len(), ops.Len())
+	}
+	if ops.Times[0] != float64(list[1].LocalTime.UnixMilli()) || ops.Values[0] != 20 {
+		t.Fatalf("unexpected %v %v", ops.Times[0], ops.Values[0])
 	}
-	t.Log(dp)
 }
 
 func TestGetServerStatusTimeSeriesDoc(t *testing.T) {
 	d := NewDiagnosticData()
 	var filenames = []string{DiagnosticDataFilename}
 	d.DecodeDiagnosticData(filenames)
-	tsd := getServerStatusTimeSeriesDoc(d.ServerStatusList)
+	tsd := getServerStatusTimeSeriesDoc(d.ServerStatusColumns.GetServerStatusList())
 	if len(tsd) == 0 {
 		t.Fatal()
 	}
@@ -52,7 +98,7 @@ func TestGetWiredTigerTimeSeriesDoc(t *testing.T) {
 	d := NewDiagnosticData()
 	var filenames = []string{DiagnosticDataFilename}
 	d.DecodeDiagnosticData(filenames)
-	tsd := getWiredTigerTimeSeriesDoc(d.ServerStatusList)
+	tsd := getWiredTigerTimeSeriesDoc(d.ServerStatusColumns.GetServerStatusList())
 	if len(tsd) == 0 {
 		t.Fatal()
 	}
@@ -72,23 +118,63 @@ func BenchmarkGetAllServerStatusTimeSeriesDoc(b *testing.B) {
 	if err := d.DecodeDiagnosticData(filenames); err != nil {
 		b.Skip("no test data available")
 	}
-	if len(d.ServerStatusList) == 0 {
+	if len(d.ServerStatusColumns.GetServerStatusList()) == 0 {
 		b.Skip("no server status data")
 	}
 
 	b.ResetTimer()
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		_ = getAllServerStatusTimeSeriesDoc(d.ServerStatusList)
+		_ = getAllServerStatusTimeSeriesDoc(d.ServerStatusColumns.GetServerStatusList())
+	}
+}
+
+// getBenchServerStatusList returns serverStatus of a sample per second
+func getBenchServerStatusList(n int) []ServerStatusDoc {
+	start := time.Date(2020, 5, 13, 14, 20, 19, 0, time.UTC)
+	list := make([]ServerStatusDoc, n)
+	for i := range list {
+		list[i].LocalTime = start.Add(time.Duration(i) * time.Second)
+		list[i].Uptime = uint64(1000 + i)
+		list[i].Mem.Resident = 1024
+		list[i].Connections.Current = uint64(10 + i%3)
+		list[i].OpCounters = OpCountersDoc{Insert: uint64(10 * i), Query: uint64(20 * i)}
 	}
+	return list
+}
+
+// getRetainedBytes returns heap retained by the result of fn
+func getRetainedBytes(fn func() interface{}) float64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	v := fn()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(v)
+	return float64(after.HeapAlloc) - float64(before.HeapAlloc)
 }
 
-func BenchmarkDataPoint(b *testing.B) {
-	tm := float64(time.Now().UnixNano() / 1000 / 1000)
-	v := 123.45
+// BenchmarkTimeSeriesColumns loads a day of samples into shared time and value columns
+func BenchmarkTimeSeriesColumns(b *testing.B) {
+	list := getBenchServerStatusList(86400)
+	retained := getRetainedBytes(func() interface{} { return getAllServerStatusTimeSeriesDoc(list) })
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = getAllServerStatusTimeSeriesDoc(list)
+	}
+	b.ReportMetric(retained, "retained-B")
+}
 
+// BenchmarkTimeSeriesRows loads a day of samples with the former [][]float64 implementation
+func BenchmarkTimeSeriesRows(b *testing.B) {
+	list := getBenchServerStatusList(86400)
+	retained := getRetainedBytes(func() interface{} { return getLegacyServerStatusTimeSeriesDoc(list) })
 	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = dataPoint(v, tm)
+		_ = getLegacyServerStatusTimeSeriesDoc(list)
 	}
+	b.ReportMetric(retained, "retained-B")
 }